@@ -0,0 +1,660 @@
+package githubtracker
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/pkg/errors"
+)
+
+// Admin is a dashboard, behind basic auth, of the installations, recent and failed events (with
+// a retry button), linked pairs from the reconciler report, and the webhook urls, to revoke them.
+// webhook handlers are wrapped with `Record`; events are kept in memory since the server started
+type Admin struct {
+	PathPrefix    string // where the dashboard is mounted, e.g. /admin
+	Username      string
+	Password      string                // nothing is shown without one
+	ReportFile    string                // optional, see `Reconciler.ReportFile`
+	Installations *crypto.Installations // optional, the generated webhook urls
+	MaxEvents     int                   // recent and failed events, and installations, kept, each; 200 by default
+
+	mu            sync.Mutex
+	lastID        int
+	events        []*adminEvent // oldest first
+	failed        []*adminEvent // until a retry succeeds
+	installations map[adminInstallation]*adminInstallationStats
+	recorders     map[string]adminRecorder
+}
+
+// adminInstallation is a webhook url as seen from its events: the GH repo or PT project that
+// sent it (from the payload), and where it syncs to (from the url)
+type adminInstallation struct {
+	Source string
+	From   string
+	To     string
+}
+
+type adminInstallationStats struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Events    int
+	Failures  int
+}
+
+// adminEvent is one webhook request, and what came out of it
+type adminEvent struct {
+	ID           int
+	At           time.Time
+	Source       string
+	Name         string // e.g. issues.edited, see `capturedName`
+	Installation adminInstallation
+	RetryOf      int
+	RetriedBy    int
+	DryRun       bool
+	Writes       []adminWrite
+	Status       int // 0 while running
+	Error        string
+
+	admin   *Admin
+	request adminRequest // to retry it; never shown since the url has the encrypted token
+}
+
+type adminWrite struct {
+	Method  string
+	Target  string
+	Payload string
+	Error   string
+}
+
+type adminRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+func (e adminEvent) Failed() bool {
+	return e.Status >= http.StatusBadRequest
+}
+
+type adminContextKeyType int
+
+var adminContextKey adminContextKeyType = 0
+
+// adminEventFromContext returns the event being recorded, or nil
+func adminEventFromContext(ctx context.Context) *adminEvent {
+	e, _ := ctx.Value(adminContextKey).(*adminEvent)
+	return e
+}
+
+// tracker and github wrap the api clients of a webhook to record their writes into `e`
+func (e *adminEvent) tracker(api trackerAPIClient, dryRun bool) trackerAPIClient {
+	if e == nil {
+		return api
+	}
+	e.admin.mu.Lock()
+	e.DryRun = dryRun
+	e.admin.mu.Unlock()
+	return recordingTracker{api, e}
+}
+
+func (e *adminEvent) github(api githubAPIClient, dryRun bool) githubAPIClient {
+	if e == nil {
+		return api
+	}
+	e.admin.mu.Lock()
+	e.DryRun = dryRun
+	e.admin.mu.Unlock()
+	return recordingGithub{api, e}
+}
+
+func (e *adminEvent) record(method, target string, payload interface{}, err error) error {
+	data, _ := json.Marshal(payload)
+	write := adminWrite{Method: method, Target: target, Payload: string(data)}
+	if err != nil {
+		write.Error = err.Error()
+	}
+	e.admin.mu.Lock()
+	e.Writes = append(e.Writes, write)
+	e.admin.mu.Unlock()
+	return err
+}
+
+// Record wraps the webhook handler of `source` (github or pivotaltracker) with `authenticate`,
+// i.e. `RequireCipherNonce`, so a retry goes through it again; only requests it lets through
+// are recorded, with the installation of their decrypted url
+func (a *Admin) Record(source string, authenticate func(http.Handler) http.Handler, h http.Handler) http.Handler {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.recorders == nil {
+		a.recorders = map[string]adminRecorder{}
+	}
+	authenticated := authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e := adminEventFromContext(r.Context()); e != nil {
+			a.add(e, crypto.ValuesFromContext(r.Context()))
+		}
+		h.ServeHTTP(w, r)
+	}))
+	a.recorders[source] = adminRecorder{admin: a, source: source, handler: authenticated}
+	return a.recorders[source]
+}
+
+type adminRecorder struct {
+	admin   *Admin
+	source  string
+	handler http.Handler
+}
+
+func (rec adminRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.serve(w, r, 0)
+}
+
+// serve returns the event recorded, nil if the request was refused before its handler
+func (rec adminRecorder) serve(w http.ResponseWriter, r *http.Request, retryOf int) *adminEvent {
+	data, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	header := http.Header{}
+	for k, v := range r.Header {
+		header[k] = append([]string{}, v...)
+	}
+	e := &adminEvent{
+		At:      time.Now().UTC(),
+		Source:  rec.source,
+		Name:    capturedName(rec.source, r.Header, data),
+		RetryOf: retryOf,
+		admin:   rec.admin,
+		request: adminRequest{Method: r.Method, URL: r.URL.RequestURI(), Header: header, Body: data},
+	}
+
+	sw := &statusWriter{ResponseWriter: w}
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	rec.handler.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), adminContextKey, e)))
+	if e.ID == 0 {
+		return nil // never added, see `Record`
+	}
+	rec.admin.finish(e, sw.status(), strings.TrimSpace(sw.errorBody.String()))
+	return e
+}
+
+// installationOf tells which installation sent a webhook, from its decrypted url values; github
+// urls carry the PT project they sync to, tracker urls the GH repo
+func installationOf(source string, values url.Values, data []byte) adminInstallation {
+	var payload struct {
+		Repository *struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		Project *struct {
+			ID alwaysString `json:"id"`
+		} `json:"project"`
+	}
+	json.Unmarshal(data, &payload) // best effort
+	result := adminInstallation{Source: source}
+	switch source {
+	case "github":
+		result.To = values.Get("api_url")
+		if payload.Repository != nil {
+			result.From = payload.Repository.FullName
+		}
+	default:
+		result.To = values.Get("repo")
+		if payload.Project != nil {
+			result.From = "project " + payload.Project.ID.String()
+		}
+	}
+	return result
+}
+
+func (a *Admin) maxEvents() int {
+	if a.MaxEvents > 0 {
+		return a.MaxEvents
+	}
+	return 200
+}
+
+func (a *Admin) add(e *adminEvent, values url.Values) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastID++
+	e.ID = a.lastID
+	e.Installation = installationOf(e.Source, values, e.request.Body)
+	if a.events = append(a.events, e); len(a.events) > a.maxEvents() {
+		a.events = a.events[len(a.events)-a.maxEvents():]
+	}
+	if a.installations == nil {
+		a.installations = map[adminInstallation]*adminInstallationStats{}
+	}
+	stats, ok := a.installations[e.Installation]
+	if !ok {
+		stats = &adminInstallationStats{FirstSeen: e.At}
+		a.installations[e.Installation] = stats
+	}
+	stats.LastSeen = e.At
+	stats.Events++
+	if len(a.installations) > a.maxEvents() {
+		a.forgetInstallation()
+	}
+}
+
+// forgetInstallation drops the installation seen the longest ago
+func (a *Admin) forgetInstallation() {
+	var oldest adminInstallation
+	var oldestStats *adminInstallationStats
+	for i, stats := range a.installations {
+		if oldestStats == nil || stats.LastSeen.Before(oldestStats.LastSeen) {
+			oldest, oldestStats = i, stats
+		}
+	}
+	delete(a.installations, oldest)
+}
+
+func (a *Admin) finish(e *adminEvent, status int, errorText string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e.Status = status
+	if e.RetryOf > 0 {
+		a.resolve(e.RetryOf, e.ID)
+	}
+	if !e.Failed() {
+		return
+	}
+	e.Error = errorText
+	if stats, ok := a.installations[e.Installation]; ok {
+		stats.Failures++
+	}
+	if a.failed = append(a.failed, e); len(a.failed) > a.maxEvents() {
+		a.failed = a.failed[len(a.failed)-a.maxEvents():]
+	}
+}
+
+// resolve takes a failed event off the list once it was retried `by` another; that one is
+// listed instead if it failed too
+func (a *Admin) resolve(id, by int) {
+	for i, e := range a.failed {
+		if e.ID == id {
+			e.RetriedBy = by
+			a.failed = append(a.failed[:i:i], a.failed[i+1:]...)
+			return
+		}
+	}
+}
+
+// retry sends a failed event through its webhook handler again
+func (a *Admin) retry(id int) (*adminEvent, error) {
+	a.mu.Lock()
+	var original *adminEvent
+	for _, e := range a.failed {
+		if e.ID == id {
+			original = e
+		}
+	}
+	var rec adminRecorder
+	if original != nil {
+		rec = a.recorders[original.Source]
+	}
+	a.mu.Unlock()
+	if original == nil {
+		return nil, errors.Errorf("no failed event %d", id)
+	}
+
+	r, err := http.NewRequest(original.request.Method, original.request.URL, bytes.NewReader(original.request.Body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header = original.request.Header
+	e := rec.serve(&discardWriter{header: http.Header{}}, r, id)
+	if e == nil {
+		return nil, errors.Errorf("event %d was refused, e.g. its webhook url was revoked", id)
+	}
+	log.Printf("admin: retried event %d as %d: %d %s", id, e.ID, e.Status, e.Error)
+	return e, nil
+}
+
+// statusWriter remembers the status and, of failures, the error message
+type statusWriter struct {
+	http.ResponseWriter
+	code      int
+	errorBody bytes.Buffer
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status() >= http.StatusBadRequest && w.errorBody.Len() < 1024 {
+		w.errorBody.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// discardWriter is where retried responses go
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if a.Password == "" || !ok ||
+		subtle.ConstantTimeCompare([]byte(username), []byte(a.Username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(a.Password)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="githubtracker admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	prefix := strings.TrimRight(a.PathPrefix, "/")
+	switch strings.TrimPrefix(r.URL.Path, prefix) {
+	case "/retry":
+		if r.Method != "POST" || !sameOrigin(r) {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, _ := strconv.Atoi(r.FormValue("id"))
+		if _, err := a.retry(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, prefix+"/#failed", http.StatusSeeOther)
+	case "/revoke":
+		if r.Method != "POST" || !sameOrigin(r) {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if a.Installations == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := a.Installations.Revoke(r.FormValue("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("admin: revoked installation %s", r.FormValue("id"))
+		http.Redirect(w, r, prefix+"/#urls", http.StatusSeeOther)
+	case "", "/":
+		page, err := a.page()
+		if err != nil {
+			log.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if err = adminTemplate.Execute(w, page); err != nil {
+			log.Println(err.Error())
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// sameOrigin refuses posts from other sites, which the browser would send our basic auth with
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+type adminPage struct {
+	Installations []adminInstallationRow
+	Events        []adminEvent // newest first
+	Failed        []adminEvent
+	Report        *reconcileReport
+	ReportFile    string
+	URLs          []adminURLRow // nil without `Admin.Installations`
+}
+
+type adminURLRow struct {
+	crypto.Installation
+	Status string
+}
+
+type adminInstallationRow struct {
+	adminInstallation
+	adminInstallationStats
+}
+
+// page copies what is shown, so the template runs without the lock
+func (a *Admin) page() (adminPage, error) {
+	page := adminPage{ReportFile: a.ReportFile}
+	if a.ReportFile != "" {
+		report := &reconcileReport{}
+		if err := loadStateFile(a.ReportFile, report); err != nil {
+			return page, errors.Wrapf(err, "load %s", a.ReportFile)
+		}
+		if !report.At.IsZero() {
+			page.Report = report
+		}
+	}
+	if a.Installations != nil {
+		list, err := a.Installations.List()
+		if err != nil {
+			return page, err
+		}
+		page.URLs = []adminURLRow{}
+		for i := len(list) - 1; i >= 0; i-- {
+			page.URLs = append(page.URLs, adminURLRow{list[i], list[i].Status(time.Now())})
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := len(a.events) - 1; i >= 0; i-- {
+		page.Events = append(page.Events, *a.events[i])
+	}
+	for i := len(a.failed) - 1; i >= 0; i-- {
+		page.Failed = append(page.Failed, *a.failed[i])
+	}
+	for installation, stats := range a.installations {
+		page.Installations = append(page.Installations, adminInstallationRow{installation, *stats})
+	}
+	sort.Slice(page.Installations, func(i, j int) bool {
+		return page.Installations[i].LastSeen.After(page.Installations[j].LastSeen)
+	})
+	return page, nil
+}
+
+var adminTemplate = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>githubtracker admin</title>
+<style>
+  body { font-family: sans-serif; font-size: 14px; }
+  table { border-collapse: collapse; margin-bottom: 2em; }
+  th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; vertical-align: top; }
+  .failed { color: #b00; }
+  pre { white-space: pre-wrap; max-width: 60em; margin: 0; }
+</style>
+</head>
+<body>
+
+<h2>Installations</h2>
+<table>
+  <tr><th>webhook</th><th>from</th><th>to</th><th>first seen</th><th>last seen</th><th>events</th><th>failures</th></tr>
+  {{- range .Installations }}
+  <tr><td>{{ .Source }}</td><td>{{ .From }}</td><td>{{ .To }}</td><td>{{ time .FirstSeen }}</td><td>{{ time .LastSeen }}</td><td>{{ .Events }}</td><td>{{ .Failures }}</td></tr>
+  {{- else }}
+  <tr><td colspan="7">no webhooks since the server started</td></tr>
+  {{- end }}
+</table>
+
+<h2 id="failed">Failed</h2>
+<table>
+  <tr><th>#</th><th>at</th><th>webhook</th><th>event</th><th>status</th><th>error</th><th></th></tr>
+  {{- range .Failed }}
+  <tr class="failed">
+    <td>{{ .ID }}</td><td>{{ time .At }}</td><td>{{ .Source }} {{ .Installation.From }}</td><td>{{ .Name }}</td><td>{{ .Status }}</td><td><pre>{{ .Error }}</pre></td>
+    <td><form method="POST" action="retry"><input type="hidden" name="id" value="{{ .ID }}"><input type="submit" value="Retry"></form></td>
+  </tr>
+  {{- else }}
+  <tr><td colspan="7">nothing failed</td></tr>
+  {{- end }}
+</table>
+
+<h2>Recent events</h2>
+<table>
+  <tr><th>#</th><th>at</th><th>webhook</th><th>event</th><th>status</th><th>writes</th></tr>
+  {{- range .Events }}
+  <tr{{ if .Failed }} class="failed"{{ end }}>
+    <td>{{ .ID }}{{ if .RetryOf }} (retry of {{ .RetryOf }}){{ end }}{{ if .RetriedBy }} (retried by {{ .RetriedBy }}){{ end }}</td>
+    <td>{{ time .At }}</td><td>{{ .Source }} {{ .Installation.From }}</td><td>{{ .Name }}</td>
+    <td>{{ if .Status }}{{ .Status }}{{ else }}running{{ end }}{{ if .Error }}<pre>{{ .Error }}</pre>{{ end }}</td>
+    <td>
+      {{- if .DryRun }}<em>dry run, none written</em><br>{{ end }}
+      {{- range .Writes }}
+      <details><summary>{{ .Method }} {{ .Target }}{{ if .Error }} <span class="failed">{{ .Error }}</span>{{ end }}</summary><pre>{{ .Payload }}</pre></details>
+      {{- else }}none{{ end }}
+    </td>
+  </tr>
+  {{- else }}
+  <tr><td colspan="6">no webhooks since the server started</td></tr>
+  {{- end }}
+</table>
+
+{{- with .URLs }}
+<h2 id="urls">Webhook urls</h2>
+<table>
+  <tr><th>installation</th><th>url</th><th>syncs to</th><th>created</th><th>expires</th><th>status</th><th></th></tr>
+  {{- range . }}
+  <tr{{ if ne .Status "active" }} class="failed"{{ end }}>
+    <td>{{ .ID }}</td><td>{{ .Path }}</td><td>{{ .Target }}</td><td>{{ time .CreatedAt }}</td><td>{{ with .ExpiresAt }}{{ time . }}{{ end }}</td><td>{{ .Status }}</td>
+    <td>{{ if ne .Status "revoked" }}<form method="POST" action="revoke" onsubmit="return confirm('Revoke {{ .ID }}?')"><input type="hidden" name="id" value="{{ .ID }}"><input type="submit" value="Revoke"></form>{{ end }}</td>
+  </tr>
+  {{- end }}
+</table>
+{{- end }}
+
+<h2>Linked pairs</h2>
+{{- with .Report }}
+<p>as of the reconciler run at {{ time .At }}</p>
+<table>
+  <tr><th>issue</th><th>story</th><th>status</th><th>drift</th><th>fields</th><th>error</th></tr>
+  {{- range .Pairs }}
+  <tr{{ if or (eq .Status "conflict") (eq .Status "broken") (eq .Status "error") }} class="failed"{{ end }}>
+    <td><a href="{{ .IssueURL }}">{{ .IssueURL }}</a></td><td><a href="{{ .StoryURL }}">{{ .StoryURL }}</a></td>
+    <td>{{ .Status }}</td><td>{{ .Drift }}</td><td>{{ range .Fields }}{{ . }} {{ end }}</td><td>{{ .Error }}</td>
+  </tr>
+  {{- end }}
+</table>
+{{- else }}
+<p>no reconciler report{{ with .ReportFile }} in {{ . }} yet{{ else }}; run <code>server reconcile</code> with <code>-reconcile-report</code> and start the server with <code>RECONCILE_REPORT</code>{{ end }}</p>
+{{- end }}
+
+</body>
+</html>
+`))
+
+// recordingTracker writes to pivotal tracker, and records the writes into an `adminEvent`
+type recordingTracker struct {
+	trackerAPIClient
+	event *adminEvent
+}
+
+func (r recordingTracker) CreateStory(story *storyDetail) error {
+	return r.event.record("CreateStory", "", story, r.trackerAPIClient.CreateStory(story))
+}
+
+func (r recordingTracker) UpdateStory(story *storyDetail, rs *trackerSearchResultRow) error {
+	return r.event.record("UpdateStory", rs.ID.String(), story, r.trackerAPIClient.UpdateStory(story, rs))
+}
+
+func (r recordingTracker) DeleteStory(storyID string) error {
+	return r.event.record("DeleteStory", storyID, nil, r.trackerAPIClient.DeleteStory(storyID))
+}
+
+func (r recordingTracker) AddPullRequest(storyID string, pr *pullRequestDetail) error {
+	return r.event.record("AddPullRequest", storyID, pr, r.trackerAPIClient.AddPullRequest(storyID, pr))
+}
+
+func (r recordingTracker) AddSourceCommit(commit *sourceCommitDetail) error {
+	return r.event.record("AddSourceCommit", "", commit, r.trackerAPIClient.AddSourceCommit(commit))
+}
+
+func (r recordingTracker) CreateTask(storyID string, task *storyTask) error {
+	return r.event.record("CreateTask", storyID, task, r.trackerAPIClient.CreateTask(storyID, task))
+}
+
+func (r recordingTracker) UpdateTask(storyID string, task *storyTask) error {
+	return r.event.record("UpdateTask", storyID, task, r.trackerAPIClient.UpdateTask(storyID, task))
+}
+
+func (r recordingTracker) DeleteTask(storyID string, task *storyTask) error {
+	return r.event.record("DeleteTask", storyID, task, r.trackerAPIClient.DeleteTask(storyID, task))
+}
+
+func (r recordingTracker) CreateBlocker(storyID string, blocker *storyBlocker) error {
+	return r.event.record("CreateBlocker", storyID, blocker, r.trackerAPIClient.CreateBlocker(storyID, blocker))
+}
+
+func (r recordingTracker) UpdateBlocker(storyID string, blocker *storyBlocker) error {
+	return r.event.record("UpdateBlocker", storyID, blocker, r.trackerAPIClient.UpdateBlocker(storyID, blocker))
+}
+
+func (r recordingTracker) DeleteBlocker(storyID string, blocker *storyBlocker) error {
+	return r.event.record("DeleteBlocker", storyID, blocker, r.trackerAPIClient.DeleteBlocker(storyID, blocker))
+}
+
+func (r recordingTracker) UpdateEpic(epicID string, epic *epicDetail) error {
+	return r.event.record("UpdateEpic", epicID, epic, r.trackerAPIClient.UpdateEpic(epicID, epic))
+}
+
+func (r recordingTracker) AddLabel(storyID string, label trackerLabel) error {
+	return r.event.record("AddLabel", storyID, label, r.trackerAPIClient.AddLabel(storyID, label))
+}
+
+func (r recordingTracker) RemoveLabel(storyID string, label trackerLabel) error {
+	return r.event.record("RemoveLabel", storyID, label, r.trackerAPIClient.RemoveLabel(storyID, label))
+}
+
+// recordingGithub writes to github, and records the writes into an `adminEvent`
+type recordingGithub struct {
+	githubAPIClient
+	event *adminEvent
+}
+
+func (r recordingGithub) CreateIssue(issue *issueDetail) error {
+	return r.event.record("CreateIssue", issue.repo, issue, r.githubAPIClient.CreateIssue(issue))
+}
+
+func (r recordingGithub) UpdateIssue(issue *issueDetail, rs *githubSearchResultRow) error {
+	return r.event.record("UpdateIssue", rs.HTMLURL, issue, r.githubAPIClient.UpdateIssue(issue, rs))
+}
+
+// ensure we implement the interfaces
+var _ trackerAPIClient = recordingTracker{}
+var _ githubAPIClient = recordingGithub{}
@@ -0,0 +1,229 @@
+package githubtracker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminAuth(t *testing.T) {
+	testCases := []struct {
+		name           string
+		givenAdmin     *Admin
+		givenUsername  string
+		givenPassword  string
+		expectedStatus int
+	}{
+		{name: "no password set", givenAdmin: &Admin{Username: "admin"}, givenUsername: "admin", expectedStatus: http.StatusUnauthorized},
+		{name: "no credentials", givenAdmin: &Admin{Username: "admin", Password: "s3cret"}, expectedStatus: http.StatusUnauthorized},
+		{name: "wrong password", givenAdmin: &Admin{Username: "admin", Password: "s3cret"}, givenUsername: "admin", givenPassword: "secret", expectedStatus: http.StatusUnauthorized},
+		{name: "ok", givenAdmin: &Admin{Username: "admin", Password: "s3cret"}, givenUsername: "admin", givenPassword: "s3cret", expectedStatus: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/admin/", nil)
+			if tc.givenUsername != "" {
+				r.SetBasicAuth(tc.givenUsername, tc.givenPassword)
+			}
+			w := httptest.NewRecorder()
+			tc.givenAdmin.PathPrefix = "/admin"
+			tc.givenAdmin.ServeHTTP(w, r)
+			assert.Equal(t, tc.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAdminRetry(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/github/issues.edited.json")
+	assert.Nil(t, err)
+	admin := &Admin{PathPrefix: "/admin", Username: "admin", Password: "s3cret"}
+
+	// fails the first time, then writes to tracker
+	attempts := 0
+	handler := admin.Record("github", adminTestServer.RequireCipherNonce, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, string(data), string(body))
+		assert.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/123", r.URL.Query().Get("api_url"))
+		if attempts == 1 {
+			http.Error(w, "tracker is down", http.StatusInternalServerError)
+			return
+		}
+		api := adminEventFromContext(r.Context()).tracker(&logTrackerClient{}, false)
+		api.UpdateStory(&storyDetail{Title: "hello"}, &trackerSearchResultRow{ID: alwaysString{"42"}})
+	}))
+
+	webhookURL := adminTestURL(t, "http://example.com/github/", url.Values{"api_url": {"https://www.pivotaltracker.com/services/v5/projects/123"}})
+	r := httptest.NewRequest("POST", webhookURL, strings.NewReader(string(data)))
+	r.Header.Set("X-GitHub-Event", "issues")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, adminPageBody(t, admin), "tracker is down")
+	if assert.Len(t, admin.failed, 1) {
+		assert.Equal(t, "issues.edited", admin.failed[0].Name)
+	}
+
+	// from another site
+	r = httptest.NewRequest("POST", "http://example.com/admin/retry", strings.NewReader("id=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Origin", "https://evil.example.com")
+	r.SetBasicAuth("admin", "s3cret")
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, 1, attempts)
+
+	r = httptest.NewRequest("POST", "http://example.com/admin/retry", strings.NewReader("id=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("admin", "s3cret")
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, 2, attempts)
+	assert.Empty(t, admin.failed)
+	if assert.Len(t, admin.events, 2) {
+		assert.Equal(t, 2, admin.events[0].RetriedBy)
+		assert.Equal(t, 1, admin.events[1].RetryOf)
+		assert.Equal(t, []adminWrite{{Method: "UpdateStory", Target: "42", Payload: `{"name":"hello"}`}}, admin.events[1].Writes)
+	}
+	body := adminPageBody(t, admin)
+	assert.Contains(t, body, "nothing failed")
+	assert.Contains(t, body, "UpdateStory 42")
+	assert.Contains(t, body, "https://www.pivotaltracker.com/services/v5/projects/123")
+	assert.NotContains(t, body, mustParse(webhookURL).Query().Get("token"))
+}
+
+func TestAdminRetryFailingAgain(t *testing.T) {
+	admin := &Admin{}
+	handler := admin.Record("pivotaltracker", adminTestServer.RequireCipherNonce, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api := adminEventFromContext(r.Context()).github(&logGithubClient{ExpectedError: errors.New("rate limited")}, false)
+		err := api.CreateIssue(&issueDetail{repo: "user123/repo456"})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}))
+	webhookURL := adminTestURL(t, "http://example.com/pivotaltracker/", url.Values{"repo": {"user123/repo456"}})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", webhookURL, strings.NewReader(`{"project":{"id":2120247},"changes":[]}`)))
+	_, err := admin.retry(1)
+	assert.Nil(t, err)
+	if assert.Len(t, admin.failed, 1) {
+		e := admin.failed[0]
+		assert.Equal(t, 2, e.ID)
+		assert.Equal(t, "rate limited", e.Error)
+		assert.Equal(t, adminInstallation{Source: "pivotaltracker", From: "project 2120247", To: "user123/repo456"}, e.Installation)
+		assert.Equal(t, "rate limited", e.Writes[0].Error)
+	}
+	_, err = admin.retry(1)
+	assert.NotNil(t, err, "only the last attempt can be retried")
+	stats := admin.installations[adminInstallation{Source: "pivotaltracker", From: "project 2120247", To: "user123/repo456"}]
+	assert.Equal(t, &adminInstallationStats{FirstSeen: stats.FirstSeen, LastSeen: stats.LastSeen, Events: 2, Failures: 2}, stats)
+}
+
+func TestAdminRecordsOnlyAuthenticated(t *testing.T) {
+	admin := &Admin{MaxEvents: 2}
+	handled := 0
+	handler := admin.Record("github", adminTestServer.RequireCipherNonce, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+	}))
+	post := func(webhookURL, body string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", webhookURL, strings.NewReader(body)))
+		return w.Code
+	}
+
+	// forged, or not of this server
+	assert.Equal(t, http.StatusUnauthorized, post("http://example.com/github/?api_url=https://evil.example.com&token=xxx&nonce=yyy", `{"repository":{"full_name":"evil/repo"}}`))
+	assert.Equal(t, 0, handled)
+	assert.Empty(t, admin.events)
+	assert.Empty(t, admin.failed)
+	assert.Empty(t, admin.installations)
+	_, err := admin.retry(1)
+	assert.NotNil(t, err)
+
+	// installations are capped like events, forgetting the one seen the longest ago
+	for _, repo := range []string{"user123/repo1", "user123/repo2", "user123/repo3"} {
+		webhookURL := adminTestURL(t, "http://example.com/github/", url.Values{"api_url": {"https://www.pivotaltracker.com/services/v5/projects/123"}})
+		assert.Equal(t, http.StatusOK, post(webhookURL, `{"repository":{"full_name":"`+repo+`"}}`))
+		time.Sleep(time.Millisecond) // seen one after the other
+	}
+	assert.Equal(t, 3, handled)
+	assert.Len(t, admin.events, 2)
+	assert.Len(t, admin.installations, 2)
+	_, ok := admin.installations[adminInstallation{Source: "github", From: "user123/repo1", To: "https://www.pivotaltracker.com/services/v5/projects/123"}]
+	assert.False(t, ok)
+}
+
+var adminTestServer = crypto.Server{Secret: "c1626442-0327-40a6-a830-c5517d6782d2"}
+
+// adminTestURL is a webhook url of `adminTestServer` with `values`
+func adminTestURL(t *testing.T, base string, values url.Values) string {
+	token, nonce, err := crypto.EncryptWithSecretENV(adminTestServer.Secret, "abc")
+	assert.Nil(t, err)
+	values.Set("token", token)
+	values.Set("nonce", nonce)
+	return base + "?" + values.Encode()
+}
+
+func TestAdminReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	reportFile := filepath.Join(dir, "report.json")
+	admin := &Admin{Username: "admin", Password: "s3cret", ReportFile: reportFile}
+	assert.Contains(t, adminPageBody(t, admin), "no reconciler report in "+reportFile)
+
+	assert.Nil(t, saveStateFile(reportFile, reconcileReport{At: time.Now(), Pairs: []pairReport{
+		{IssueURL: "https://github.com/user123/repo456/issues/4", StoryURL: "https://www.pivotaltracker.com/story/show/104", Status: "conflict", Drift: driftBoth, Fields: []string{"title"}},
+	}}))
+	body := adminPageBody(t, admin)
+	assert.Contains(t, body, "https://www.pivotaltracker.com/story/show/104")
+	assert.Contains(t, body, driftBoth)
+}
+
+func TestAdminRevoke(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	installations := &crypto.Installations{Filename: filepath.Join(dir, "installations.json")}
+	s := crypto.Server{Secret: "c1626442-0327-40a6-a830-c5517d6782d2", Installations: installations}
+	r := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("token=x&repo=user123/repo456&target_path=/pivotaltracker/&expires=2999-01-01"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(httptest.NewRecorder(), r)
+	list, err := installations.List()
+	assert.Nil(t, err)
+	assert.Len(t, list, 1)
+
+	admin := &Admin{PathPrefix: "/admin", Username: "admin", Password: "s3cret", Installations: installations}
+	body := adminPageBody(t, admin)
+	assert.Contains(t, body, list[0].ID)
+	assert.Contains(t, body, "2999-01-01T00:00:00Z")
+	assert.Contains(t, body, `value="Revoke"`)
+
+	r = httptest.NewRequest("POST", "http://example.com/admin/revoke", strings.NewReader("id="+list[0].ID))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("admin", "s3cret")
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	body = adminPageBody(t, admin)
+	assert.Contains(t, body, "revoked")
+	assert.NotContains(t, body, `value="Revoke"`)
+}
+
+func adminPageBody(t *testing.T, admin *Admin) string {
+	r := httptest.NewRequest("GET", "http://example.com"+admin.PathPrefix+"/", nil)
+	r.SetBasicAuth(admin.Username, admin.Password)
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
@@ -0,0 +1,339 @@
+package githubtracker
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// backfillAction is one step of a backfill plan; `Key` is remembered in the state file once applied.
+// actions without `apply` are only reported
+type backfillAction struct {
+	Key   string
+	Text  string
+	apply func() error
+}
+
+// Backfill links and syncs the GH issues and PT stories that existed before the webhooks did
+type Backfill struct {
+	walker
+	IncludeClosed bool          // also walk closed issues and accepted stories
+	CreateStories bool          // create stories for issues that have none
+	CreateIssues  bool          // create issues for stories that have none
+	Label         string        // only create counterparts of issues and stories with this label
+	Delay         time.Duration // pause between api writes
+	StateFile     string        // remembers applied actions, so an interrupted run can resume
+}
+
+// NewBackfill reads credentials and options from both webhook urls, see `newWalker`
+func NewBackfill(issueValues, storyValues url.Values) (*Backfill, error) {
+	w, err := newWalker(issueValues, storyValues)
+	if err != nil {
+		return nil, err
+	}
+	return &Backfill{
+		walker:        w,
+		CreateStories: true,
+		CreateIssues:  true,
+		Delay:         time.Second,
+	}, nil
+}
+
+// Run prints the plan, then applies it if `apply` is true
+func (b *Backfill) Run(apply bool) error {
+	done := map[string]bool{}
+	if err := loadStateFile(b.StateFile, &done); err != nil {
+		return errors.Wrapf(err, "load %s", b.StateFile)
+	}
+	actions, err := b.plan()
+	if err != nil {
+		return errors.Wrapf(err, "plan")
+	}
+
+	pending := 0
+	for _, a := range actions {
+		status := "todo"
+		switch {
+		case a.apply == nil:
+			status = "skip"
+		case done[a.Key]:
+			status = "done"
+		default:
+			pending++
+		}
+		fmt.Fprintf(b.Out, "%s  %s\n", status, a.Text)
+	}
+	if !apply {
+		fmt.Fprintf(b.Out, "%d actions to apply; run again with --apply to apply them\n", pending)
+		return nil
+	}
+
+	for _, a := range actions {
+		if a.apply == nil || done[a.Key] {
+			continue
+		}
+		fmt.Fprintf(b.Out, "apply  %s\n", a.Text)
+		if err = b.retry(a.apply); err != nil {
+			return errors.Wrapf(err, "%s", a.Text)
+		}
+		done[a.Key] = true
+		if err = saveStateFile(b.StateFile, done); err != nil {
+			return errors.Wrapf(err, "save %s", b.StateFile)
+		}
+		b.sleep(b.Delay)
+	}
+	fmt.Fprintf(b.Out, "%d actions applied\n", pending)
+	return nil
+}
+
+// plan pairs issues with stories by their links, then by exact title, and creates the missing counterparts
+func (b *Backfill) plan() ([]backfillAction, error) {
+	state := issueStateOpen
+	if b.IncludeClosed {
+		state = "all"
+	}
+	issues, err := b.listIssues(state)
+	if err != nil {
+		return nil, err
+	}
+	stories, err := b.listStories(b.IncludeClosed)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []backfillAction{}
+	issuePaired := map[int]bool{}
+	storyPaired := map[int]bool{}
+	pair := func(i, s int, how string) {
+		issuePaired[i], storyPaired[s] = true, true
+		if b.issueInScope(issues[i]) && b.storyInScope(stories[s]) {
+			actions = append(actions, b.linkActions(issues[i], stories[s], how)...)
+		}
+	}
+
+	storyIndex := map[string]int{}
+	for s, story := range stories {
+		storyIndex[story.ID.String()] = s
+	}
+	for i, issue := range issues {
+		if link := parseStoryLink(issue.Body, b.trackerHTMLURL); link != nil {
+			if s, ok := storyIndex[link.StoryID]; ok && !storyPaired[s] {
+				pair(i, s, "by link")
+			}
+		}
+	}
+	for s, story := range stories {
+		for i, issue := range issues {
+			if !storyPaired[s] && !issuePaired[i] && hasLinkPrefix(story.Description, issue.HTMLURL) {
+				pair(i, s, "by link")
+			}
+		}
+	}
+
+	// linked to something we did not list, e.g. accepted stories or closed issues
+	githubLinkBodyPrefix := regexp.MustCompile(fmt.Sprintf(`^%s\S+/issues/(\d+)`, b.githubHTMLURL))
+	for i, issue := range issues {
+		if !issuePaired[i] && parseStoryLink(issue.Body, b.trackerHTMLURL) != nil {
+			issuePaired[i] = true
+		}
+	}
+	for s, story := range stories {
+		if !storyPaired[s] && githubLinkBodyPrefix.MatchString(story.Description) {
+			storyPaired[s] = true
+		}
+	}
+
+	issuesByTitle := map[string][]int{}
+	titles := []string{}
+	for i, issue := range issues {
+		if title := strings.TrimSpace(issue.Title); !issuePaired[i] {
+			if issuesByTitle[title] == nil {
+				titles = append(titles, title)
+			}
+			issuesByTitle[title] = append(issuesByTitle[title], i)
+		}
+	}
+	storiesByTitle := map[string][]int{}
+	for s, story := range stories {
+		if title := strings.TrimSpace(story.Name); !storyPaired[s] {
+			if issuesByTitle[title] == nil && storiesByTitle[title] == nil {
+				titles = append(titles, title)
+			}
+			storiesByTitle[title] = append(storiesByTitle[title], s)
+		}
+	}
+	for _, title := range titles {
+		is, ss := issuesByTitle[title], storiesByTitle[title]
+		switch {
+		case len(is) > 1 || len(ss) > 1:
+			// can't tell which is which; the webhooks can't either
+			actions = append(actions, backfillAction{Text: fmt.Sprintf("%d issues and %d stories titled %q", len(is), len(ss), title)})
+			for _, i := range is {
+				issuePaired[i] = true
+			}
+			for _, s := range ss {
+				storyPaired[s] = true
+			}
+		case len(is) == 1 && len(ss) == 1:
+			pair(is[0], ss[0], "by title")
+		}
+	}
+
+	for i, issue := range issues {
+		if issuePaired[i] || !b.CreateStories || !b.issueOpts.Fields.createsStories() || !b.issueHasLabel(issue) || !b.issueInScope(issue) {
+			continue
+		}
+		action, err := b.createStoryAction(issue)
+		if err != nil {
+			return nil, errors.Wrapf(err, "issue #%d", issue.Number)
+		}
+		actions = append(actions, action)
+	}
+	for s, story := range stories {
+		if storyPaired[s] || !b.CreateIssues || !b.storyOpts.Fields.createsIssues() || !b.storyHasLabel(story) || !b.storyInScope(story) {
+			continue
+		}
+		action, err := b.createIssueAction(story)
+		if err != nil {
+			return nil, errors.Wrapf(err, "story %s", story.ID.String())
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+func (b *Backfill) issueHasLabel(issue githubSearchResultRow) bool {
+	if b.Label == "" {
+		return true
+	}
+	for _, label := range issue.Labels {
+		if strings.EqualFold(label.Name, b.Label) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Backfill) storyHasLabel(story trackerSearchResultRow) bool {
+	if b.Label == "" {
+		return true
+	}
+	for _, label := range story.Labels {
+		if strings.EqualFold(label.Name, b.Label) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkActions prefixes the issue body and story description with links to each other, when missing
+func (b *Backfill) linkActions(issue githubSearchResultRow, story trackerSearchResultRow, how string) []backfillAction {
+	actions := []backfillAction{}
+	storyURL := b.storyURL(story)
+	if !bodyLinksTo(issue.Body, storyURL) {
+		link := storyLink{URL: storyURL, StoryID: story.ID.String(), Version: storyLinkVersion}
+		if story.ProjectID != 0 {
+			link.ProjectID = fmt.Sprintf("%d", story.ProjectID)
+		}
+		issue := issue
+		actions = append(actions, backfillAction{
+			Key:  fmt.Sprintf("link-issue %d", issue.Number),
+			Text: fmt.Sprintf("link issue #%d %q to story %s (%s)", issue.Number, issue.Title, story.ID.String(), how),
+			apply: func() error {
+				prefix, err := link.render(b.storyOpts.LinkTemplate)
+				if err != nil {
+					return err
+				}
+				body := prefix + "\r\n\r\n" + strings.TrimSpace(stripStoryLink(issue.Body, b.trackerHTMLURL))
+				return b.github.UpdateIssue(&issueDetail{repo: b.repo, Body: body}, &issue)
+			},
+		})
+	}
+	if !hasLinkPrefix(story.Description, issue.HTMLURL) {
+		story := story
+		actions = append(actions, backfillAction{
+			Key:  "link-story " + story.ID.String(),
+			Text: fmt.Sprintf("link story %s %q to issue #%d (%s)", story.ID.String(), story.Name, issue.Number, how),
+			apply: func() error {
+				stripped := webhookStory{Body: &story.Description, githubHTMLURL: b.githubHTMLURL}.StrippedBody()
+				return b.tracker.UpdateStory(&storyDetail{Body: issue.HTMLURL + "\r\n\r\n" + stripped}, &story)
+			},
+		})
+	}
+	return actions
+}
+
+// createStoryAction creates the story like the webhook would have; closed issues become accepted chores
+func (b *Backfill) createStoryAction(issue githubSearchResultRow) (backfillAction, error) {
+	story, err := ptStoryFromWebhookIssue(&webhookIssue{
+		isOpened:       true,
+		isCreated:      true,
+		Title:          issue.Title,
+		Body:           issue.Body,
+		URL:            issue.HTMLURL,
+		trackerHTMLURL: b.trackerHTMLURL,
+		opts:           b.issueOpts,
+	})
+	if err != nil {
+		return backfillAction{}, err
+	}
+	if issue.State == issueStateClosed {
+		story.StoryType = storyTypeChore
+		story.CurrentState = storyStateAccepted
+		if b.tracker.RequiresChoreEstimate() {
+			story.Estimate = new(int)
+		}
+	}
+	return backfillAction{
+		Key:  fmt.Sprintf("create-story %d", issue.Number),
+		Text: fmt.Sprintf("create story for issue #%d %q", issue.Number, issue.Title),
+		apply: func() error {
+			return b.tracker.CreateStory(story)
+		},
+	}, nil
+}
+
+// createIssueAction creates the issue like the webhook would have; github ignores `state` on create,
+// so issues of accepted stories are closed afterwards
+func (b *Backfill) createIssueAction(story trackerSearchResultRow) (backfillAction, error) {
+	ws := webhookStory{
+		URL:           b.storyURL(story),
+		Title:         story.Name,
+		Body:          &story.Description,
+		StoryID:       story.ID.String(),
+		githubHTMLURL: b.githubHTMLURL,
+		opts:          b.storyOpts,
+		isCreated:     true,
+	}
+	if story.ProjectID != 0 {
+		ws.projectID = fmt.Sprintf("%d", story.ProjectID)
+	}
+	if story.CurrentState == storyStateAccepted {
+		ws.CurrentState = story.CurrentState
+	}
+	issue, err := ghIssueFromWebhookStory(ws, b.repo, b.githubHTMLURL)
+	if err != nil {
+		return backfillAction{}, err
+	}
+	state := issue.State
+	issue.State = ""
+	return backfillAction{
+		Key:  "create-issue " + story.ID.String(),
+		Text: fmt.Sprintf("create issue for story %s %q", story.ID.String(), story.Name),
+		apply: func() error {
+			if err := b.github.CreateIssue(issue); err != nil || state != issueStateClosed {
+				return err
+			}
+			found, err := b.github.FindIssueByTrackerURL(b.repo, ws.URL)
+			if err != nil || found == nil {
+				fmt.Fprintf(b.Out, "warn  could not close the new issue of story %s yet: %v\n", ws.StoryID, err)
+				return nil
+			}
+			return b.github.UpdateIssue(&issueDetail{repo: b.repo, State: state}, found)
+		},
+	}, nil
+}
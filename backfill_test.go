@@ -0,0 +1,180 @@
+package githubtracker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBackfill(github *logGithubClient, tracker *logTrackerClient, stateFile string) (*Backfill, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &Backfill{
+		walker:        newTestWalker(github, tracker, out),
+		CreateStories: true,
+		CreateIssues:  true,
+		StateFile:     stateFile,
+	}, out
+}
+
+func newTestWalker(github *logGithubClient, tracker *logTrackerClient, out *bytes.Buffer) walker {
+	return walker{
+		Out:            out,
+		github:         github,
+		tracker:        tracker,
+		repo:           "user123/repo456",
+		githubHTMLURL:  "https://github.com",
+		trackerHTMLURL: "https://www.pivotaltracker.com",
+		sleep:          func(time.Duration) {},
+	}
+}
+
+func backfillFixtures() (*logGithubClient, *logTrackerClient) {
+	github := &logGithubClient{ExpectedIssues: []githubSearchResultRow{
+		{Number: 1, Title: "Linked both ways", Body: "https://www.pivotaltracker.com/story/show/101\r\n\r\nhi", HTMLURL: "https://github.com/user123/repo456/issues/1", State: "open"},
+		{Number: 2, Title: "Same title", Body: "from github", HTMLURL: "https://github.com/user123/repo456/issues/2", State: "open"},
+		{Number: 3, Title: "Only on github", Body: "create me", HTMLURL: "https://github.com/user123/repo456/issues/3", State: "open", Labels: []webhookLabel{{Name: "sync"}}},
+		{Number: 4, Title: "Duplicate", HTMLURL: "https://github.com/user123/repo456/issues/4", State: "open"},
+		{Number: 5, Title: "Duplicate", HTMLURL: "https://github.com/user123/repo456/issues/5", State: "open"},
+		{Number: 6, Title: "A pull request", HTMLURL: "https://github.com/user123/repo456/pull/6", State: "open", PullRequest: &struct{}{}},
+		{Number: 7, Title: "Linked elsewhere", Body: "https://www.pivotaltracker.com/story/show/999\r\n\r\nhi", HTMLURL: "https://github.com/user123/repo456/issues/7", State: "open"},
+	}}
+	tracker := &logTrackerClient{ExpectedStories: []trackerSearchResultRow{
+		{ID: alwaysString{"101"}, Name: "Linked both ways", Description: "https://github.com/user123/repo456/issues/1\r\n\r\nhi", StoryType: "feature", CurrentState: "started"},
+		{ID: alwaysString{"102"}, Name: "Same title", Description: "from tracker", StoryType: "feature", CurrentState: "unstarted", ProjectID: 2120247},
+		{ID: alwaysString{"103"}, Name: "Only on tracker", Description: "create me too", StoryType: "bug", CurrentState: "unstarted"},
+		{ID: alwaysString{"104"}, Name: "A release", StoryType: "release", CurrentState: "unstarted"},
+		{ID: alwaysString{"105"}, Name: "Accepted", StoryType: "feature", CurrentState: "accepted"},
+		{ID: alwaysString{"106"}, Name: "Linked elsewhere too", Description: "https://github.com/user123/repo456/issues/99", StoryType: "feature", CurrentState: "unstarted"},
+	}}
+	return github, tracker
+}
+
+func TestBackfillPlan(t *testing.T) {
+	github, tracker := backfillFixtures()
+	b, out := newTestBackfill(github, tracker, "")
+	assert.Nil(t, b.Run(false))
+	assert.Equal(t, `todo  link issue #2 "Same title" to story 102 (by title)
+todo  link story 102 "Same title" to issue #2 (by title)
+skip  2 issues and 0 stories titled "Duplicate"
+todo  create story for issue #3 "Only on github"
+todo  create issue for story 103 "Only on tracker"
+4 actions to apply; run again with --apply to apply them
+`, out.String())
+	assert.Equal(t, []logAction{
+		{Method: "ListIssues", GivenID: "1", GivenState: "open"},
+		{Method: "ListIssues", GivenID: "2", GivenState: "open"},
+	}, github.History)
+	assert.Equal(t, []logTrackerAction{
+		{Method: "ListStories", GivenID: "0"},
+		{Method: "ListStories", GivenID: "6"},
+	}, tracker.History)
+
+	github, tracker = backfillFixtures()
+	b, out = newTestBackfill(github, tracker, "")
+	b.Label = "sync"
+	b.IncludeClosed = true
+	assert.Nil(t, b.Run(false))
+	assert.Equal(t, `todo  link issue #2 "Same title" to story 102 (by title)
+todo  link story 102 "Same title" to issue #2 (by title)
+skip  2 issues and 0 stories titled "Duplicate"
+todo  create story for issue #3 "Only on github"
+3 actions to apply; run again with --apply to apply them
+`, out.String())
+	assert.Equal(t, "all", github.History[0].GivenState)
+}
+
+func TestBackfillApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backfill")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	github, tracker := backfillFixtures()
+	b, _ := newTestBackfill(github, tracker, stateFile)
+	assert.Nil(t, b.Run(true))
+	assert.Equal(t, []logAction{
+		{Method: "ListIssues", GivenID: "1", GivenState: "open"},
+		{Method: "ListIssues", GivenID: "2", GivenState: "open"},
+		{Method: "UpdateIssue", GivenID: "2", GivenBody: "https://www.pivotaltracker.com/story/show/102\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/102 project:2120247 version:1 -->\r\n\r\nfrom github"},
+		{Method: "CreateIssue", GivenTitle: "Only on tracker", GivenBody: "https://www.pivotaltracker.com/story/show/103\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/103 version:1 -->\r\n\r\ncreate me too"},
+	}, github.History)
+	assert.Equal(t, []logTrackerAction{
+		{Method: "ListStories", GivenID: "0"},
+		{Method: "ListStories", GivenID: "6"},
+		{Method: "UpdateStory", GivenID: "102", GivenBody: "https://github.com/user123/repo456/issues/2\r\n\r\nfrom tracker"},
+		{Method: "CreateIssue", GivenTitle: "Only on github", GivenBody: "https://github.com/user123/repo456/issues/3\r\n\r\ncreate me", GivenSearchFilters: []string{`name:"Only on github"`}},
+	}, tracker.History)
+
+	// resuming skips what was applied
+	github, tracker = backfillFixtures()
+	b, out := newTestBackfill(github, tracker, stateFile)
+	assert.Nil(t, b.Run(true))
+	assert.Contains(t, out.String(), "done  create issue for story 103 \"Only on tracker\"\n")
+	assert.Contains(t, out.String(), "0 actions applied\n")
+	assert.Len(t, github.History, 2)
+	assert.Len(t, tracker.History, 2)
+}
+
+func TestBackfillRetry(t *testing.T) {
+	b, _ := newTestBackfill(&logGithubClient{}, &logTrackerClient{}, "")
+	waits := []time.Duration{}
+	b.sleep = func(d time.Duration) { waits = append(waits, d) }
+
+	calls := 0
+	err := b.retry(func() error {
+		calls++
+		if calls < 3 {
+			return &rateLimitError{Reset: time.Now()}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Len(t, waits, 2)
+}
+
+func TestRateLimitFrom(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	testCases := []struct {
+		givenStatus   int
+		givenHeader   http.Header
+		expectedReset *time.Time
+	}{
+		{
+			givenStatus: http.StatusOK,
+			givenHeader: http.Header{"X-Ratelimit-Remaining": []string{"0"}},
+		},
+		{
+			givenStatus: http.StatusForbidden,
+		},
+		{
+			givenStatus:   http.StatusForbidden,
+			givenHeader:   http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{strconv.FormatInt(reset.Unix(), 10)}},
+			expectedReset: &reset,
+		},
+		{
+			givenStatus:   http.StatusTooManyRequests,
+			givenHeader:   http.Header{"Retry-After": []string{"3600"}},
+			expectedReset: &reset,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := rateLimitFrom(&http.Response{StatusCode: tc.givenStatus, Header: tc.givenHeader})
+			if tc.expectedReset == nil {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.IsType(t, &rateLimitError{}, err) {
+				assert.WithinDuration(t, *tc.expectedReset, err.(*rateLimitError).Reset, 2*time.Second)
+			}
+		})
+	}
+}
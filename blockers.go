@@ -0,0 +1,115 @@
+package githubtracker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// blockersSection mirrors pivotal tracker story blockers; checked items are resolved
+var blockersSection = checklistSection{name: "blockers", idLabel: "blocker"}
+
+const blockedByPrefix = "Blocked by "
+
+// e.g. "blocked by #12" written anywhere in the issue body
+var blockedByLine = regexp.MustCompile(`(?im)^[ \t]*(?:[-*] (?:\[[ xX]\] )?)?blocked by[ \t]+([^<\r\n]+?)[ \t]*\r?$`)
+
+// e.g. "#12" for github issues, "#153984041" for tracker stories
+var hashRef = regexp.MustCompile(`#(\d+)\b`)
+
+// payload to be sent to pivotaltracker.com story blockers
+type storyBlocker struct {
+	ID          string `json:"-"`
+	Description string `json:"description,omitempty"`
+	Resolved    bool   `json:"resolved"`
+}
+
+func storyBlockerFromChecklistItem(item checklistItem) *storyBlocker {
+	return &storyBlocker{
+		ID:          item.ID,
+		Description: strings.TrimSpace(trimPrefixFold(item.Text, blockedByPrefix)),
+		Resolved:    item.Checked,
+	}
+}
+
+// blockedByLines returns "blocked by" lines in the human-written part of `body`, as checklist text
+func blockedByLines(body string) []string {
+	lines := []string{}
+	for _, res := range blockedByLine.FindAllStringSubmatch(stripChecklistSections(body), -1) {
+		lines = append(lines, blockedByPrefix+res[1])
+	}
+	return lines
+}
+
+// removeBlockedByLine removes human-written "blocked by" lines that are now in the blockers section
+func removeBlockedByLine(body, text string) string {
+	lines := []string{}
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if res := blockedByLine.FindStringSubmatch(line); res != nil && strings.EqualFold(blockedByPrefix+res[1], text) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "")
+}
+
+// replaceHashRefs rewrites every `#123` in `s` with the result of `fn`
+func replaceHashRefs(s string, fn func(number string) (string, error)) (string, error) {
+	var lastErr error
+	result := hashRef.ReplaceAllStringFunc(s, func(ref string) string {
+		replacement, err := fn(ref[1:])
+		if err != nil {
+			lastErr = err
+			return ref
+		}
+		return replacement
+	})
+	return result, lastErr
+}
+
+func trimPrefixFold(s, prefix string) string {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):]
+	}
+	return s
+}
+
+// ptBlockerDescription rewrites github issue references into their linked story, e.g. "#12" into "#153984041"
+func ptBlockerDescription(client trackerAPIClient, issueURL string, description string) (string, error) {
+	prefix := issueURL[:strings.LastIndex(issueURL, "/")+1]
+	return replaceHashRefs(description, func(number string) (string, error) {
+		found, err := client.FindStoryByIssueURL(prefix + number)
+		if isMultipleMatches(err) {
+			return prefix + number, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if found == nil {
+			return prefix + number, nil
+		}
+		return "#" + found.ID.String(), nil
+	})
+}
+
+// ghBlockedByText rewrites story references into their linked issue, e.g. "#153984041" into "Blocked by #12"
+func ghBlockedByText(client githubAPIClient, repo, githubHTMLURL, trackerHTMLURL, description string) (string, error) {
+	text, err := replaceHashRefs(description, func(number string) (string, error) {
+		found, err := client.FindIssueByTrackerURL(repo, strings.TrimRight(trackerHTMLURL, "/")+"/story/show/"+number)
+		if isMultipleMatches(err) {
+			return "#" + number, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if found == nil {
+			return "#" + number, nil
+		}
+		return "#" + fmt.Sprintf("%d", found.Number), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	issueURL := regexp.MustCompile(regexp.QuoteMeta(strings.TrimRight(githubHTMLURL, "/")+"/"+repo+"/issues/") + `(\d+)\b`)
+	return blockedByPrefix + issueURL.ReplaceAllString(text, "#$1"), nil
+}
@@ -0,0 +1,77 @@
+package githubtracker
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockedByLines(t *testing.T) {
+	body := "hello\r\nBlocked by #3\r\n- [ ] blocked by design review\r\n\r\n" + blockersSection.begin() + "\r\n- [ ] Blocked by #2 <!-- blocker:1 -->\r\n" + blockersSection.end()
+
+	assert.Equal(t, []string{"Blocked by #3", "Blocked by design review"}, blockedByLines(body))
+	assert.Equal(t, "hello\r\n- [ ] blocked by design review\r\n\r\n"+blockersSection.begin()+"\r\n- [ ] Blocked by #2 <!-- blocker:1 -->\r\n"+blockersSection.end(), removeBlockedByLine(body, "Blocked by #3"))
+}
+
+func TestPtBlockerDescription(t *testing.T) {
+	testCases := []struct {
+		givenDescription    string
+		givenFoundStory     *trackerSearchResultRow
+		expectedDescription string
+	}{
+		{
+			givenDescription:    "#3",
+			givenFoundStory:     &trackerSearchResultRow{ID: alwaysString{Value: "153984041"}},
+			expectedDescription: "#153984041",
+		},
+		{
+			givenDescription:    "#3 and #4",
+			expectedDescription: "https://github.com/user123/repo456/issues/3 and https://github.com/user123/repo456/issues/4",
+		},
+		{
+			givenDescription:    "design review",
+			expectedDescription: "design review",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := logTrackerClient{ExpectedFoundStory: tc.givenFoundStory}
+			description, err := ptBlockerDescription(&client, "https://github.com/user123/repo456/issues/1", tc.givenDescription)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedDescription, description)
+		})
+	}
+}
+
+func TestGhBlockedByText(t *testing.T) {
+	testCases := []struct {
+		givenDescription string
+		givenFoundIssue  *githubSearchResultRow
+		expectedText     string
+	}{
+		{
+			givenDescription: "#153984041",
+			givenFoundIssue:  &githubSearchResultRow{Number: 3},
+			expectedText:     "Blocked by #3",
+		},
+		{
+			givenDescription: "#153984041",
+			expectedText:     "Blocked by #153984041",
+		},
+		{
+			givenDescription: "https://github.com/user123/repo456/issues/4",
+			expectedText:     "Blocked by #4",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			client := logGithubClient{ExpectedFoundIssue: tc.givenFoundIssue}
+			text, err := ghBlockedByText(&client, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com", tc.givenDescription)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedText, text)
+		})
+	}
+}
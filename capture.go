@@ -0,0 +1,149 @@
+package githubtracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// captureDirs lays out captured payloads like testdata/
+var captureDirs = map[string]string{
+	"github":         "github",
+	"pivotaltracker": "tracker",
+}
+
+// redacted headers and payload keys; payload keys match if they contain any of these
+var (
+	redactHeaders = []string{"Authorization", "Cookie", "X-Hub-Signature", "X-Hub-Signature-256", "X-TrackerToken"}
+	redactKeys    = []string{"email", "token", "secret", "password"}
+)
+
+// Capture saves every payload that `Handler` receives into `Dir`, redacted, e.g.
+// `Dir/github/issues.edited.20060102T150405.000000000.json` with its headers next to it in
+// `.headers.json`, so a payload that misbehaved can be replayed and turned into a fixture
+type Capture struct {
+	Dir     string
+	Source  string // github or pivotaltracker
+	Handler http.Handler
+}
+
+func (c Capture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filename, err := c.save(r.Header, data, time.Now()); err != nil {
+		log.Printf("capture: %s", err.Error()) // never fail the webhook because of this
+	} else {
+		log.Printf("captured %s", filename)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	c.Handler.ServeHTTP(w, r)
+}
+
+func (c Capture) save(header http.Header, data []byte, now time.Time) (string, error) {
+	body, err := redactPayload(data)
+	if err != nil {
+		return "", err
+	}
+	headers, err := json.MarshalIndent(redactHeader(header), "", "  ")
+	if err != nil {
+		return "", errors.Wrapf(err, "json marshal")
+	}
+
+	dir := filepath.Join(c.Dir, captureDirs[c.Source])
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := capturedName(c.Source, header, data) + "." + now.UTC().Format("20060102T150405.000000000")
+	filename := filepath.Join(dir, name+".json")
+	if err = ioutil.WriteFile(filename, body, 0644); err != nil {
+		return "", err
+	}
+	return filename, ioutil.WriteFile(headersFilename(filename), append(headers, '\n'), 0644)
+}
+
+// capturedName follows the testdata naming, e.g. `issues.edited` or `story_update_activity`
+func capturedName(source string, header http.Header, data []byte) string {
+	var payload struct {
+		Action string `json:"action"`
+		Kind   string `json:"kind"`
+	}
+	json.Unmarshal(data, &payload)
+	if source == "github" {
+		name := valueOr(header.Get("X-GitHub-Event"), "github")
+		if payload.Action != "" {
+			name = name + "." + payload.Action
+		}
+		return name
+	}
+	return valueOr(payload.Kind, "activity")
+}
+
+func headersFilename(filename string) string {
+	return strings.TrimSuffix(filename, ".json") + ".headers.json"
+}
+
+func redactHeader(header http.Header) http.Header {
+	result := http.Header{}
+	for k, v := range header {
+		result[k] = v
+	}
+	for _, k := range redactHeaders {
+		if result.Get(k) != "" {
+			result.Set(k, "REDACTED")
+		}
+	}
+	return result
+}
+
+// redactPayload returns the indented JSON `data`, with the values of `redactKeys` replaced
+func redactPayload(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal")
+	}
+	result, err := json.MarshalIndent(redactValue(v), "", "  ")
+	if err != nil {
+		return nil, errors.Wrapf(err, "json marshal")
+	}
+	return append(result, '\n'), nil
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if value != nil && containsAny(strings.ToLower(k), redactKeys) {
+				v[k] = "REDACTED"
+				continue
+			}
+			v[k] = redactValue(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package githubtracker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	checklistCreate = "create"
+	checklistUpdate = "update"
+	checklistDelete = "delete"
+)
+
+// checklistSection is a machine-managed github task list in the issue body,
+// mirroring a list of pivotal tracker resources, e.g. tasks
+type checklistSection struct {
+	name    string // e.g. "tasks"
+	idLabel string // e.g. "task"
+}
+
+type checklistItem struct {
+	ID       string
+	Text     string
+	Checked  bool
+	Position int
+}
+
+type checklistChange struct {
+	Action string
+	Item   checklistItem
+
+	// which fields were given by tracker; only relevant for `checklistUpdate`
+	hasText     bool
+	hasChecked  bool
+	hasPosition bool
+}
+
+var checklistLine = regexp.MustCompile(`^\s*[-*] \[([ xX])\] (.*?)\s*(?:<!-- ([a-z]+):(\d+) -->)?\s*$`)
+
+func (s checklistSection) begin() string {
+	return "<!-- tracker " + s.name + ": synced with pivotal tracker, edit with care -->"
+}
+
+func (s checklistSection) end() string {
+	return "<!-- /tracker " + s.name + " -->"
+}
+
+func (s checklistSection) regexp() *regexp.Regexp {
+	return regexp.MustCompile(`(?s)\s*` + regexp.QuoteMeta(s.begin()) + `(.*?)` + regexp.QuoteMeta(s.end()))
+}
+
+// strip returns `body` without this section
+func (s checklistSection) strip(body string) string {
+	return s.regexp().ReplaceAllString(body, "")
+}
+
+// parse returns nil if `body` does not have this section
+func (s checklistSection) parse(body string) []checklistItem {
+	res := s.regexp().FindStringSubmatch(body)
+	if res == nil {
+		return nil
+	}
+	items := []checklistItem{}
+	for _, line := range strings.Split(res[1], "\n") {
+		m := checklistLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		item := checklistItem{
+			Text:     m[2],
+			Checked:  m[1] != " ",
+			Position: len(items) + 1,
+		}
+		if m[3] == s.idLabel {
+			item.ID = m[4]
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (s checklistSection) render(items []checklistItem) string {
+	lines := []string{s.begin()}
+	for _, item := range items {
+		check := " "
+		if item.Checked {
+			check = "x"
+		}
+		line := fmt.Sprintf("- [%s] %s", check, item.Text)
+		if item.ID != "" {
+			line = line + " <!-- " + s.idLabel + ":" + item.ID + " -->"
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, s.end())
+	return strings.Join(lines, "\r\n")
+}
+
+// replace puts `items` in place of the existing section or at the end of `body`,
+// removing the section if there are no items
+func (s checklistSection) replace(body string, items []checklistItem) string {
+	if len(items) == 0 {
+		return strings.TrimRight(s.strip(body), "\r\n\t ")
+	}
+	if re := s.regexp(); re.MatchString(body) {
+		return re.ReplaceAllLiteralString(body, "\r\n\r\n"+s.render(items))
+	}
+	return strings.TrimRight(body, "\r\n\t ") + "\r\n\r\n" + s.render(items)
+}
+
+// merge returns `body` with the section found in `current`, after applying `changes`
+func (s checklistSection) merge(body, current string, changes []checklistChange) string {
+	items := s.parse(current)
+	for _, c := range changes {
+		items = applyChecklistChange(items, c)
+	}
+	if items == nil {
+		return body
+	}
+	return s.replace(body, items)
+}
+
+// stripChecklistSections returns the human-written part of `body`
+func stripChecklistSections(body string) string {
+	for _, s := range []checklistSection{tasksSection, blockersSection, epicMembersSection} {
+		body = s.strip(body)
+	}
+	return body
+}
+
+// diffChecklist returns the changes that turn the `was` checklist into `now`
+func diffChecklist(was, now []checklistItem) []checklistChange {
+	wasByID := map[string]checklistItem{}
+	wasUnsynced := map[string]bool{}
+	for _, item := range was {
+		if item.ID == "" {
+			wasUnsynced[item.Text] = true
+			continue
+		}
+		wasByID[item.ID] = item
+	}
+
+	changes := []checklistChange{}
+	nowIDs := map[string]bool{}
+	for _, item := range now {
+		if item.ID == "" {
+			changes = append(changes, checklistChange{Action: checklistCreate, Item: item})
+			continue
+		}
+		nowIDs[item.ID] = true
+		old, ok := wasByID[item.ID]
+		if !ok && wasUnsynced[item.Text] {
+			continue // tracker just gave this item an id
+		}
+		if ok && old == item {
+			continue
+		}
+		changes = append(changes, checklistChange{Action: checklistUpdate, Item: item})
+	}
+	for _, item := range was {
+		if item.ID != "" && !nowIDs[item.ID] {
+			changes = append(changes, checklistChange{Action: checklistDelete, Item: item})
+		}
+	}
+	return changes
+}
+
+// applyChecklistChange returns `items` after applying a change made in pivotal tracker
+func applyChecklistChange(items []checklistItem, c checklistChange) []checklistItem {
+	index := -1
+	for i, item := range items {
+		if item.ID == c.Item.ID {
+			index = i
+			break
+		}
+	}
+
+	switch c.Action {
+	case checklistCreate:
+		if index >= 0 {
+			return items
+		}
+		for i, item := range items {
+			if item.ID == "" && item.Text == c.Item.Text {
+				items[i].ID = c.Item.ID // created from github
+				return items
+			}
+		}
+		return insertChecklistItem(items, c.Item)
+
+	case checklistUpdate:
+		if index < 0 {
+			return items
+		}
+		item := items[index]
+		if c.hasText {
+			item.Text = c.Item.Text
+		}
+		if c.hasChecked {
+			item.Checked = c.Item.Checked
+		}
+		if c.hasPosition {
+			item.Position = c.Item.Position
+			return insertChecklistItem(append(items[:index:index], items[index+1:]...), item)
+		}
+		items[index] = item
+		return items
+
+	case checklistDelete:
+		if index < 0 {
+			return items
+		}
+		return append(items[:index:index], items[index+1:]...)
+	}
+	return items
+}
+
+// insertChecklistItem puts `item` at its 1-based position, or the end of the list
+func insertChecklistItem(items []checklistItem, item checklistItem) []checklistItem {
+	i := item.Position - 1
+	if i < 0 || i > len(items) {
+		i = len(items)
+	}
+	result := append([]checklistItem{}, items[:i]...)
+	result = append(result, item)
+	return append(result, items[i:]...)
+}
@@ -0,0 +1,104 @@
+package githubtracker
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecklistSection(t *testing.T) {
+	body := "hello\r\n\r\n" + tasksSection.begin() + "\r\n- [ ] one <!-- task:1 -->\r\n- [x] two <!-- task:2 -->\r\n- [ ] three\r\n" + tasksSection.end()
+
+	items := tasksSection.parse(body)
+	assert.Equal(t, []checklistItem{
+		{ID: "1", Text: "one", Position: 1},
+		{ID: "2", Text: "two", Checked: true, Position: 2},
+		{Text: "three", Position: 3},
+	}, items)
+	assert.Equal(t, "hello", tasksSection.strip(body))
+	assert.Equal(t, body, tasksSection.replace("hello\r\n", items))
+	assert.Equal(t, "hello", tasksSection.replace(body, nil))
+	assert.Nil(t, tasksSection.parse("hello\r\n\r\n- [ ] not managed"))
+}
+
+func TestDiffChecklist(t *testing.T) {
+	testCases := []struct {
+		givenWas, givenNow []checklistItem
+		expectedChanges    []checklistChange
+	}{
+		{
+			givenWas:        nil,
+			givenNow:        nil,
+			expectedChanges: []checklistChange{},
+		},
+		{
+			givenWas: []checklistItem{{ID: "1", Text: "one", Position: 1}},
+			givenNow: []checklistItem{{ID: "1", Text: "one", Checked: true, Position: 1}, {Text: "two", Position: 2}},
+			expectedChanges: []checklistChange{
+				{Action: checklistUpdate, Item: checklistItem{ID: "1", Text: "one", Checked: true, Position: 1}},
+				{Action: checklistCreate, Item: checklistItem{Text: "two", Position: 2}},
+			},
+		},
+		{
+			givenWas: []checklistItem{{ID: "1", Text: "one", Position: 1}, {ID: "2", Text: "two", Position: 2}},
+			givenNow: []checklistItem{{ID: "2", Text: "two", Position: 1}},
+			expectedChanges: []checklistChange{
+				{Action: checklistUpdate, Item: checklistItem{ID: "2", Text: "two", Position: 1}},
+				{Action: checklistDelete, Item: checklistItem{ID: "1", Text: "one", Position: 1}},
+			},
+		},
+		{
+			// tracker assigning id to an item created from github is not a change
+			givenWas:        []checklistItem{{Text: "one", Position: 1}},
+			givenNow:        []checklistItem{{ID: "1", Text: "one", Position: 1}},
+			expectedChanges: []checklistChange{},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tc.expectedChanges, diffChecklist(tc.givenWas, tc.givenNow))
+		})
+	}
+}
+
+func TestApplyChecklistChange(t *testing.T) {
+	testCases := []struct {
+		givenItems    []checklistItem
+		givenChange   checklistChange
+		expectedItems []checklistItem
+	}{
+		{
+			givenItems:    nil,
+			givenChange:   checklistChange{Action: checklistCreate, Item: checklistItem{ID: "1", Text: "one", Position: 1}},
+			expectedItems: []checklistItem{{ID: "1", Text: "one", Position: 1}},
+		},
+		{
+			givenItems:    []checklistItem{{Text: "one"}},
+			givenChange:   checklistChange{Action: checklistCreate, Item: checklistItem{ID: "1", Text: "one", Position: 1}},
+			expectedItems: []checklistItem{{ID: "1", Text: "one"}},
+		},
+		{
+			givenItems:    []checklistItem{{ID: "1", Text: "one"}},
+			givenChange:   checklistChange{Action: checklistUpdate, Item: checklistItem{ID: "1", Checked: true}, hasChecked: true},
+			expectedItems: []checklistItem{{ID: "1", Text: "one", Checked: true}},
+		},
+		{
+			givenItems:    []checklistItem{{ID: "1", Text: "one"}, {ID: "2", Text: "two"}},
+			givenChange:   checklistChange{Action: checklistUpdate, Item: checklistItem{ID: "2", Position: 1}, hasPosition: true},
+			expectedItems: []checklistItem{{ID: "2", Text: "two", Position: 1}, {ID: "1", Text: "one"}},
+		},
+		{
+			givenItems:    []checklistItem{{ID: "1", Text: "one"}, {ID: "2", Text: "two"}},
+			givenChange:   checklistChange{Action: checklistDelete, Item: checklistItem{ID: "1"}},
+			expectedItems: []checklistItem{{ID: "2", Text: "two"}},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tc.expectedItems, applyChecklistChange(tc.givenItems, tc.givenChange))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/choonkeat/githubtracker"
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/pkg/errors"
+)
+
+// doctor checks the settings before they are deployed, and exits 1 if any is wrong
+func doctor(args []string) {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	settings := newServerSettings(flags)
+	port := setting(flags, "PORT", "", "port to listen on")
+	captureDir := setting(flags, "CAPTURE_DIR", "", "saves every webhook payload there")
+	reviewFile := setting(flags, "REVIEW_FILE", "", "review queue of the server")
+	reconcileReport := setting(flags, "RECONCILE_REPORT", "", "report of the reconciler")
+	githubWebhookURL, trackerWebhookURL := webhookURLSettings(flags)
+	offline := flags.Bool("offline", false, "don't call GH or PT, e.g. to check the tokens")
+	flags.Parse(args)
+
+	failed := false
+	check := func(name string, err error, skipped bool) {
+		switch {
+		case skipped:
+			fmt.Printf("skip  %s: not set\n", name)
+		case err != nil:
+			fmt.Printf("FAIL  %s: %s\n", name, err.Error())
+			failed = true
+		default:
+			fmt.Printf("ok    %s\n", name)
+		}
+	}
+
+	_, _, err := crypto.EncryptWithSecretENV(*settings.secret, "doctor")
+	check("SECRET", errors.Wrapf(err, "expected a uuid, e.g. c1626442-0327-40a6-a830-c5517d6782d2"), false)
+	if *port == "" {
+		check("PORT", errors.New("serve would listen on a random port"), false)
+	} else {
+		check("PORT", nil, false)
+	}
+	check("CAPTURE_DIR", writable(filepath.Join(*captureDir, "doctor")), *captureDir == "")
+	check("REVIEW_FILE", jsonFile(*reviewFile), *reviewFile == "")
+	check("RECONCILE_REPORT", jsonFile(*reconcileReport), *reconcileReport == "")
+	s := settings.cryptoServer()
+	if s.Installations != nil {
+		_, err = s.Installations.List()
+		if err == nil {
+			err = writable(s.Installations.Filename)
+		}
+	}
+	check("INSTALLATIONS_FILE", err, s.Installations == nil)
+	if !*offline {
+		check("GITHUB_API_URL", reachable(s.GhAPIURL), false)
+	}
+	check("GITHUB_WEBHOOK_URL", webhookURL(s, *githubWebhookURL, *offline), *githubWebhookURL == "")
+	check("TRACKER_WEBHOOK_URL", webhookURL(s, *trackerWebhookURL, *offline), *trackerWebhookURL == "")
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// writable tells if `filename` can be written, without touching it
+func writable(filename string) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".doctor")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// jsonFile tells if `filename` is json, or doesn't exist yet, and can be written
+func jsonFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err == nil {
+		var v interface{}
+		if err = json.Unmarshal(data, &v); err != nil {
+			return errors.Wrapf(err, "%s", filename)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return writable(filename)
+}
+
+func reachable(apiURL string) error {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(apiURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// webhookURL tells if `webhookURL` decrypts, is active and, unless `offline`, its token works
+func webhookURL(s crypto.Server, webhookURL string, offline bool) error {
+	inspection, err := crypto.Inspect(s.Secret, webhookURL, s.Installations)
+	if err != nil {
+		return err
+	}
+	if inspection.Status != "active" {
+		return errors.Errorf("installation %s is %s", inspection.Installation, inspection.Status)
+	}
+	if offline {
+		return nil
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	values, err := crypto.DecryptValues(s.Secret, u.Query())
+	if err != nil {
+		return err
+	}
+	return githubtracker.CredentialsValidator{}.Validate(u.Path, values)
+}
@@ -1,30 +1,140 @@
+// server serves the webhooks, and is the tool to operate them, e.g.
+//
+//	PORT=3000 SECRET=... server
+//	server -config githubtracker.json serve -port 3000
+//	server -config githubtracker.json gen-url -source github -base-url https://example.com token=... api_url=...
+//	server -config githubtracker.json inspect-url 'https://example.com/github/?...'
+//	server -config githubtracker.json backfill -apply
+//	server -config githubtracker.json reconcile -every 1h
+//	server -config githubtracker.json replay -webhook-url 'https://example.com/github/?...' captured/github/*.json
+//	server -config githubtracker.json doctor
+//
+// settings, e.g. SECRET, are read from their flag (-secret), else their env var, else the json
+// -config file (CONFIG_FILE), e.g. {"SECRET": "...", "INSTALLATIONS_FILE": "installations.json"}.
+// without a command it serves, as it did before it had any
 package main
 
 import (
-	"net/http"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
 	"os"
-	"path"
+	"strings"
 
-	"github.com/choonkeat/githubtracker"
 	"github.com/choonkeat/githubtracker/crypto"
 )
 
+var commands = map[string]func(args []string){
+	"serve":         serve,
+	"gen-url":       genURL,
+	"inspect-url":   inspectURL,
+	"installations": installations,
+	"backfill":      backfill,
+	"reconcile":     reconcile,
+	"replay":        replay,
+	"review":        review,
+	"doctor":        doctor,
+}
+
+// config is the -config file; its keys are the env vars of the settings
+var config = map[string]string{}
+
 func main() {
-	cryptoServer := crypto.Server{
-		Secret:     os.Getenv("SECRET"),
-		PathPrefix: path.Join("/", os.Getenv("UP_STAGE")),
-		GhAPIURL:   "https://api.github.com",
-		GhHTMLURL:  "https://github.com",
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "json file of settings, keyed by their env var (CONFIG_FILE)")
+	flag.Usage = usage
+	flag.Parse()
+	if *configFile != "" {
+		data, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+		if err = json.Unmarshal(data, &config); err != nil {
+			log.Fatalf("%s: %s", *configFile, err.Error())
+		}
+	}
+
+	if flag.NArg() == 0 {
+		serve(nil)
+		return
+	}
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+	}
+	command(flag.Args()[1:])
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: server [-config file] serve|gen-url|inspect-url|installations|backfill|reconcile|replay|review|doctor [flags] [args]")
+	os.Exit(2)
+}
+
+// setting adds flag -some-name for env var SOME_NAME, defaulting to its env var, else to the
+// config file, else to `fallback`
+func setting(flags *flag.FlagSet, env, fallback, usage string) *string {
+	return flags.String(flagName(env), lookup(env, fallback), fmt.Sprintf("%s (%s)", usage, env))
+}
+
+// secretSetting is a `setting` whose value -h doesn't print
+func secretSetting(flags *flag.FlagSet, env, usage string) *string {
+	value := &hidden{value: lookup(env, "")}
+	flags.Var(value, flagName(env), fmt.Sprintf("%s (%s)", usage, env))
+	return &value.value
+}
+
+func lookup(env, fallback string) string {
+	if value, ok := os.LookupEnv(env); ok {
+		return value
 	}
-	if s := os.Getenv("GITHUB_API_URL"); s != "" {
-		cryptoServer.GhAPIURL = s
+	if value, ok := config[env]; ok {
+		return value
 	}
-	if s := os.Getenv("GITHUB_HTML_URL"); s != "" {
-		cryptoServer.GhHTMLURL = s
+	return fallback
+}
+
+func flagName(env string) string {
+	return strings.ToLower(strings.Replace(env, "_", "-", -1))
+}
+
+type hidden struct {
+	value string
+}
+
+func (h *hidden) String() string {
+	return ""
+}
+
+func (h *hidden) Set(s string) error {
+	h.value = s
+	return nil
+}
+
+// webhookURLSettings are the webhook urls of a GH repo and PT project pair
+func webhookURLSettings(flags *flag.FlagSet) (githubWebhookURL, trackerWebhookURL *string) {
+	return secretSetting(flags, "GITHUB_WEBHOOK_URL", "webhook url added to the GH repo"),
+		secretSetting(flags, "TRACKER_WEBHOOK_URL", "webhook url added to the PT project")
+}
+
+// pairValues decrypts both webhook urls, for `githubtracker.NewBackfill` and the like
+func pairValues(secret, githubWebhookURL, trackerWebhookURL string) (issueValues, storyValues url.Values) {
+	issueValues, err := valuesFromURL(secret, githubWebhookURL)
+	if err != nil {
+		log.Fatalf("github-webhook-url: %s", err.Error())
 	}
+	storyValues, err = valuesFromURL(secret, trackerWebhookURL)
+	if err != nil {
+		log.Fatalf("tracker-webhook-url: %s", err.Error())
+	}
+	return issueValues, storyValues
+}
 
-	http.Handle("/github/", cryptoServer.RequireCipherNonce(githubtracker.WebhookIssueHandler{}))
-	http.Handle("/pivotaltracker/", cryptoServer.RequireCipherNonce(githubtracker.WebhookStoryHandler{}))
-	http.Handle("/", cryptoServer)
-	http.ListenAndServe(":"+os.Getenv("PORT"), nil)
+func valuesFromURL(secret, s string) (url.Values, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.DecryptValues(secret, u.Query())
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/choonkeat/githubtracker"
+	"github.com/choonkeat/githubtracker/crypto"
+)
+
+// serverSettings are what the server and the commands generating its urls share
+type serverSettings struct {
+	secret, upStage, githubAPIURL, githubHTMLURL, installationsFile *string
+}
+
+func newServerSettings(flags *flag.FlagSet) serverSettings {
+	return serverSettings{
+		secret:            secretSetting(flags, "SECRET", "uuid encrypting the tokens in the webhook urls"),
+		upStage:           setting(flags, "UP_STAGE", "", "path prefix of the server"),
+		githubAPIURL:      setting(flags, "GITHUB_API_URL", "https://api.github.com", "GH api, e.g. of GH enterprise"),
+		githubHTMLURL:     setting(flags, "GITHUB_HTML_URL", "https://github.com", "GH website, e.g. of GH enterprise"),
+		installationsFile: setting(flags, "INSTALLATIONS_FILE", "", "remembers the webhook urls generated, so they can be revoked"),
+	}
+}
+
+func (s serverSettings) cryptoServer() crypto.Server {
+	cryptoServer := crypto.Server{
+		Secret:     *s.secret,
+		PathPrefix: path.Join("/", *s.upStage),
+		GhAPIURL:   *s.githubAPIURL,
+		GhHTMLURL:  *s.githubHTMLURL,
+	}
+	if *s.installationsFile != "" {
+		cryptoServer.Installations = &crypto.Installations{Filename: *s.installationsFile}
+	}
+	return cryptoServer
+}
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	settings := newServerSettings(flags)
+	port := setting(flags, "PORT", "", "port to listen on")
+	captureDir := setting(flags, "CAPTURE_DIR", "", "saves every webhook payload there (redacted), for replay")
+	reviewFile := setting(flags, "REVIEW_FILE", "", "queues issues and stories with ambiguous titles there, for review")
+	adminUser := setting(flags, "ADMIN_USER", "admin", "username of the admin dashboard")
+	adminPassword := secretSetting(flags, "ADMIN_PASSWORD", "serves the admin dashboard at /admin/ with this password")
+	reconcileReport := setting(flags, "RECONCILE_REPORT", "", "report of the reconciler, for the admin dashboard")
+	flags.Parse(args)
+
+	cryptoServer := settings.cryptoServer()
+	apiHosts, err := githubtracker.APIHosts(cryptoServer.GhAPIURL)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	cryptoServer.Validate = githubtracker.CredentialsValidator{APIHosts: apiHosts}.Validate
+
+	review := &githubtracker.ReviewQueue{Filename: *reviewFile}
+	var issueHandler, storyHandler http.Handler = githubtracker.WebhookIssueHandler{Review: review}, githubtracker.WebhookStoryHandler{Review: review}
+	if *captureDir != "" {
+		issueHandler = githubtracker.Capture{Dir: *captureDir, Source: "github", Handler: issueHandler}
+		storyHandler = githubtracker.Capture{Dir: *captureDir, Source: "pivotaltracker", Handler: storyHandler}
+	}
+
+	githubHandler, trackerHandler := cryptoServer.RequireCipherNonce(issueHandler), cryptoServer.RequireCipherNonce(storyHandler)
+	if *adminPassword != "" {
+		if *adminUser == "" {
+			*adminUser = "admin"
+		}
+		admin := &githubtracker.Admin{
+			PathPrefix:    "/admin",
+			Username:      *adminUser,
+			Password:      *adminPassword,
+			ReportFile:    *reconcileReport,
+			Installations: cryptoServer.Installations,
+		}
+		githubHandler, trackerHandler = admin.Record("github", cryptoServer.RequireCipherNonce, issueHandler), admin.Record("pivotaltracker", cryptoServer.RequireCipherNonce, storyHandler)
+		http.Handle("/admin/", admin)
+	}
+
+	http.Handle("/github/", githubHandler)
+	http.Handle("/pivotaltracker/", trackerHandler)
+	http.Handle("/playground/", githubtracker.PlaygroundHandler{})
+	http.Handle("/register/", githubtracker.RegisterHandler{Secret: cryptoServer.Secret, GithubAPIURL: cryptoServer.GhAPIURL})
+	http.Handle("/", cryptoServer)
+	log.Fatalln(http.ListenAndServe(":"+*port, nil))
+}
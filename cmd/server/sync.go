@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/choonkeat/githubtracker"
+)
+
+// backfill links and syncs the GH issues and PT stories that existed before the webhooks did;
+// it prints the plan, unless -apply
+func backfill(args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	secret := secretSetting(flags, "SECRET", "uuid encrypting the tokens in the webhook urls")
+	githubWebhookURL, trackerWebhookURL := webhookURLSettings(flags)
+	apply := flags.Bool("apply", false, "apply the plan instead of only printing it")
+	closed := flags.Bool("closed", false, "also walk closed issues and accepted stories")
+	createStories := flags.Bool("create-stories", true, "create stories for issues that have none")
+	createIssues := flags.Bool("create-issues", true, "create issues for stories that have none")
+	label := flags.String("label", "", "only create counterparts of issues and stories with this label")
+	delay := flags.Duration("delay", time.Second, "pause between api writes")
+	stateFile := setting(flags, "BACKFILL_STATE", "backfill.json", "remembers applied actions, so an interrupted run can resume")
+	flags.Parse(args)
+
+	b, err := githubtracker.NewBackfill(pairValues(*secret, *githubWebhookURL, *trackerWebhookURL))
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	b.IncludeClosed = *closed
+	b.CreateStories = *createStories
+	b.CreateIssues = *createIssues
+	b.Label = *label
+	b.Delay = *delay
+	b.StateFile = *stateFile
+	if err = b.Run(*apply); err != nil {
+		log.Fatalln(err.Error())
+	}
+}
+
+// reconcile compares every linked GH issue and PT story, repairs drift on one side (e.g. from
+// missed webhooks) and reports conflicts
+func reconcile(args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	secret := secretSetting(flags, "SECRET", "uuid encrypting the tokens in the webhook urls")
+	githubWebhookURL, trackerWebhookURL := webhookURLSettings(flags)
+	stateFile := setting(flags, "RECONCILE_STATE", "reconcile.json", "snapshots of every pair, to tell which side changed since")
+	reportFile := setting(flags, "RECONCILE_REPORT", "", "json report of every pair after each run, e.g. for the admin dashboard")
+	every := flags.Duration("every", 0, "keep reconciling at this interval, instead of only once")
+	flags.Parse(args)
+
+	r, err := githubtracker.NewReconciler(pairValues(*secret, *githubWebhookURL, *trackerWebhookURL))
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	r.StateFile = *stateFile
+	r.ReportFile = *reportFile
+	for {
+		err = r.Run()
+		if *every == 0 {
+			break
+		}
+		if err != nil {
+			log.Println(err.Error())
+		}
+		time.Sleep(*every)
+	}
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+}
+
+// replay runs payloads, e.g. from CAPTURE_DIR, through the webhook handlers again
+func replay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	secret := secretSetting(flags, "SECRET", "uuid encrypting the tokens in the webhook urls; not needed with -fake")
+	webhookURL := flags.String("webhook-url", "", "webhook url the payloads were sent to")
+	fake := flags.Bool("fake", false, "find nothing and only print the writes, instead of calling the real apis")
+	flags.Parse(args)
+
+	r := githubtracker.Replay{
+		Out:        os.Stdout,
+		WebhookURL: *webhookURL,
+		Secret:     *secret,
+		Fake:       *fake,
+	}
+	failed := false
+	for _, filename := range flags.Args() {
+		fmt.Printf("replay %s\n", filename)
+		if err := r.Run(filename); err != nil {
+			log.Printf("%s: %s", filename, err.Error())
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// review lists the issues and stories whose title matched several counterparts, and pairs them up
+func review(args []string) {
+	flags := flag.NewFlagSet("review", flag.ExitOnError)
+	filename := setting(flags, "REVIEW_FILE", "", "review queue of the server")
+	secret := secretSetting(flags, "SECRET", "uuid encrypting the tokens in the webhook urls")
+	_, trackerWebhookURL := webhookURLSettings(flags)
+	choose := flags.String("choose", "", "candidate url to pair the given issue or story url with")
+	flags.Parse(args)
+
+	q := &githubtracker.ReviewQueue{Filename: *filename}
+	if *choose != "" && *trackerWebhookURL != "" {
+		storyValues, err := valuesFromURL(*secret, *trackerWebhookURL)
+		if err != nil {
+			log.Fatalf("tracker-webhook-url: %s", err.Error())
+		}
+		q.Unlabel = githubtracker.AmbiguousLabelRemover(storyValues)
+	} else if *choose != "" {
+		log.Println("without -tracker-webhook-url, the sync-ambiguous labels are left on the issues")
+	}
+	if *choose == "" {
+		if err := q.Print(os.Stdout); err != nil {
+			log.Fatalln(err.Error())
+		}
+		return
+	}
+	if flags.NArg() != 1 {
+		log.Fatalln("review -choose needs the issue or story url it was queued for")
+	}
+	if err := q.Choose(flags.Arg(0), *choose); err != nil {
+		log.Fatalln(err.Error())
+	}
+}
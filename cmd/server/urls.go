@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/githubtracker"
+	"github.com/choonkeat/githubtracker/crypto"
+)
+
+// genURL generates a webhook url offline, as the forms of the server would
+func genURL(args []string) {
+	flags := flag.NewFlagSet("gen-url", flag.ExitOnError)
+	settings := newServerSettings(flags)
+	source := flags.String("source", "github", "github or pivotaltracker, where the url is added")
+	baseURL := setting(flags, "BASE_URL", "", "where the server is, e.g. https://example.com")
+	expires := flags.String("expires", "", "date the url stops working, e.g. 2006-01-02")
+	validate := flags.Bool("validate", false, "check the token with GH or PT first, as the server does")
+	flags.Parse(args)
+	if *source != "github" && *source != "pivotaltracker" {
+		log.Fatalf("unknown source %q", *source)
+	}
+
+	s := settings.cryptoServer()
+	form := url.Values{}
+	for _, arg := range flags.Args() {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			log.Fatalf("expected key=value fields of the form, e.g. token=..., not %q", arg)
+		}
+		form.Add(kv[0], kv[1])
+	}
+	form.Set("target_path", path.Join(s.PathPrefix, *source)+"/")
+	if *expires != "" {
+		form.Set("expires", *expires)
+	}
+	if *validate {
+		s.Validate = githubtracker.CredentialsValidator{}.Validate
+	}
+	webhookURL, installation, err := s.Generate(form)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	log.Printf("installation %s", installation.ID)
+	fmt.Println(strings.TrimRight(*baseURL, "/") + webhookURL)
+}
+
+// inspectURL shows what webhook urls are configured with, without their token
+func inspectURL(args []string) {
+	flags := flag.NewFlagSet("inspect-url", flag.ExitOnError)
+	settings := newServerSettings(flags)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		log.Fatalln("inspect-url needs the webhook urls")
+	}
+
+	s := settings.cryptoServer()
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	for _, webhookURL := range flags.Args() {
+		inspection, err := crypto.Inspect(s.Secret, webhookURL, s.Installations)
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+		encoder.Encode(inspection)
+	}
+}
+
+// installations lists the webhook urls the server generated, to revoke them
+func installations(args []string) {
+	flags := flag.NewFlagSet("installations", flag.ExitOnError)
+	filename := setting(flags, "INSTALLATIONS_FILE", "", "webhook urls generated by the server")
+	revoke := flags.String("revoke", "", "installation id whose webhook url is refused from now on")
+	all := flags.Bool("all", false, "also list the revoked and expired ones")
+	flags.Parse(args)
+	if *filename == "" {
+		log.Fatalln("installations needs the INSTALLATIONS_FILE of the server")
+	}
+
+	s := &crypto.Installations{Filename: *filename}
+	if *revoke != "" {
+		if err := s.Revoke(*revoke); err != nil {
+			log.Fatalln(err.Error())
+		}
+		return
+	}
+	list, err := s.List()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	for _, i := range list {
+		status := i.Status(time.Now())
+		if status != "active" && !*all {
+			continue
+		}
+		expires := ""
+		if i.ExpiresAt != nil {
+			expires = " expires " + i.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%s %-8s %s -> %s (created %s%s)\n", i.ID, status, i.Path, i.Target, i.CreatedAt.Format(time.RFC3339), expires)
+	}
+}
@@ -0,0 +1,55 @@
+// webhook turns payloads into fixtures for the tests, e.g.
+//
+//	webhook capture -source github testdata/github/issues.something.json < payload.json
+//
+// the server captures every payload it receives when started with `CAPTURE_DIR=captured`; see
+// `server replay` to run them through the webhook handlers again
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/choonkeat/githubtracker"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "capture":
+		capture(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: webhook capture [flags] file")
+	os.Exit(2)
+}
+
+func capture(args []string) {
+	flags := flag.NewFlagSet("capture", flag.ExitOnError)
+	source := flags.String("source", "github", "github or pivotaltracker")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatalln("capture needs the fixture filename to write")
+	}
+
+	var err error
+	switch *source {
+	case "github":
+		err = githubtracker.ImportWebhookIssue(flags.Arg(0))
+	case "pivotaltracker":
+		err = githubtracker.ImportWebhookStory(flags.Arg(0))
+	default:
+		log.Fatalf("unknown source %q", *source)
+	}
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+}
@@ -7,15 +7,120 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"text/template"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 var multipleMatchesError = errors.Errorf("multiple matches error")
-var bodyTemplate = template.Must(template.New("body").Parse("{{ .URL }}\r\n\r\n{{ .StrippedBody }}"))
+var bodyTemplate = template.Must(template.New("body").Parse("{{ .Link }}\r\n\r\n{{ .StrippedBody }}"))
+
+// bodyParts fills `bodyTemplate` after translating markdown for the other side
+type bodyParts struct {
+	Link         string
+	StrippedBody string
+}
+
+// what to do with the PT story when its GH issue is deleted
+const (
+	issueDeletedLabel  = "label" // default
+	issueDeletedDelete = "delete"
+	issueDeletedChore  = "chore"
+)
+
+// what to do with the GH issue when its PT story moves to another project
+const (
+	projectMoveFollow = "follow" // default
+	projectMoveUnlink = "unlink"
+)
+
+// syncOptions are per-installation preferences carried in the webhook url
+type syncOptions struct {
+	IgnoreDraftPullRequests bool
+	OnIssueDeleted          string
+	OnProjectMove           string
+	People                  people
+	Policy                  statePolicy
+	LinkTemplate            string
+	DryRun                  bool       // log the writes instead of making them
+	dryRun                  *dryRunLog // where they are logged, e.g. review queue entries
+	Fields                  fieldOwners
+	Filters                 syncFilters
+}
+
+func syncOptionsFromValues(values url.Values) (syncOptions, error) {
+	policy, err := statePolicyFromValues(values)
+	if err != nil {
+		return syncOptions{}, err
+	}
+	fields, err := fieldOwnersFromValues(values)
+	if err != nil {
+		return syncOptions{}, err
+	}
+	filters, err := syncFiltersFromValues(values)
+	if err != nil {
+		return syncOptions{}, err
+	}
+	people, err := peopleFromValues(values)
+	if err != nil {
+		return syncOptions{}, err
+	}
+	opts := syncOptions{
+		Policy:                  policy,
+		IgnoreDraftPullRequests: (values.Get("ignore_draft_prs") == "1"),
+		OnIssueDeleted:          values.Get("on_issue_deleted"),
+		OnProjectMove:           values.Get("on_project_move"),
+		People:                  people,
+		LinkTemplate:            values.Get("link_template"),
+		DryRun:                  (values.Get("dry_run") == "1"),
+		Fields:                  fields,
+		Filters:                 filters,
+	}
+	if _, err := (storyLink{}).render(opts.LinkTemplate); err != nil {
+		return syncOptions{}, err
+	}
+	switch opts.OnIssueDeleted {
+	case issueDeletedDelete, issueDeletedChore:
+	default:
+		opts.OnIssueDeleted = issueDeletedLabel
+	}
+	if opts.OnProjectMove != projectMoveUnlink {
+		opts.OnProjectMove = projectMoveFollow
+	}
+	return opts, nil
+}
+
+// rateLimitError is returned when an api asks us to come back at `Reset`
+type rateLimitError struct {
+	Reset time.Time
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limited until %s", e.Reset.Format(time.RFC3339))
+}
+
+// rateLimitFrom returns a `rateLimitError` if `resp` says we are making too many requests
+func rateLimitFrom(resp *http.Response) error {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return &rateLimitError{Reset: time.Now().Add(time.Duration(secs) * time.Second)}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if secs, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return &rateLimitError{Reset: time.Unix(secs, 0)}
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &rateLimitError{Reset: time.Now().Add(time.Minute)}
+	}
+	return nil
+}
 
 // alwaysString can always decode from JSON into string value
 type alwaysString struct {
@@ -58,8 +163,11 @@ func debugHeaderBody(r headerBody) ([]byte, error) {
 		return nil, errors.Wrapf(err, "read body")
 	}
 	defer r.Body.Close()
+	if len(bytes.TrimSpace(data)) == 0 {
+		return data, nil // e.g. 204 No Content
+	}
 
-	v := map[string]interface{}{}
+	var v interface{} // lists are arrays
 	if err = json.Unmarshal(data, &v); err != nil {
 		return nil, errors.Wrapf(err, "json unmarshal")
 	}
@@ -73,11 +181,15 @@ func debugHeaderBody(r headerBody) ([]byte, error) {
 	return data, nil
 }
 
+// ImportWebhookIssue normalises the GH payload on stdin into a fixture
 func ImportWebhookIssue(filename string) error {
 	data, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
 		return err
 	}
+	if data, err = redactPayload(data); err != nil {
+		return err
+	}
 	var v githubWebhook
 	if err = json.Unmarshal(data, &v); err != nil {
 		return err
@@ -92,11 +204,15 @@ func ImportWebhookIssue(filename string) error {
 	return enc.Encode(v)
 }
 
+// ImportWebhookStory normalises the PT payload on stdin into a fixture
 func ImportWebhookStory(filename string) error {
 	data, err := ioutil.ReadAll(os.Stdin)
 	if err != nil {
 		return err
 	}
+	if data, err = redactPayload(data); err != nil {
+		return err
+	}
 	var v trackerWebhook
 	if err = json.Unmarshal(data, &v); err != nil {
 		return err
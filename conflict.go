@@ -0,0 +1,134 @@
+package githubtracker
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// syncConflictLabel marks issues and stories whose title or description changed on both sides
+const syncConflictLabel = "sync-conflict"
+
+// what to do with a title or description when the counterpart has it differently
+const (
+	fieldApply    = "apply"
+	fieldStale    = "stale"    // the counterpart changed after the event; its own webhook carries that over
+	fieldConflict = "conflict" // both sides changed since the last sync; left for a human
+)
+
+// fieldDecision decides whether an event may overwrite the counterpart's `current` value with `now`.
+// `was` is the value before the event, i.e. what both sides had at the last sync, or nil if the
+// event did not change the field. Without timestamps on both sides we can't tell which change is
+// newer, so we sync like we always did
+func fieldDecision(was *string, now, current string, eventAt, currentAt time.Time) string {
+	switch {
+	case now == "":
+		return fieldApply // not synced in this direction anyway
+	case eventAt.IsZero() || currentAt.IsZero():
+		return fieldApply
+	case current == now:
+		return fieldApply
+	case was != nil && current == *was:
+		return fieldApply // counterpart untouched since the last sync
+	case currentAt.After(eventAt):
+		return fieldStale
+	case was != nil:
+		return fieldConflict
+	}
+	return fieldApply
+}
+
+// resolveStoryConflicts leaves out the title and description of `story` that would overwrite newer
+// or conflicting changes in `rs`, and returns the conflicting fields
+func resolveStoryConflicts(issue *webhookIssue, story *storyDetail, rs *trackerSearchResultRow) ([]string, error) {
+	var bodyWas *string
+	if issue.bodyWas != nil {
+		was := *issue
+		was.Body, was.bodyWas, was.isDrifted = *issue.bodyWas, nil, true
+		wasStory, err := ptStoryFromWebhookIssue(&was)
+		if err != nil {
+			return nil, err
+		}
+		s := normalizeNewlines(wasStory.Body)
+		bodyWas = &s
+	}
+	var titleWas *string
+	if issue.titleWas != nil {
+		s := strings.TrimSpace(*issue.titleWas)
+		titleWas = &s
+	}
+
+	conflicts := []string{}
+	switch fieldDecision(titleWas, story.Title, strings.TrimSpace(rs.Name), issue.UpdatedAt, rs.UpdatedAt) {
+	case fieldStale:
+		log.Printf("stale title %q; story %s was updated at %s", story.Title, rs.ID.String(), rs.UpdatedAt)
+		story.Title = ""
+	case fieldConflict:
+		conflicts = append(conflicts, "title")
+		story.Title = ""
+	}
+	switch fieldDecision(bodyWas, normalizeNewlines(story.Body), normalizeNewlines(rs.Description), issue.UpdatedAt, rs.UpdatedAt) {
+	case fieldStale:
+		log.Printf("stale description; story %s was updated at %s", rs.ID.String(), rs.UpdatedAt)
+		story.Body = ""
+	case fieldConflict:
+		conflicts = append(conflicts, "description")
+		story.Body = ""
+	}
+	return conflicts, nil
+}
+
+// resolveIssueConflicts leaves out the title and body of `issue` that would overwrite newer
+// or conflicting changes in `found`, and returns the conflicting fields
+func resolveIssueConflicts(story *webhookStory, issue *issueDetail, found *githubSearchResultRow, githubHTMLURL, trackerHTMLURL string) ([]string, error) {
+	var bodyWas *string
+	if story.bodyWas != nil {
+		was := *story
+		was.Body = story.bodyWas
+		wasIssue, err := ghIssueFromWebhookStory(was, issue.repo, githubHTMLURL)
+		if err != nil {
+			return nil, err
+		}
+		s := issueBodyText(wasIssue.Body, trackerHTMLURL)
+		bodyWas = &s
+	}
+
+	conflicts := []string{}
+	switch fieldDecision(story.titleWas, issue.Title, found.Title, story.occurredAt, found.UpdatedAt) {
+	case fieldStale:
+		log.Printf("stale title %q; issue #%d was updated at %s", issue.Title, found.Number, found.UpdatedAt)
+		issue.Title = ""
+	case fieldConflict:
+		conflicts = append(conflicts, "title")
+		issue.Title = ""
+	}
+	if issue.Body == "" {
+		return conflicts, nil // not changed, or not synced from tracker
+	}
+	switch fieldDecision(bodyWas, issueBodyText(issue.Body, trackerHTMLURL), issueBodyText(found.Body, trackerHTMLURL), story.occurredAt, found.UpdatedAt) {
+	case fieldStale:
+		log.Printf("stale body; issue #%d was updated at %s", found.Number, found.UpdatedAt)
+		issue.Body = ""
+	case fieldConflict:
+		conflicts = append(conflicts, "body")
+		issue.Body = ""
+	}
+	return conflicts, nil
+}
+
+// issueBodyText is the part of an issue body that comes from the story description
+func issueBodyText(body, trackerHTMLURL string) string {
+	return normalizeNewlines(stripStoryLink(stripChecklistSections(body), trackerHTMLURL))
+}
+
+// withLabel returns the names of `labels` plus `name`, since github replaces all labels on update
+func withLabel(labels []webhookLabel, name string) []string {
+	result := []string{}
+	for _, l := range labels {
+		if l.Name == name {
+			return nil // nothing to change
+		}
+		result = append(result, l.Name)
+	}
+	return append(result, name)
+}
@@ -0,0 +1,141 @@
+package githubtracker
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldDecision(t *testing.T) {
+	old, event, later := "old", time.Date(2017, 12, 25, 14, 54, 21, 0, time.UTC), time.Date(2017, 12, 25, 14, 55, 0, 0, time.UTC)
+	testCases := []struct {
+		name         string
+		givenWas     *string
+		givenCurrent string
+		givenEventAt time.Time
+		givenAt      time.Time
+		expected     string
+	}{
+		{name: "no timestamps", givenWas: &old, givenCurrent: "theirs", expected: fieldApply},
+		{name: "already synced", givenWas: &old, givenCurrent: "new", givenEventAt: event, givenAt: later, expected: fieldApply},
+		{name: "untouched since last sync", givenWas: &old, givenCurrent: "old", givenEventAt: event, givenAt: later, expected: fieldApply},
+		{name: "changed after the event", givenWas: &old, givenCurrent: "theirs", givenEventAt: event, givenAt: later, expected: fieldStale},
+		{name: "changed before the event", givenWas: &old, givenCurrent: "theirs", givenEventAt: later, givenAt: event, expected: fieldConflict},
+		{name: "unchanged field, changed after the event", givenCurrent: "theirs", givenEventAt: event, givenAt: later, expected: fieldStale},
+		{name: "unchanged field, changed before the event", givenCurrent: "theirs", givenEventAt: later, givenAt: event, expected: fieldApply},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, fieldDecision(tc.givenWas, "new", tc.givenCurrent, tc.givenEventAt, tc.givenAt))
+		})
+	}
+}
+
+func TestIssueConflicts(t *testing.T) {
+	// issues.edited.json renames "users.email should have unique constraint" at 2017-12-25T14:54:21Z
+	body := "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five"
+	filters := []string{`name:"users.email should have unique constraint"`, `name:"should have unique index on users.email column [Finished #12345]"`}
+	testCases := []struct {
+		name            string
+		givenFoundStory *trackerSearchResultRow
+		expectedHistory []logTrackerAction
+	}{
+		{
+			name:            "story renamed after the issue",
+			givenFoundStory: &trackerSearchResultRow{ID: alwaysString{"42"}, Name: "renamed in tracker", Description: body, UpdatedAt: time.Date(2017, 12, 25, 14, 55, 0, 0, time.UTC)},
+			expectedHistory: []logTrackerAction{
+				{Method: "FindStory", GivenTitle: "should have unique index on users.email column [Finished #12345]", GivenBody: body, GivenSearchFilters: filters},
+				{Method: "UpdateStory", GivenID: "42", GivenBody: body, GivenSearchFilters: filters},
+			},
+		},
+		{
+			name:            "story renamed before the issue",
+			givenFoundStory: &trackerSearchResultRow{ID: alwaysString{"42"}, Name: "renamed in tracker", Description: body, UpdatedAt: time.Date(2017, 12, 25, 14, 50, 0, 0, time.UTC)},
+			expectedHistory: []logTrackerAction{
+				{Method: "FindStory", GivenTitle: "should have unique index on users.email column [Finished #12345]", GivenBody: body, GivenSearchFilters: filters},
+				{Method: "AddLabel", GivenID: "42", GivenTitle: syncConflictLabel},
+				{Method: "UpdateStory", GivenID: "42", GivenBody: body, GivenSearchFilters: filters},
+			},
+		},
+		{
+			name:            "story untouched since the last sync",
+			givenFoundStory: &trackerSearchResultRow{ID: alwaysString{"42"}, Name: "users.email should have unique constraint", Description: body, UpdatedAt: time.Date(2017, 12, 25, 14, 55, 0, 0, time.UTC)},
+			expectedHistory: []logTrackerAction{
+				{Method: "FindStory", GivenTitle: "should have unique index on users.email column [Finished #12345]", GivenBody: body, GivenSearchFilters: filters},
+				{Method: "UpdateStory", GivenID: "42", GivenTitle: "should have unique index on users.email column [Finished #12345]", GivenBody: body, GivenSearchFilters: filters},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := ioutil.ReadFile("testdata/github/issues.edited.json")
+			assert.Nil(t, err)
+			logclient := logTrackerClient{ExpectedFoundStory: tc.givenFoundStory}
+			err = WebhookIssueHandler{}.handle(data, &logclient, "https://www.pivotaltracker.com", syncOptions{})
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedHistory, logclient.History)
+		})
+	}
+}
+
+func TestStoryConflicts(t *testing.T) {
+	titleWas, bodyWas, body := "Hello world", "old description", "new description"
+	occurredAt := time.Date(2017, 12, 25, 14, 54, 21, 0, time.UTC)
+	issueBody := "https://www.pivotaltracker.com/story/show/153926473\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926473 version:1 -->\r\n\r\n"
+	testCases := []struct {
+		name            string
+		givenFoundIssue *githubSearchResultRow
+		expectedHistory []logAction
+	}{
+		{
+			name:            "issue edited after the story",
+			givenFoundIssue: &githubSearchResultRow{Number: 42, Title: "renamed in github", Body: issueBody + "edited in github", UpdatedAt: occurredAt.Add(time.Minute)},
+			expectedHistory: []logAction{},
+		},
+		{
+			name:            "issue edited before the story",
+			givenFoundIssue: &githubSearchResultRow{Number: 42, Title: "renamed in github", Body: issueBody + "edited in github", Labels: []webhookLabel{{Name: "bug"}}, UpdatedAt: occurredAt.Add(-time.Minute)},
+			expectedHistory: []logAction{
+				{Method: "UpdateIssue", GivenID: "42", GivenLabels: []string{"bug", syncConflictLabel}},
+			},
+		},
+		{
+			name:            "issue untouched since the last sync",
+			givenFoundIssue: &githubSearchResultRow{Number: 42, Title: titleWas, Body: issueBody + bodyWas, UpdatedAt: occurredAt.Add(time.Minute)},
+			expectedHistory: []logAction{
+				{Method: "GetIssue", GivenID: "42"},
+				{Method: "UpdateIssue", GivenID: "42", GivenTitle: "Hey, World!", GivenBody: issueBody + body},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logclient := logGithubClient{ExpectedFoundIssue: tc.givenFoundIssue}
+			story := &webhookStory{
+				URL:           "https://www.pivotaltracker.com/story/show/153926473",
+				StoryID:       "153926473",
+				Title:         "Hey, World!",
+				titleWas:      &titleWas,
+				Body:          &body,
+				bodyWas:       &bodyWas,
+				occurredAt:    occurredAt,
+				githubHTMLURL: "https://github.com",
+			}
+			err := WebhookStoryHandler{}.handleStory(story, &logclient, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com", syncOptions{})
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedHistory, logclient.History[1:]) // after FindIssue
+		})
+	}
+}
+
+func TestParseWebhookStoryWas(t *testing.T) {
+	story, err := parseWebhookStory([]byte(`{"occurred_at":1514213661000,"changes":[{"kind":"story","id":1,"change_type":"update","new_values":{"name":"b","description":"y"},"original_values":{"name":"a","description":"x"}}]}`), "https://github.com", "https://www.pivotaltracker.com")
+	assert.Nil(t, err)
+	if assert.NotNil(t, story) {
+		assert.Equal(t, time.Date(2017, 12, 25, 14, 54, 21, 0, time.UTC), story.occurredAt.UTC())
+		assert.Equal(t, "a", *story.titleWas)
+		assert.Equal(t, "x", *story.bodyWas)
+	}
+}
@@ -0,0 +1,164 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var projectIDInURL = regexp.MustCompile(`/projects/(\d+)/?$`)
+
+// CredentialsValidator checks the token of a webhook url form before it is encrypted into a url,
+// see `crypto.Server.Validate`: the GH token of the PT form must be able to push to its repos,
+// and the PT token of the GH form must be able to edit stories in its projects
+type CredentialsValidator struct {
+	Client   *http.Client
+	APIHosts []string // the api urls of the form and its routes must be on one of these, see `APIHosts`; any when empty
+}
+
+// Validate returns every problem found, one per line
+func (v CredentialsValidator) Validate(targetPath string, form url.Values) error {
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var problems []string
+	switch path.Base(targetPath) {
+	case "pivotaltracker":
+		g := githubAPI{
+			Client:   client,
+			Token:    form.Get("token"),
+			Username: form.Get("username"),
+			URL:      strings.TrimRight(form.Get("api_url"), "/"),
+		}
+		groups := routeGroups(routesFromValues(form), form.Get("repo"))
+		for _, group := range groups {
+			if err := allowedAPI(group.route.github(g).URL, v.APIHosts); err != nil {
+				return errors.Wrapf(err, "api_url")
+			}
+		}
+		for _, group := range groups {
+			problems = append(problems, validateGithub(group.route.github(g), group.targets)...)
+		}
+	case "github":
+		t := trackerAPI{Client: client, Token: form.Get("token")}
+		groups := routeGroups(routesFromValues(form), form.Get("api_url"))
+		for _, group := range groups {
+			for _, projectURL := range group.targets {
+				if err := allowedAPI(projectURL, v.APIHosts); err != nil {
+					return errors.Wrapf(err, "api_url")
+				}
+			}
+		}
+		for _, group := range groups {
+			problems = append(problems, validateTracker(group.route.tracker(t), group.targets)...)
+		}
+	default:
+		return errors.Errorf("unknown webhook url %s", targetPath)
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func validateGithub(g githubAPI, repos []string) []string {
+	data, err := g.perform("GET", g.URL+"/user", nil, http.StatusOK)
+	if err != nil {
+		if statusOf(err) == http.StatusUnauthorized {
+			return []string{"GH rejected the token; check it was copied whole and hasn't expired"}
+		}
+		return []string{fmt.Sprintf("GH %s/user: %s; is the api url right?", g.URL, err.Error())}
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err = json.Unmarshal(data, &user); err != nil {
+		return []string{errors.Wrapf(err, "GH %s/user", g.URL).Error()}
+	}
+
+	problems := []string{}
+	for _, repo := range repos {
+		data, err := g.perform("GET", g.URL+"/repos/"+repo, nil, http.StatusOK)
+		if statusOf(err) == http.StatusNotFound {
+			problems = append(problems, fmt.Sprintf("GH repo %s is not found, or %s can't see it (private repos need the repo scope)", repo, user.Login))
+			continue
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("GH repo %s: %s", repo, err.Error()))
+			continue
+		}
+		var result struct {
+			Permissions *struct {
+				Push bool `json:"push"`
+			} `json:"permissions"`
+		}
+		if err = json.Unmarshal(data, &result); err != nil {
+			problems = append(problems, errors.Wrapf(err, "GH repo %s", repo).Error())
+			continue
+		}
+		if result.Permissions == nil || !result.Permissions.Push {
+			problems = append(problems, fmt.Sprintf("%s can't push to GH repo %s, so issues can't be created or edited; ask for write access", user.Login, repo))
+		}
+	}
+	return problems
+}
+
+func validateTracker(t trackerAPI, projectURLs []string) []string {
+	data, err := t.perform("GET", t.accountURL()+"/me", nil)
+	if err == nil {
+		err = trackerError(data)
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("PT rejected the token (%s); it's on your PT profile page", err.Error())}
+	}
+	var me struct {
+		Username string `json:"username"`
+		Projects []struct {
+			ProjectID int64  `json:"project_id"`
+			Role      string `json:"role"`
+		} `json:"projects"`
+	}
+	if err = json.Unmarshal(data, &me); err != nil {
+		return []string{errors.Wrapf(err, "PT %s/me", t.accountURL()).Error()}
+	}
+
+	problems := []string{}
+	for _, projectURL := range projectURLs {
+		match := projectIDInURL.FindStringSubmatch(projectURL)
+		if match == nil {
+			problems = append(problems, fmt.Sprintf("%s is not a PT project api url, e.g. https://www.pivotaltracker.com/services/v5/projects/123", projectURL))
+			continue
+		}
+		role := ""
+		for _, p := range me.Projects {
+			if fmt.Sprintf("%d", p.ProjectID) == match[1] {
+				role = p.Role
+			}
+		}
+		switch role {
+		case "owner", "member":
+		case "":
+			problems = append(problems, fmt.Sprintf("%s is not a member of PT project %s", me.Username, match[1]))
+		case "viewer":
+			problems = append(problems, fmt.Sprintf("%s is only a viewer of PT project %s, so stories can't be created or edited; ask to be a member", me.Username, match[1]))
+		default:
+			problems = append(problems, fmt.Sprintf("%s is %s in PT project %s, so stories can't be created or edited; ask to be a member", me.Username, role, match[1]))
+		}
+	}
+	return problems
+}
+
+// statusOf returns the unexpected http status of `err`, or 0
+func statusOf(err error) int {
+	if e, ok := err.(*statusError); ok {
+		return e.Got
+	}
+	return 0
+}
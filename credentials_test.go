@@ -0,0 +1,139 @@
+package githubtracker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCredentialsAPIs pretends to be GH and PT, knowing one good token each
+func fakeCredentialsAPIs(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/v3/") {
+		if _, token, _ := r.BasicAuth(); token != "gh-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"Bad credentials"}`))
+			return
+		}
+	} else if r.Header.Get("X-TrackerToken") != "pt-token" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"kind":"error","code":"invalid_authentication","error":"Invalid authentication credentials were presented."}`))
+		return
+	}
+	switch r.URL.Path {
+	case "/api/v3/user":
+		w.Write([]byte(`{"login":"octocat"}`))
+	case "/api/v3/repos/user123/repo456":
+		w.Write([]byte(`{"full_name":"user123/repo456","permissions":{"admin":false,"push":true,"pull":true}}`))
+	case "/api/v3/repos/user123/readonly":
+		w.Write([]byte(`{"full_name":"user123/readonly","permissions":{"admin":false,"push":false,"pull":true}}`))
+	case "/services/v5/me":
+		w.Write([]byte(`{"username":"ptcat","projects":[{"project_id":99,"role":"member"},{"project_id":100,"role":"viewer"},{"project_id":102,"role":"inactive"},{"project_id":103,"role":"guest"}]}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"Not Found"}`))
+	}
+}
+
+func TestCredentialsValidator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(fakeCredentialsAPIs))
+	defer server.Close()
+	githubForm := func(token, repo, route string) url.Values {
+		return url.Values{"token": {token}, "username": {"octocat"}, "api_url": {server.URL + "/api/v3"}, "repo": {repo}, "route": {route}, "target_path": {"/pivotaltracker/"}}
+	}
+	trackerForm := func(token, project, route string) url.Values {
+		return url.Values{"token": {token}, "api_url": {server.URL + "/services/v5/projects/" + project}, "route": {route}, "target_path": {"/github/"}}
+	}
+	testCases := []struct {
+		name          string
+		givenForm     url.Values
+		expectedError string
+	}{
+		{name: "github ok", givenForm: githubForm("gh-token", "user123/repo456", "")},
+		{name: "github typo", givenForm: githubForm("gh-tokne", "user123/repo456", ""), expectedError: "GH rejected the token"},
+		{name: "github missing repo", givenForm: githubForm("gh-token", "user123/repo465", ""), expectedError: "GH repo user123/repo465 is not found, or octocat can't see it"},
+		{name: "github read only", givenForm: githubForm("gh-token", "user123/readonly", ""), expectedError: "octocat can't push to GH repo user123/readonly"},
+		{name: "github routed read only", givenForm: githubForm("gh-token", "user123/repo456", "label:repo:web user123/readonly"), expectedError: "octocat can't push to GH repo user123/readonly"},
+		{name: "github routed with its own token", givenForm: githubForm("gh-token", "user123/repo456", "label:repo:web user123/readonly token=gh-tokne"), expectedError: "GH rejected the token"},
+		{name: "tracker ok", givenForm: trackerForm("pt-token", "99", "")},
+		{name: "tracker typo", givenForm: trackerForm("pt-tokne", "99", ""), expectedError: "PT rejected the token (invalid_authentication"},
+		{name: "tracker not a member", givenForm: trackerForm("pt-token", "101", ""), expectedError: "ptcat is not a member of PT project 101"},
+		{name: "tracker routed with its own token", givenForm: trackerForm("pt-token", "99", "label:backend "+server.URL+"/services/v5/projects/99 token=pt-tokne"), expectedError: "PT rejected the token"},
+		{name: "tracker inactive", givenForm: trackerForm("pt-token", "102", ""), expectedError: "ptcat is inactive in PT project 102, so stories can't be created or edited"},
+		{name: "tracker unknown role", givenForm: trackerForm("pt-token", "103", ""), expectedError: "ptcat is guest in PT project 103, so stories can't be created or edited"},
+		{name: "tracker routed viewer", givenForm: trackerForm("pt-token", "99", "label:backend "+server.URL+"/services/v5/projects/100"), expectedError: "ptcat is only a viewer of PT project 100"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cryptoServer := crypto.Server{Secret: "c1626442-0327-40a6-a830-c5517d6782d2", Validate: CredentialsValidator{}.Validate}
+			r := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(tc.givenForm.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			cryptoServer.ServeHTTP(w, r)
+			if tc.expectedError == "" {
+				assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				assert.NotEmpty(t, w.Header().Get("X-Result-URL"))
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedError)
+			assert.Empty(t, w.Header().Get("X-Result-URL"), "no url is minted")
+		})
+	}
+}
+
+// handlerTransport answers requests with a handler, instead of the hosts they are sent to
+type handlerTransport struct {
+	t       *testing.T
+	handler http.HandlerFunc
+	hosts   []string // the requests expected
+}
+
+func (h handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	assert.Contains(h.t, h.hosts, r.URL.Host, "requested %s", r.URL)
+	w := httptest.NewRecorder()
+	h.handler(w, r)
+	return w.Result(), nil
+}
+
+func TestCredentialsValidatorAPIHosts(t *testing.T) {
+	hosts, err := APIHosts("https://ghe.example.com/api/v3")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ghe.example.com", "www.pivotaltracker.com"}, hosts)
+	v := CredentialsValidator{Client: &http.Client{Transport: handlerTransport{t, fakeCredentialsAPIs, hosts}}, APIHosts: hosts}
+
+	githubForm := func(apiURL, route string) url.Values {
+		return url.Values{"token": {"gh-token"}, "username": {"octocat"}, "api_url": {apiURL}, "repo": {"user123/repo456"}, "route": {route}}
+	}
+	trackerForm := func(apiURL, route string) url.Values {
+		return url.Values{"token": {"pt-token"}, "api_url": {apiURL}, "route": {route}}
+	}
+	testCases := []struct {
+		name          string
+		givenPath     string
+		givenForm     url.Values
+		expectedError string
+	}{
+		{name: "github ok", givenPath: "/pivotaltracker/", givenForm: githubForm("https://ghe.example.com/api/v3", "")},
+		{name: "github elsewhere", givenPath: "/pivotaltracker/", givenForm: githubForm("https://169.254.169.254/api/v3", ""), expectedError: "api_url: https://169.254.169.254/api/v3 is not on ghe.example.com or www.pivotaltracker.com"},
+		{name: "github plain http", givenPath: "/pivotaltracker/", givenForm: githubForm("http://ghe.example.com/api/v3", ""), expectedError: "api_url: http://ghe.example.com/api/v3 is not on"},
+		{name: "github route elsewhere", givenPath: "/pivotaltracker/", givenForm: githubForm("https://ghe.example.com/api/v3", "label:repo:web user123/web token=gh-token api_url=https://evil.example.com/api/v3"), expectedError: "api_url: https://evil.example.com/api/v3 is not on"},
+		{name: "tracker ok", givenPath: "/github/", givenForm: trackerForm("https://www.pivotaltracker.com/services/v5/projects/99", "")},
+		{name: "tracker elsewhere", givenPath: "/github/", givenForm: trackerForm("https://localhost:8080/services/v5/projects/99", ""), expectedError: "api_url: https://localhost:8080/services/v5/projects/99 is not on"},
+		{name: "tracker route elsewhere", givenPath: "/github/", givenForm: trackerForm("https://www.pivotaltracker.com/services/v5/projects/99", "label:backend https://evil.example.com/services/v5/projects/100 token=pt-token"), expectedError: "api_url: https://evil.example.com/services/v5/projects/100 is not on"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Validate(tc.givenPath, tc.givenForm)
+			if tc.expectedError == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tc.expectedError)
+			}
+		})
+	}
+}
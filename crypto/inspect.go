@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Inspection is what a webhook url is configured with, without its secrets; for support
+type Inspection struct {
+	Path         string     `json:"path"`
+	Installation string     `json:"installation,omitempty"` // none for urls generated before installations
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Status       string     `json:"status"` // active, expired or revoked (when the installations are known)
+	Token        string     `json:"token"`  // only how it starts, to tell which token it is
+	Values       url.Values `json:"values"` // everything else in the url
+}
+
+// Inspect decrypts `webhookURL` with `secret`, even when it expired; `installations` is optional
+func Inspect(secret, webhookURL string, installations *Installations) (Inspection, error) {
+	u, err := url.Parse(strings.TrimSpace(webhookURL))
+	if err != nil {
+		return Inspection{}, err
+	}
+	values := u.Query()
+	plaintext, err := DecryptWithSecretEnv(secret, values.Get("token"), values.Get("nonce"))
+	if err != nil {
+		return Inspection{}, errors.Wrapf(err, "not a webhook url of this SECRET")
+	}
+	p := decodePayload(plaintext)
+	values.Del("token")
+	values.Del("nonce")
+	values.Del("installation")
+
+	for _, route := range p.Route {
+		values.Add("route", routeTokens.ReplaceAllStringFunc(route, func(s string) string {
+			i := strings.Index(s, "token=") + len("token=")
+			return s[:i] + redact(s[i:])
+		}))
+	}
+
+	inspection := Inspection{
+		Path:         u.Path,
+		Installation: p.Installation,
+		ExpiresAt:    p.ExpiresAt,
+		Token:        redact(p.Token),
+		Values:       values,
+	}
+	installation := Installation{ExpiresAt: p.ExpiresAt}
+	if installations != nil && p.Installation != "" {
+		list, err := installations.List()
+		if err != nil {
+			return inspection, err
+		}
+		for _, i := range list {
+			if i.ID == p.Installation {
+				installation.RevokedAt = i.RevokedAt
+			}
+		}
+	}
+	inspection.Status = installation.Status(time.Now())
+	return inspection, nil
+}
+
+// redact keeps the first few characters of `token`, e.g. the ghp_ of GH tokens
+func redact(token string) string {
+	if len(token) <= 8 {
+		return fmt.Sprintf("(%d characters)", len(token))
+	}
+	return fmt.Sprintf("%s... (%d characters)", token[:4], len(token))
+}
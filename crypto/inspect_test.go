@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "installations")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := Server{Secret: uuid.New().String(), Installations: &Installations{Filename: filepath.Join(dir, "installations.json")}}
+
+	webhookURL, installation, err := s.Generate(url.Values{"token": {"ghp_0123456789abcdef"}, "username": {"octocat"}, "repo": {"user/repo"}, "target_path": {"/pivotaltracker/"}, "expires": {"2001-01-01"}})
+	assert.Nil(t, err)
+	inspection, err := Inspect(s.Secret, "https://example.com"+webhookURL, s.Installations)
+	assert.Nil(t, err)
+	assert.Equal(t, Inspection{
+		Path:         "/pivotaltracker/",
+		Installation: installation.ID,
+		ExpiresAt:    installation.ExpiresAt,
+		Status:       "expired",
+		Token:        "ghp_... (20 characters)",
+		Values:       url.Values{"username": {"octocat"}, "repo": {"user/repo"}},
+	}, inspection)
+
+	webhookURL, installation, err = s.Generate(url.Values{"token": {"pt-token"}, "target_path": {"/github/"}, "route": {"label:backend https://www.pivotaltracker.com/services/v5/projects/2 token=0123456789abcdef"}})
+	assert.Nil(t, err)
+	assert.NotContains(t, webhookURL, "route=")
+	assert.Nil(t, s.Installations.Revoke(installation.ID))
+	inspection, err = Inspect(s.Secret, webhookURL, s.Installations)
+	assert.Nil(t, err)
+	assert.Equal(t, "revoked", inspection.Status)
+	assert.Equal(t, "(8 characters)", inspection.Token)
+	assert.Equal(t, []string{"label:backend https://www.pivotaltracker.com/services/v5/projects/2 token=0123... (16 characters)"}, inspection.Values["route"])
+	inspection, err = Inspect(s.Secret, webhookURL, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "active", inspection.Status)
+
+	_, err = Inspect(uuid.New().String(), webhookURL, nil)
+	assert.NotNil(t, err, "another secret")
+}
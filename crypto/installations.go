@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// refused webhook urls, see `DecryptValues` and `RequireCipherNonce`
+var (
+	ErrExpired = errors.New("webhook url expired")
+	ErrRevoked = errors.New("webhook url revoked")
+)
+
+// payload is what the token of a webhook url decrypts to; older urls only have the token
+type payload struct {
+	Token        string     `json:"token"`
+	Installation string     `json:"installation"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Route        []string   `json:"route,omitempty"` // when the routes have tokens of their own
+}
+
+func encodePayload(p payload) (string, error) {
+	data, err := json.Marshal(p)
+	return string(data), errors.Wrapf(err, "json marshal")
+}
+
+func decodePayload(plaintext string) payload {
+	p := payload{}
+	if strings.HasPrefix(plaintext, "{") && json.Unmarshal([]byte(plaintext), &p) == nil {
+		return p
+	}
+	return payload{Token: plaintext}
+}
+
+// Installation is a webhook url that `Server` generated
+type Installation struct {
+	ID        string     `json:"id"`
+	Path      string     `json:"path"`   // e.g. /github/
+	Target    string     `json:"target"` // the GH repo or PT project it syncs to
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Status is active, expired or revoked
+func (i Installation) Status(now time.Time) string {
+	switch {
+	case i.RevokedAt != nil:
+		return "revoked"
+	case i.ExpiresAt != nil && !now.Before(*i.ExpiresAt):
+		return "expired"
+	}
+	return "active"
+}
+
+// Installations keeps the installations `Server` generated in a json file, and which are revoked.
+// urls generated before it was set have no installation, and can't be revoked one by one
+type Installations struct {
+	Filename string
+	mu       sync.Mutex
+}
+
+func (s *Installations) load() ([]Installation, error) {
+	list := []Installation{}
+	data, err := ioutil.ReadFile(s.Filename)
+	if os.IsNotExist(err) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list, errors.Wrapf(json.Unmarshal(data, &list), "%s", s.Filename)
+}
+
+func (s *Installations) save(list []Installation) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Filename, data, 0644)
+}
+
+func (s *Installations) add(i Installation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	return s.save(append(list, i))
+}
+
+// List returns every installation, oldest first
+func (s *Installations) List() ([]Installation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Revoke refuses the webhook url of installation `id` from now on
+func (s *Installations) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].ID == id {
+			if list[i].RevokedAt == nil {
+				now := time.Now().UTC()
+				list[i].RevokedAt = &now
+			}
+			return s.save(list)
+		}
+	}
+	return errors.Errorf("no installation %s in %s", id, s.Filename)
+}
+
+// revoked tells if installation `id` was revoked
+func (s *Installations) revoked(id string) (bool, error) {
+	list, err := s.List()
+	if err != nil {
+		return false, err
+	}
+	for _, i := range list {
+		if i.ID == id {
+			return i.RevokedAt != nil, nil
+		}
+	}
+	return false, nil
+}
@@ -1,12 +1,22 @@
 package crypto
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"html"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 // Server receives `password` in http post form, respond with `cipher` and `nonce`
@@ -15,6 +25,12 @@ type Server struct {
 	Secret     string
 	GhAPIURL   string
 	GhHTMLURL  string
+
+	Installations *Installations // optional; remembers the generated urls, and refuses the revoked ones
+
+	// Validate is optional; it checks the form of a webhook url with the apis, and no url is
+	// generated if it returns an error, which is shown as is
+	Validate func(targetPath string, form url.Values) error
 }
 
 func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -32,6 +48,56 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			    <input size="100" name="repo" placeholder="username/repo" required><br>
 			    <input size="100" name="github_html_url" value="` + html.EscapeString(s.GhHTMLURL) + `" required><br>
 			    <input size="100" name="tracker_html_url" value="https://www.pivotaltracker.com" required><br>
+			    <textarea cols="100" rows="3" name="route" placeholder="optional, one per line, e.g. label:repo:web username/web, with token=... (and username=..., api_url=...) when the token above cannot reach it"></textarea><br>
+			    <textarea cols="100" rows="3" name="people" placeholder="optional, one per line, e.g. github_login pt_username"></textarea><br>
+			    <textarea cols="100" rows="3" name="policy" placeholder='optional state policy, e.g. {"issue_state": {"delivered": "closed"}}'></textarea><br>
+			    <input size="100" name="link_template" placeholder="optional issue link, e.g. Tracked in [PT #{{ .StoryID }}]({{ .URL }})"><br>
+					<label><small>
+						When a story moves to another project
+						<select name="on_project_move">
+							<option value="follow">keep the issue linked to it</option>
+							<option value="unlink">unlink the issue</option>
+						</select>
+					</small></label><br>
+					<label><small>
+						<input type="checkbox" name="dry_run" value="1"> Dry run: only log what would be written
+					</small></label><br>
+					<label><small>
+						Titles sync <select name="sync_title">
+							<option value="both">both ways</option>
+							<option value="github">from github only</option>
+							<option value="tracker">from tracker only</option>
+							<option value="none">never</option>
+						</select>
+						descriptions sync <select name="sync_body">
+							<option value="both">both ways</option>
+							<option value="github">from github only</option>
+							<option value="tracker">from tracker only</option>
+							<option value="none">never</option>
+						</select>
+						states sync <select name="sync_state">
+							<option value="both">both ways</option>
+							<option value="github">from github only</option>
+							<option value="tracker">from tracker only</option>
+							<option value="none">never</option>
+						</select>
+						(use the same on both forms)
+					</small></label><br>
+			    <input size="100" name="opt_in_label" placeholder="optional opt-in label, e.g. tracker; only labelled issues and stories sync"><br>
+			    <input size="48" name="github_labels" placeholder="optional github labels to sync">
+			    <input size="48" name="github_exclude_labels" placeholder="optional github labels to skip"><br>
+			    <input size="48" name="github_authors" placeholder="optional github authors to sync">
+			    <input size="48" name="github_exclude_authors" placeholder="optional github authors to skip"><br>
+			    <input size="48" name="github_title" placeholder="optional regexp of github titles to sync">
+			    <input size="48" name="github_exclude_title" placeholder="optional regexp of github titles to skip"><br>
+			    <input size="100" name="github_kinds" placeholder="optional, issue or pull_request; both by default"><br>
+			    <input size="48" name="tracker_labels" placeholder="optional tracker labels to sync">
+			    <input size="48" name="tracker_exclude_labels" placeholder="optional tracker labels to skip"><br>
+			    <input size="100" name="tracker_story_types" placeholder="optional tracker story types to sync, e.g. feature, bug"><br>
+			    <input size="48" name="tracker_states" placeholder="optional tracker states to sync">
+			    <input size="48" name="tracker_exclude_states" placeholder="optional tracker states to skip"><br>
+			    <small>Filters are separated by commas or spaces (use the same on both forms)</small><br>
+			    <label><small>Expires on <input type="date" name="expires"> (optional; the url is refused from that day on)</small></label><br>
 			    <input size="100" name="target_path" value="` + path.Join(s.PathPrefix, "pivotaltracker") + `/" type="hidden"><br>
 			    <input type="submit">
 			  </form>
@@ -49,34 +115,249 @@ func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 						<input type="checkbox" name="estimate_chores" value="1"> Bugs and Chores May Be Given Points
 						<a target="_blank" href="https://www.pivotaltracker.com/help/articles/planning_with_velocity/#bugs-and-chores-arent-estimable-by-default">Strongly discouraged!</a>
 					</small></label><br>
+					<label><small>
+						<input type="checkbox" name="ignore_draft_prs" value="1"> Ignore draft pull requests
+					</small></label><br>
+					<label><small>
+						When an issue is deleted
+						<select name="on_issue_deleted">
+							<option value="label">label the story github-deleted</option>
+							<option value="chore">accept the story as a chore</option>
+							<option value="delete">delete the story</option>
+						</select>
+					</small></label><br>
+					<label><small>
+						<input type="checkbox" name="dry_run" value="1"> Dry run: only log what would be written
+					</small></label><br>
+					<label><small>
+						Titles sync <select name="sync_title">
+							<option value="both">both ways</option>
+							<option value="github">from github only</option>
+							<option value="tracker">from tracker only</option>
+							<option value="none">never</option>
+						</select>
+						descriptions sync <select name="sync_body">
+							<option value="both">both ways</option>
+							<option value="github">from github only</option>
+							<option value="tracker">from tracker only</option>
+							<option value="none">never</option>
+						</select>
+						states sync <select name="sync_state">
+							<option value="both">both ways</option>
+							<option value="github">from github only</option>
+							<option value="tracker">from tracker only</option>
+							<option value="none">never</option>
+						</select>
+						(use the same on both forms)
+					</small></label><br>
+			    <input size="100" name="opt_in_label" placeholder="optional opt-in label, e.g. tracker; only labelled issues and stories sync"><br>
+			    <input size="48" name="github_labels" placeholder="optional github labels to sync">
+			    <input size="48" name="github_exclude_labels" placeholder="optional github labels to skip"><br>
+			    <input size="48" name="github_authors" placeholder="optional github authors to sync">
+			    <input size="48" name="github_exclude_authors" placeholder="optional github authors to skip"><br>
+			    <input size="48" name="github_title" placeholder="optional regexp of github titles to sync">
+			    <input size="48" name="github_exclude_title" placeholder="optional regexp of github titles to skip"><br>
+			    <input size="100" name="github_kinds" placeholder="optional, issue or pull_request; both by default"><br>
+			    <input size="48" name="tracker_labels" placeholder="optional tracker labels to sync">
+			    <input size="48" name="tracker_exclude_labels" placeholder="optional tracker labels to skip"><br>
+			    <input size="100" name="tracker_story_types" placeholder="optional tracker story types to sync, e.g. feature, bug"><br>
+			    <input size="48" name="tracker_states" placeholder="optional tracker states to sync">
+			    <input size="48" name="tracker_exclude_states" placeholder="optional tracker states to skip"><br>
+			    <small>Filters are separated by commas or spaces (use the same on both forms)</small><br>
+			    <textarea cols="100" rows="3" name="people" placeholder="optional, one per line, e.g. github_login pt_username"></textarea><br>
+			    <textarea cols="100" rows="3" name="policy" placeholder='optional state policy, e.g. {"issue_state": {"delivered": "closed"}}'></textarea><br>
+			    <textarea cols="100" rows="3" name="route" placeholder="optional, one per line, e.g. label:backend https://www.pivotaltracker.com/services/v5/projects/<yyy> or path:services/api/ https://www.pivotaltracker.com/services/v5/projects/<zzz>, with token=... when the token above cannot reach it"></textarea><br>
+			    <label><small>Expires on <input type="date" name="expires"> (optional; the url is refused from that day on)</small></label><br>
 			    <input size="100" name="target_path" value="` + path.Join(s.PathPrefix, "github") + `/" type="hidden"><br>
 			    <input type="submit">
 			  </form>
 			</fieldset>
+			<fieldset>
+			  <legend>Then let the server add both webhooks, with the credentials inside them</legend>
+			  <form method="POST" action="` + path.Join(s.PathPrefix, "register") + `/">
+			    <input size="100" name="github_webhook_url" placeholder="the generated GH webhook url, e.g. https://example.com/github/?..." required><br>
+			    <input size="100" name="tracker_webhook_url" placeholder="the generated PT webhook url, e.g. https://example.com/pivotaltracker/?..." required><br>
+			    <small>The GH token needs admin access to the repo (or the admin:repo_hook scope), and the PT token must be a project owner</small><br>
+			    <input type="submit" value="Register">
+			  </form>
+			</fieldset>
 		`,
 		))
 		return
 	}
 
-	plaintext := r.FormValue("token")
-	ciphertext, noncetext, err := EncryptWithSecretENV(s.Secret, plaintext)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		s.serveJSON(w, r)
+		return
+	}
+	r.ParseForm()
+	resultURL, _, err := s.Generate(r.PostForm)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
-
-	targetPath := r.FormValue("target_path")
-	form := r.PostForm
-	form.Set("token", ciphertext) // overwrite plain text
-	form.Set("nonce", noncetext)
-	form.Del("target_path")
-
-	resultURL := targetPath + "?" + form.Encode()
 	w.Header().Set("X-Result-URL", resultURL)
 	w.Header().Set("Content-Type", "text/html")
 	w.Write([]byte(fmt.Sprintf(`<a href="%s">generated link (right click, copy)</a>`, html.EscapeString(resultURL))))
 }
 
+// formError is a problem with what was posted, rather than with the server
+type formError struct {
+	error
+}
+
+func errorStatus(err error) int {
+	if _, ok := err.(formError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Generate encrypts the token of a webhook url `form`, as the forms post it with `target_path`
+// for where the url points, and returns the url with its installation
+func (s Server) Generate(form url.Values) (string, Installation, error) {
+	p, err := s.check(form)
+	if err != nil {
+		return "", Installation{}, err
+	}
+	return s.generate(form, p)
+}
+
+// check validates `form`, and returns the payload to encrypt
+func (s Server) check(form url.Values) (payload, error) {
+	p := payload{Token: form.Get("token"), Installation: uuid.New().String()}
+	if s.Validate != nil {
+		if err := s.Validate(form.Get("target_path"), form); err != nil {
+			return p, formError{err}
+		}
+	}
+	if expires := form.Get("expires"); expires != "" {
+		expiresAt, err := parseExpiry(expires)
+		if err != nil {
+			return p, formError{err}
+		}
+		p.ExpiresAt = &expiresAt
+	}
+	return p, nil
+}
+
+func (s Server) generate(form url.Values, p payload) (string, Installation, error) {
+	if routes := form["route"]; routeTokens.MatchString(strings.Join(routes, "\n")) {
+		p.Route = routes
+	}
+	plaintext, err := encodePayload(p)
+	if err != nil {
+		return "", Installation{}, err
+	}
+	ciphertext, noncetext, err := EncryptWithSecretENV(s.Secret, plaintext)
+	if err != nil {
+		return "", Installation{}, err
+	}
+
+	values := url.Values{}
+	for k, v := range form {
+		values[k] = append([]string{}, v...)
+	}
+	targetPath := values.Get("target_path")
+	values.Set("token", ciphertext) // overwrite plain text
+	values.Set("nonce", noncetext)
+	values.Del("target_path")
+	values.Del("expires") // it's in the token
+	if p.Route != nil {
+		values.Del("route")
+	}
+
+	target := values.Get("repo") // of the PT webhook url; the GH one syncs to its PT api_url
+	if target == "" {
+		target = values.Get("api_url")
+	}
+	installation := Installation{ID: p.Installation, Path: targetPath, Target: target, CreatedAt: time.Now().UTC(), ExpiresAt: p.ExpiresAt}
+	if s.Installations != nil {
+		if err = s.Installations.add(installation); err != nil {
+			return "", installation, err
+		}
+	}
+	return targetPath + "?" + values.Encode(), installation, nil
+}
+
+// generateRequest is what the json api takes: either or both webhook urls, with the fields of the forms
+type generateRequest struct {
+	BaseURL        string            `json:"base_url"` // optional, e.g. https://example.com to get absolute urls
+	Expires        string            `json:"expires"`  // optional, for both urls
+	Github         map[string]string `json:"github"`
+	Pivotaltracker map[string]string `json:"pivotaltracker"`
+}
+
+type generateResponse struct {
+	GithubWebhookURL  string         `json:"github_webhook_url,omitempty"`
+	TrackerWebhookURL string         `json:"tracker_webhook_url,omitempty"`
+	Installations     []Installation `json:"installations"`
+	Error             string         `json:"error,omitempty"`
+}
+
+// serveJSON generates the urls of a `generateRequest`; nothing is generated unless both are valid
+func (s Server) serveJSON(w http.ResponseWriter, r *http.Request) {
+	respond := func(status int, response generateResponse) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}
+	req := generateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond(http.StatusBadRequest, generateResponse{Error: "json decode: " + err.Error()})
+		return
+	}
+
+	type side struct {
+		name   string
+		fields map[string]string
+		result *string
+		form   url.Values
+		p      payload
+	}
+	response := generateResponse{Installations: []Installation{}}
+	sides := []*side{}
+	for _, sd := range []*side{
+		{name: "github", fields: req.Github, result: &response.GithubWebhookURL},
+		{name: "pivotaltracker", fields: req.Pivotaltracker, result: &response.TrackerWebhookURL},
+	} {
+		if sd.fields == nil {
+			continue
+		}
+		sd.form = url.Values{}
+		if req.Expires != "" {
+			sd.form.Set("expires", req.Expires)
+		}
+		for k, v := range sd.fields {
+			sd.form.Set(k, v)
+		}
+		sd.form.Set("target_path", path.Join(s.PathPrefix, sd.name)+"/")
+		sides = append(sides, sd)
+	}
+	if len(sides) == 0 {
+		respond(http.StatusBadRequest, generateResponse{Error: "expected github or pivotaltracker fields"})
+		return
+	}
+
+	for _, sd := range sides {
+		var err error
+		if sd.p, err = s.check(sd.form); err != nil {
+			respond(errorStatus(err), generateResponse{Error: sd.name + ": " + err.Error()})
+			return
+		}
+	}
+	for _, sd := range sides {
+		resultURL, installation, err := s.generate(sd.form, sd.p)
+		if err != nil {
+			respond(errorStatus(err), generateResponse{Error: sd.name + ": " + err.Error()})
+			return
+		}
+		*sd.result = strings.TrimRight(req.BaseURL, "/") + resultURL
+		response.Installations = append(response.Installations, installation)
+	}
+	respond(http.StatusOK, response)
+}
+
 type contextKeyType int
 
 var contextKey contextKeyType = 0
@@ -88,17 +369,77 @@ func ValuesFromContext(ctx context.Context) url.Values {
 	return url.Values{}
 }
 
+// DecryptValues replaces the encrypted token of webhook url `values` with its plain text, and
+// sets its `installation` if any; `ErrExpired` once the url expired
+func DecryptValues(secret string, values url.Values) (url.Values, error) {
+	plaintext, err := DecryptWithSecretEnv(secret, values.Get("token"), values.Get("nonce"))
+	if err != nil {
+		return nil, err
+	}
+	p := decodePayload(plaintext)
+	if p.ExpiresAt != nil && !time.Now().Before(*p.ExpiresAt) {
+		return nil, ErrExpired
+	}
+	values.Set("token", p.Token)
+	values.Del("installation") // only trust the encrypted one
+	if p.Installation != "" {
+		values.Set("installation", p.Installation)
+	}
+	if p.Route != nil {
+		values["route"] = p.Route
+	}
+	return values, nil
+}
+
+// routeTokens finds the tokens of routes, e.g. "label:repo:web acme/web token=..."
+var routeTokens = regexp.MustCompile(`(^|\s)token=(\S+)`)
+
+// parseExpiry reads a date, which expires at the start of that day (UTC), or a RFC3339 time
+func parseExpiry(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", strings.TrimSpace(s)); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+	return t.UTC(), errors.Wrapf(err, "expires: expected a date like 2006-01-02")
+}
+
 func (s Server) RequireCipherNonce(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		values := r.URL.Query()
-		cipher := values.Get("token")
-		nonce := values.Get("nonce")
-		password, err := DecryptWithSecretEnv(s.Secret, cipher, nonce)
+		values, err := DecryptValues(s.Secret, r.URL.Query())
+		if err == ErrExpired {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		values.Set("token", password)
+		if id := values.Get("installation"); id != "" && s.Installations != nil {
+			revoked, err := s.Installations.revoked(id)
+			if err != nil {
+				log.Println(err.Error())
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				http.Error(w, "Forbidden: "+ErrRevoked.Error()+" (installation "+id+")", http.StatusForbidden)
+				return
+			}
+		}
+		if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+			// registered on GH with `HookSecret`; pasted urls have no secret, so no signature
+			body, err := ioutil.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !validSignature(HookSecret(s.Secret, r.URL.Query().Get("nonce")), body, signature) {
+				http.Error(w, "Unauthorized: X-Hub-Signature-256 does not match", http.StatusUnauthorized)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
 		ctx := context.WithValue(r.Context(), contextKey, values)
 		h.ServeHTTP(w, r.WithContext(ctx))
 	})
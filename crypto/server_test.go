@@ -2,13 +2,19 @@ package crypto
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"html"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -50,9 +56,131 @@ func TestServer(t *testing.T) {
 			assert.NotEmpty(t, token, "cipher text")
 			assert.NotEmpty(t, nonce, "nonce text")
 
-			plaintext, err := DecryptWithSecretEnv(s.Secret, token, nonce)
+			values, err := DecryptValues(s.Secret, resultURL.Query())
 			assert.Nil(t, err, "decrypt")
-			assert.Equal(t, tc.givenFormValues.Get("token"), plaintext)
+			assert.Equal(t, tc.givenFormValues.Get("token"), values.Get("token"))
+			assert.NotEmpty(t, values.Get("installation"))
 		})
 	}
 }
+
+func TestDecryptValuesOfOlderURLs(t *testing.T) {
+	secret := uuid.New().String()
+	token, nonce, err := EncryptWithSecretENV(secret, "h3llo+w0rl!")
+	assert.Nil(t, err)
+	values, err := DecryptValues(secret, url.Values{"token": {token}, "nonce": {nonce}, "installation": {"spoofed"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "h3llo+w0rl!", values.Get("token"))
+	assert.Equal(t, "", values.Get("installation"))
+}
+
+func TestRequireCipherNonce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "installations")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := Server{Secret: uuid.New().String(), Installations: &Installations{Filename: filepath.Join(dir, "installations.json")}}
+	generate := func(form url.Values) string {
+		r := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w.Header().Get("X-Result-URL")
+	}
+	serve := func(webhookURL string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.RequireCipherNonce(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(ValuesFromContext(r.Context()).Get("token")))
+		})).ServeHTTP(w, httptest.NewRequest("POST", webhookURL, nil))
+		return w
+	}
+
+	active := generate(url.Values{"token": {"h3llo"}, "repo": {"user/repo"}, "target_path": {"/pivotaltracker/"}, "expires": {"2999-01-01"}})
+	revoked := generate(url.Values{"token": {"h3llo"}, "api_url": {"https://www.pivotaltracker.com/services/v5/projects/1"}, "target_path": {"/github/"}})
+	expired := generate(url.Values{"token": {"h3llo"}, "target_path": {"/github/"}, "expires": {"2001-01-01"}})
+	assert.NotContains(t, active, "expires")
+
+	list, err := s.Installations.List()
+	assert.Nil(t, err)
+	if assert.Len(t, list, 3) {
+		assert.Equal(t, "/pivotaltracker/", list[0].Path)
+		assert.Equal(t, "user/repo", list[0].Target)
+		assert.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/1", list[1].Target)
+		assert.Equal(t, "expired", list[2].Status(time.Now()))
+		assert.Nil(t, s.Installations.Revoke(list[1].ID))
+	}
+	assert.NotNil(t, s.Installations.Revoke("unknown"))
+
+	w := serve(active)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "h3llo", w.Body.String())
+	w = serve(revoked)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "revoked")
+	w = serve(expired)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "expired")
+	w = serve("/github/?token=nope&nonce=" + uuid.New().String())
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r := httptest.NewRequest("POST", "http://example.com/", strings.NewReader("token=x&expires=soon"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServeJSON(t *testing.T) {
+	s := Server{Secret: uuid.New().String(), PathPrefix: "/stage"}
+	post := func(body string) (*httptest.ResponseRecorder, generateResponse) {
+		r := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		response := generateResponse{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+		return w, response
+	}
+
+	w, response := post(`{
+		"base_url": "https://example.com/",
+		"expires": "2999-01-01",
+		"github": {"token": "pt-token", "api_url": "https://www.pivotaltracker.com/services/v5/projects/1"},
+		"pivotaltracker": {"token": "gh-token", "username": "octocat", "repo": "user/repo"}
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	githubURL, trackerURL := mustParseURL(t, response.GithubWebhookURL), mustParseURL(t, response.TrackerWebhookURL)
+	assert.Equal(t, "https://example.com/stage/github/", githubURL.Scheme+"://"+githubURL.Host+githubURL.Path)
+	assert.Equal(t, "/stage/pivotaltracker/", trackerURL.Path)
+	assert.Equal(t, "user/repo", trackerURL.Query().Get("repo"))
+	values, err := DecryptValues(s.Secret, trackerURL.Query())
+	assert.Nil(t, err)
+	assert.Equal(t, "gh-token", values.Get("token"))
+	if assert.Len(t, response.Installations, 2) {
+		assert.Equal(t, "/stage/github/", response.Installations[0].Path)
+		assert.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/1", response.Installations[0].Target)
+		assert.Equal(t, values.Get("installation"), response.Installations[1].ID)
+		assert.Equal(t, "2999-01-01T00:00:00Z", response.Installations[1].ExpiresAt.Format(time.RFC3339))
+	}
+
+	s.Validate = func(targetPath string, form url.Values) error {
+		if form.Get("token") == "bad" {
+			return errors.New("rejected the token")
+		}
+		return nil
+	}
+	w, response = post(`{"github": {"token": "pt-token"}, "pivotaltracker": {"token": "bad"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, generateResponse{Error: "pivotaltracker: rejected the token"}, response, "neither url is generated")
+
+	w, response = post(`{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response.Error, "expected github or pivotaltracker")
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	u, err := url.Parse(s)
+	assert.Nil(t, err)
+	return u
+}
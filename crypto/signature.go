@@ -0,0 +1,26 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HookSecret is the secret a webhook url is registered with on GH, so its deliveries can be
+// told apart from forgeries; derived from the url's `nonce`, so nothing needs to be stored
+func HookSecret(secret, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signature is the `X-Hub-Signature-256` of `body`, as GH sends it
+func Signature(hookSecret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(hookSecret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func validSignature(hookSecret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Signature(hookSecret, body)), []byte(signature))
+}
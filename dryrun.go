@@ -0,0 +1,112 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// dryRunWrite is a write that dry run skipped
+type dryRunWrite struct {
+	Method  string      `json:"method"`
+	Target  string      `json:"target,omitempty"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// dryRunLog collects the writes skipped by `dryRunTracker` and `dryRunGithub`
+type dryRunLog struct {
+	Writes []dryRunWrite `json:"writes"`
+}
+
+func (d *dryRunLog) skip(method, target string, payload interface{}) error {
+	data, _ := json.Marshal(payload)
+	log.Printf("dry run: skip %s %s %s", method, target, data)
+	d.Writes = append(d.Writes, dryRunWrite{Method: method, Target: target, Payload: payload})
+	return nil
+}
+
+// writeJSON responds with what dry run skipped
+func (d *dryRunLog) writeJSON(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"dry_run": true, "writes": d.Writes})
+}
+
+// dryRunTracker reads from pivotal tracker, but only logs the writes
+type dryRunTracker struct {
+	trackerAPIClient
+	*dryRunLog
+}
+
+func (d dryRunTracker) CreateStory(story *storyDetail) error {
+	return d.skip("CreateStory", "", story)
+}
+
+func (d dryRunTracker) UpdateStory(story *storyDetail, rs *trackerSearchResultRow) error {
+	return d.skip("UpdateStory", rs.ID.String(), story)
+}
+
+func (d dryRunTracker) DeleteStory(storyID string) error {
+	return d.skip("DeleteStory", storyID, nil)
+}
+
+func (d dryRunTracker) AddPullRequest(storyID string, pr *pullRequestDetail) error {
+	return d.skip("AddPullRequest", storyID, pr)
+}
+
+func (d dryRunTracker) AddSourceCommit(commit *sourceCommitDetail) error {
+	return d.skip("AddSourceCommit", "", commit)
+}
+
+func (d dryRunTracker) CreateTask(storyID string, task *storyTask) error {
+	return d.skip("CreateTask", storyID, task)
+}
+
+func (d dryRunTracker) UpdateTask(storyID string, task *storyTask) error {
+	return d.skip("UpdateTask", storyID, task)
+}
+
+func (d dryRunTracker) DeleteTask(storyID string, task *storyTask) error {
+	return d.skip("DeleteTask", storyID, task)
+}
+
+func (d dryRunTracker) CreateBlocker(storyID string, blocker *storyBlocker) error {
+	return d.skip("CreateBlocker", storyID, blocker)
+}
+
+func (d dryRunTracker) UpdateBlocker(storyID string, blocker *storyBlocker) error {
+	return d.skip("UpdateBlocker", storyID, blocker)
+}
+
+func (d dryRunTracker) DeleteBlocker(storyID string, blocker *storyBlocker) error {
+	return d.skip("DeleteBlocker", storyID, blocker)
+}
+
+func (d dryRunTracker) UpdateEpic(epicID string, epic *epicDetail) error {
+	return d.skip("UpdateEpic", epicID, epic)
+}
+
+func (d dryRunTracker) AddLabel(storyID string, label trackerLabel) error {
+	return d.skip("AddLabel", storyID, label)
+}
+
+func (d dryRunTracker) RemoveLabel(storyID string, label trackerLabel) error {
+	return d.skip("RemoveLabel", storyID, label)
+}
+
+// dryRunGithub reads from github, but only logs the writes
+type dryRunGithub struct {
+	githubAPIClient
+	*dryRunLog
+}
+
+func (d dryRunGithub) CreateIssue(issue *issueDetail) error {
+	return d.skip("CreateIssue", issue.repo, issue)
+}
+
+func (d dryRunGithub) UpdateIssue(issue *issueDetail, rs *githubSearchResultRow) error {
+	return d.skip("UpdateIssue", rs.HTMLURL, issue)
+}
+
+// ensure we implement the interfaces
+var _ trackerAPIClient = dryRunTracker{}
+var _ githubAPIClient = dryRunGithub{}
@@ -0,0 +1,42 @@
+package githubtracker
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunTracker(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/github/issues.new.json")
+	assert.Nil(t, err)
+
+	logclient := logTrackerClient{}
+	dryRun := &dryRunLog{}
+	err = WebhookIssueHandler{}.handle(data, dryRunTracker{&logclient, dryRun}, "https://www.pivotaltracker.com", syncOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []logTrackerAction{
+		{Method: "FindStory", GivenTitle: "users.email should have unique constraint", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five", GivenSearchFilters: []string{`name:"users.email should have unique constraint"`}},
+	}, logclient.History)
+	if assert.Len(t, dryRun.Writes, 1) {
+		assert.Equal(t, "CreateStory", dryRun.Writes[0].Method)
+		assert.Equal(t, "users.email should have unique constraint", dryRun.Writes[0].Payload.(*storyDetail).Title)
+	}
+}
+
+func TestDryRunGithub(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/tracker/story_update_activity.json")
+	assert.Nil(t, err)
+
+	logclient := logGithubClient{}
+	dryRun := &dryRunLog{}
+	err = WebhookStoryHandler{}.handle(data, dryRunGithub{&logclient, dryRun}, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com", syncOptions{DryRun: true})
+	assert.Nil(t, err)
+	for _, action := range logclient.History {
+		assert.NotContains(t, []string{"CreateIssue", "UpdateIssue"}, action.Method)
+	}
+	if assert.Len(t, dryRun.Writes, 1) {
+		assert.Equal(t, "CreateIssue", dryRun.Writes[0].Method)
+		assert.Equal(t, "user123/repo456", dryRun.Writes[0].Target)
+	}
+}
@@ -0,0 +1,149 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// epicMembersSection lists the issues of stories labelled with the epic; checked when accepted
+var epicMembersSection = checklistSection{name: "epic members", idLabel: "story"}
+
+// githubEpicLabel marks github tracking issues of pivotal tracker epics
+const githubEpicLabel = "epic"
+
+// webhookEpic is a change made to a pivotal tracker epic
+type webhookEpic struct {
+	ID          string
+	Name        string
+	Description *string
+	URL         string
+	nameWas     *string
+	isDeleted   bool
+}
+
+// payload to be sent to pivotaltracker.com epics
+type epicDetail struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type trackerEpic struct {
+	ID          alwaysString `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Label       trackerLabel `json:"label"`
+}
+
+type trackerLabel struct {
+	ID   alwaysString `json:"id"`
+	Name string       `json:"name"`
+}
+
+func epicStripRegexpFor(trackerHTMLURL string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?i)^%s/%s/([\d]+)`, strings.TrimRight(trackerHTMLURL, "/"), "epic/show"))
+}
+
+// epicIDFromBody returns the pivotal tracker epic id if `body` belongs to a tracking issue
+func epicIDFromBody(body, trackerHTMLURL string) string {
+	if res := epicStripRegexpFor(trackerHTMLURL).FindStringSubmatch(body); res != nil {
+		return res[1]
+	}
+	return ""
+}
+
+// epicDescriptionFromBody returns the human-written part of a tracking issue body
+func epicDescriptionFromBody(body, trackerHTMLURL string) string {
+	return strings.TrimSpace(epicStripRegexpFor(trackerHTMLURL).ReplaceAllString(stripChecklistSections(body), ""))
+}
+
+// memberChanges returns changes made to the members section of a tracking issue body
+func (i *webhookIssue) memberChanges() []checklistChange {
+	if i == nil || i.bodyWas == nil {
+		return nil
+	}
+	return diffChecklist(epicMembersSection.parse(*i.bodyWas), epicMembersSection.parse(i.Body))
+}
+
+// issueURLFor returns the url of issue `number` in the same repository as `issueURL`
+func issueURLFor(issueURL, number string) string {
+	i := strings.LastIndex(issueURL, "/issues/")
+	if i < 0 {
+		return ""
+	}
+	return issueURL[:i] + "/issues/" + number
+}
+
+// webhookSubIssue is a github issue added to, or removed from, a tracking issue
+type webhookSubIssue struct {
+	isAdded bool
+	Parent  *webhookIssue
+	Sub     *webhookIssue
+}
+
+func parseWebhookSubIssue(data []byte) (*webhookSubIssue, error) {
+	wh := githubWebhook{}
+	if err := json.Unmarshal(data, &wh); err != nil {
+		return nil, errors.Wrap(err, "unmarshal parse sub issue")
+	}
+	if wh.ParentIssue == nil || wh.SubIssue == nil {
+		return nil, nil
+	}
+	switch wh.Action {
+	case "sub_issue_added":
+		return &webhookSubIssue{isAdded: true, Parent: wh.ParentIssue, Sub: wh.SubIssue}, nil
+	case "sub_issue_removed":
+		return &webhookSubIssue{isAdded: false, Parent: wh.ParentIssue, Sub: wh.SubIssue}, nil
+	}
+	return nil, nil
+}
+
+// epicMemberText e.g. "#12 `started`"
+func epicMemberText(number int64, state string) string {
+	if state == "" {
+		return fmt.Sprintf("#%d", number)
+	}
+	return fmt.Sprintf("#%d `%s`", number, state)
+}
+
+// epicMemberNumber returns the issue number of an epic member item, e.g. "12" for "#12 `started`"
+func epicMemberNumber(text string) string {
+	if res := hashRef.FindStringSubmatch(text); res != nil {
+		return res[1]
+	}
+	return ""
+}
+
+// epicMemberChange returns the change to make on every epic issue listing the story
+func epicMemberChange(storyID string, number int64, state string) checklistChange {
+	return checklistChange{
+		Action: checklistUpdate,
+		Item: checklistItem{
+			ID:      storyID,
+			Text:    epicMemberText(number, state),
+			Checked: state == storyStateAccepted,
+		},
+		hasText:    true,
+		hasChecked: true,
+	}
+}
+
+// ghIssueFromWebhookEpic returns the tracking issue of an epic; `Body` is empty if description is unchanged
+func ghIssueFromWebhookEpic(epic webhookEpic, repo string) *issueDetail {
+	issue := issueDetail{
+		repo:   repo,
+		Title:  epic.Name,
+		Labels: []string{githubEpicLabel},
+	}
+	if epic.Description != nil {
+		issue.Body = strings.TrimSpace(epic.URL + "\r\n\r\n" + *epic.Description)
+	}
+	if epic.isDeleted {
+		issue.Title = issue.Title + noStorySuffix
+		issue.Body = ""
+	}
+	return &issue
+}
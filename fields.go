@@ -0,0 +1,61 @@
+package githubtracker
+
+import (
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// which side owns a synced field
+const (
+	ownerBoth    = "both"    // edits on either side sync to the other
+	ownerGithub  = "github"  // only github edits sync, to tracker
+	ownerTracker = "tracker" // only tracker edits sync, to github
+	ownerNone    = "none"    // never synced after the issue or story is created
+)
+
+// fieldOwners decides the sync direction of title, body and state; given in both forms as
+// `sync_title`, `sync_body` and `sync_state`, and should be the same on both webhook urls.
+// new issues and stories are still created with every field, as long as any field syncs
+// in that direction
+type fieldOwners struct {
+	Title string
+	Body  string
+	State string
+}
+
+func fieldOwnersFromValues(values url.Values) (fieldOwners, error) {
+	f := fieldOwners{
+		Title: valueOr(values.Get("sync_title"), ownerBoth),
+		Body:  valueOr(values.Get("sync_body"), ownerBoth),
+		State: valueOr(values.Get("sync_state"), ownerBoth),
+	}
+	for name, owner := range map[string]string{"sync_title": f.Title, "sync_body": f.Body, "sync_state": f.State} {
+		switch owner {
+		case ownerBoth, ownerGithub, ownerTracker, ownerNone:
+		default:
+			return f, errors.Errorf("%s: unknown %q, expected both, github, tracker or none", name, owner)
+		}
+	}
+	return f, nil
+}
+
+// fromGithub tells if edits of a field with `owner` sync from github to tracker
+func fromGithub(owner string) bool {
+	return owner == "" || owner == ownerBoth || owner == ownerGithub
+}
+
+// fromTracker tells if edits of a field with `owner` sync from tracker to github
+func fromTracker(owner string) bool {
+	return owner == "" || owner == ownerBoth || owner == ownerTracker
+}
+
+// createsStories tells if github issues may create tracker stories
+func (f fieldOwners) createsStories() bool {
+	return fromGithub(f.Title) || fromGithub(f.Body) || fromGithub(f.State)
+}
+
+// createsIssues tells if tracker stories may create github issues
+func (f fieldOwners) createsIssues() bool {
+	return fromTracker(f.Title) || fromTracker(f.Body) || fromTracker(f.State)
+}
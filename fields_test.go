@@ -0,0 +1,109 @@
+package githubtracker
+
+import (
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldOwnersFromValues(t *testing.T) {
+	testCases := []struct {
+		name          string
+		givenValues   url.Values
+		expected      fieldOwners
+		expectedError bool
+	}{
+		{
+			name:     "default",
+			expected: fieldOwners{Title: ownerBoth, Body: ownerBoth, State: ownerBoth},
+		},
+		{
+			name:        "split",
+			givenValues: url.Values{"sync_title": {"tracker"}, "sync_body": {"github"}, "sync_state": {"none"}},
+			expected:    fieldOwners{Title: ownerTracker, Body: ownerGithub, State: ownerNone},
+		},
+		{
+			name:          "unknown",
+			givenValues:   url.Values{"sync_body": {"gitlab"}},
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := fieldOwnersFromValues(tc.givenValues)
+			if tc.expectedError {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestFieldOwnersCreates(t *testing.T) {
+	assert.True(t, fieldOwners{}.createsStories())
+	assert.True(t, fieldOwners{}.createsIssues())
+	mirror := fieldOwners{Title: ownerGithub, Body: ownerGithub, State: ownerGithub}
+	assert.True(t, mirror.createsStories())
+	assert.False(t, mirror.createsIssues())
+}
+
+func TestIssueFieldOwners(t *testing.T) {
+	body := "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five"
+	data, err := ioutil.ReadFile("testdata/github/issues.edited.json")
+	assert.Nil(t, err)
+	logclient := logTrackerClient{ExpectedFoundStory: &trackerSearchResultRow{ID: alwaysString{"42"}, Name: "renamed in tracker", Description: body}}
+	err = WebhookIssueHandler{}.handle(data, &logclient, "https://www.pivotaltracker.com", syncOptions{Fields: fieldOwners{Title: ownerTracker}})
+	assert.Nil(t, err)
+	if assert.Len(t, logclient.History, 2) {
+		assert.Equal(t, "UpdateStory", logclient.History[1].Method)
+		assert.Equal(t, "", logclient.History[1].GivenTitle) // tracker owns titles
+		assert.Equal(t, body, logclient.History[1].GivenBody)
+	}
+}
+
+func TestStoryFieldOwners(t *testing.T) {
+	body := "new description"
+	issueBody := "https://www.pivotaltracker.com/story/show/153926473\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926473 version:1 -->\r\n\r\nold"
+	newStory := func() *webhookStory {
+		return &webhookStory{
+			URL:           "https://www.pivotaltracker.com/story/show/153926473",
+			StoryID:       "153926473",
+			Title:         "Hey, World!",
+			Body:          &body,
+			githubHTMLURL: "https://github.com",
+		}
+	}
+	opts := syncOptions{Fields: fieldOwners{Title: ownerTracker, Body: ownerGithub, State: ownerNone}}
+
+	// only the title is sent
+	logclient := logGithubClient{ExpectedFoundIssue: &githubSearchResultRow{Number: 42, Title: "Hello world", Body: issueBody}}
+	err := WebhookStoryHandler{}.handleStory(newStory(), &logclient, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com", opts)
+	assert.Nil(t, err)
+	if assert.NotEmpty(t, logclient.History) {
+		last := logclient.History[len(logclient.History)-1]
+		assert.Equal(t, "UpdateIssue", last.Method)
+		assert.Equal(t, "Hey, World!", last.GivenTitle)
+		assert.Equal(t, "", last.GivenBody)
+	}
+
+	// no issue is created without its title
+	opts.Fields.Title = ownerGithub
+	logclient = logGithubClient{}
+	err = WebhookStoryHandler{}.handleStory(newStory(), &logclient, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com", opts)
+	assert.Nil(t, err)
+	for _, action := range logclient.History {
+		assert.NotEqual(t, "CreateIssue", action.Method)
+	}
+}
+
+func TestReconcilerOwned(t *testing.T) {
+	fields := fieldOwners{Title: ownerTracker, Body: ownerBoth, State: ownerNone}
+	r := &Reconciler{walker: walker{issueOpts: syncOptions{Fields: fields}, storyOpts: syncOptions{Fields: fields}}}
+	drifted := []string{"title", "body", "state"}
+	assert.Equal(t, []string{"body"}, r.owned(driftGithub, drifted))
+	assert.Equal(t, []string{"title", "body"}, r.owned(driftTracker, drifted))
+}
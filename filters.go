@@ -0,0 +1,196 @@
+package githubtracker
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// kinds of github items, for `github_kinds`
+const (
+	githubKindIssue       = "issue"
+	githubKindPullRequest = "pull_request"
+)
+
+// syncFilters decide which issues, pull requests and stories sync at all, from what the webhook
+// payload carries, i.e. before any api call; should be the same on both webhook urls.
+// lists are separated by commas or spaces and match case-insensitively
+type syncFilters struct {
+	GithubLabels         []string // needs one of these labels
+	GithubExcludeLabels  []string
+	GithubAuthors        []string
+	GithubExcludeAuthors []string
+	GithubKinds          []string // issue or pull_request; both when empty
+	GithubTitle          *regexp.Regexp
+	GithubExcludeTitle   *regexp.Regexp
+	TrackerLabels        []string // needs one of these labels
+	TrackerExcludeLabels []string
+	TrackerStoryTypes    []string
+	TrackerStates        []string
+	TrackerExcludeStates []string
+}
+
+func syncFiltersFromValues(values url.Values) (syncFilters, error) {
+	f := syncFilters{
+		GithubLabels:         filterList(values, "github_labels"),
+		GithubExcludeLabels:  filterList(values, "github_exclude_labels"),
+		GithubAuthors:        filterList(values, "github_authors"),
+		GithubExcludeAuthors: filterList(values, "github_exclude_authors"),
+		GithubKinds:          filterList(values, "github_kinds"),
+		TrackerLabels:        filterList(values, "tracker_labels"),
+		TrackerExcludeLabels: filterList(values, "tracker_exclude_labels"),
+		TrackerStoryTypes:    filterList(values, "tracker_story_types"),
+		TrackerStates:        filterList(values, "tracker_states"),
+		TrackerExcludeStates: filterList(values, "tracker_exclude_states"),
+	}
+	// opt-in mode: only items labelled e.g. `tracker` on either side sync
+	if label := filterList(values, "opt_in_label"); len(label) > 0 {
+		f.GithubLabels = append(f.GithubLabels, label...)
+		f.TrackerLabels = append(f.TrackerLabels, label...)
+	}
+	for _, kind := range f.GithubKinds {
+		if kind != githubKindIssue && kind != githubKindPullRequest {
+			return f, errors.Errorf("github_kinds: unknown %q, expected issue or pull_request", kind)
+		}
+	}
+	var err error
+	if f.GithubTitle, err = filterRegexp(values, "github_title"); err != nil {
+		return f, err
+	}
+	if f.GithubExcludeTitle, err = filterRegexp(values, "github_exclude_title"); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func filterList(values url.Values, key string) []string {
+	var result []string
+	for _, value := range values[key] {
+		for _, s := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' }) {
+			result = append(result, strings.ToLower(s))
+		}
+	}
+	return result
+}
+
+func filterRegexp(values url.Values, key string) (*regexp.Regexp, error) {
+	s := values.Get(key)
+	if s == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(s)
+	return re, errors.Wrapf(err, "%s", key)
+}
+
+// issueOutOfScope returns why a github issue or pull request doesn't sync, or "" if it does;
+// an empty `author` isn't known and doesn't filter
+func (f syncFilters) issueOutOfScope(kind, author, title string, labels []webhookLabel) string {
+	names := []string{}
+	for _, l := range labels {
+		names = append(names, l.Name)
+	}
+	switch {
+	case len(f.GithubKinds) > 0 && !anyFiltered([]string{kind}, f.GithubKinds):
+		return fmt.Sprintf("%s is not one of github_kinds %v", kind, f.GithubKinds)
+	case len(f.GithubLabels) > 0 && !anyFiltered(names, f.GithubLabels):
+		return fmt.Sprintf("labels %v have none of %v", names, f.GithubLabels)
+	case anyFiltered(names, f.GithubExcludeLabels):
+		return fmt.Sprintf("labels %v have one of %v", names, f.GithubExcludeLabels)
+	case author != "" && len(f.GithubAuthors) > 0 && !anyFiltered([]string{author}, f.GithubAuthors):
+		return fmt.Sprintf("author %s is not one of %v", author, f.GithubAuthors)
+	case author != "" && anyFiltered([]string{author}, f.GithubExcludeAuthors):
+		return fmt.Sprintf("author %s is one of %v", author, f.GithubExcludeAuthors)
+	case f.GithubTitle != nil && !f.GithubTitle.MatchString(title):
+		return fmt.Sprintf("title %q does not match %s", title, f.GithubTitle)
+	case f.GithubExcludeTitle != nil && f.GithubExcludeTitle.MatchString(title):
+		return fmt.Sprintf("title %q matches %s", title, f.GithubExcludeTitle)
+	}
+	return ""
+}
+
+// storyOutOfScope is `issueOutOfScope` for a story; tracker webhooks only carry what changed,
+// so an empty `storyType` or `state`, or nil `labels`, isn't known and doesn't filter
+func (f syncFilters) storyOutOfScope(storyType, state string, labels []string) string {
+	switch {
+	case labels != nil && len(f.TrackerLabels) > 0 && !anyFiltered(labels, f.TrackerLabels):
+		return fmt.Sprintf("labels %v have none of %v", labels, f.TrackerLabels)
+	case anyFiltered(labels, f.TrackerExcludeLabels):
+		return fmt.Sprintf("labels %v have one of %v", labels, f.TrackerExcludeLabels)
+	case storyType != "" && len(f.TrackerStoryTypes) > 0 && !anyFiltered([]string{storyType}, f.TrackerStoryTypes):
+		return fmt.Sprintf("story type %s is not one of %v", storyType, f.TrackerStoryTypes)
+	case state != "" && len(f.TrackerStates) > 0 && !anyFiltered([]string{state}, f.TrackerStates):
+		return fmt.Sprintf("state %s is not one of %v", state, f.TrackerStates)
+	case state != "" && anyFiltered([]string{state}, f.TrackerExcludeStates):
+		return fmt.Sprintf("state %s is one of %v", state, f.TrackerExcludeStates)
+	}
+	return ""
+}
+
+// issueScope returns why `issue` is out of scope now, and before this event; a label or
+// title change can move it in or out
+func (f syncFilters) issueScope(issue *webhookIssue) (now, was string) {
+	now = f.issueOutOfScope(githubKindIssue, issue.User.login(), issue.Title, issue.Labels)
+	if issue.labelsWas == nil && issue.titleWas == nil {
+		return now, now
+	}
+	labels, title := issue.Labels, issue.Title
+	if issue.labelsWas != nil {
+		labels = issue.labelsWas
+	}
+	if issue.titleWas != nil {
+		title = *issue.titleWas
+	}
+	return now, f.issueOutOfScope(githubKindIssue, issue.User.login(), title, labels)
+}
+
+// storyScope returns why `story` is out of scope now, and before this event; a label, story
+// type or state change can move it in or out
+func (f syncFilters) storyScope(story *webhookStory) (now, was string) {
+	now = f.storyOutOfScope(story.storyType, story.CurrentState, story.labels)
+	labels, storyType, state := story.labels, story.storyType, story.CurrentState
+	if story.labelsWas != nil {
+		labels = story.labelsWas
+	}
+	if story.storyTypeWas != nil {
+		storyType = *story.storyTypeWas
+	}
+	if story.stateWas != nil {
+		state = *story.stateWas
+	}
+	return now, f.storyOutOfScope(storyType, state, labels)
+}
+
+// anyFiltered tells if any of `values` is in `filters`, which are lowercase
+func anyFiltered(values []string, filters []string) bool {
+	for _, v := range values {
+		for _, f := range filters {
+			if strings.ToLower(v) == f {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trackerLabelNames returns the names of `labels`, or an empty list; never nil since the labels are known
+func trackerLabelNames(labels []trackerLabel) []string {
+	result := []string{}
+	for _, l := range labels {
+		result = append(result, l.Name)
+	}
+	return result
+}
+
+// withoutLabel returns `labels` except `name`
+func withoutLabel(labels []webhookLabel, name string) []webhookLabel {
+	result := []webhookLabel{}
+	for _, l := range labels {
+		if !strings.EqualFold(l.Name, name) {
+			result = append(result, l)
+		}
+	}
+	return result
+}
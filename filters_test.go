@@ -0,0 +1,194 @@
+package githubtracker
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncFiltersFromValues(t *testing.T) {
+	f, err := syncFiltersFromValues(url.Values{
+		"opt_in_label":          {"Tracker"},
+		"github_exclude_labels": {"wontfix, Duplicate\nquestion"},
+		"github_kinds":          {"issue"},
+		"github_title":          {`^\[api\]`},
+		"tracker_story_types":   {"feature bug"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tracker"}, f.GithubLabels)
+	assert.Equal(t, []string{"tracker"}, f.TrackerLabels)
+	assert.Equal(t, []string{"wontfix", "duplicate", "question"}, f.GithubExcludeLabels)
+	assert.Equal(t, []string{"issue"}, f.GithubKinds)
+	assert.Equal(t, []string{"feature", "bug"}, f.TrackerStoryTypes)
+	assert.True(t, f.GithubTitle.MatchString("[api] timeouts"))
+	assert.Nil(t, f.GithubExcludeTitle)
+
+	_, err = syncFiltersFromValues(url.Values{"github_kinds": {"discussion"}})
+	assert.NotNil(t, err)
+	_, err = syncFiltersFromValues(url.Values{"github_title": {"("}})
+	assert.NotNil(t, err)
+}
+
+func TestIssueOutOfScope(t *testing.T) {
+	f, err := syncFiltersFromValues(url.Values{
+		"opt_in_label":           {"tracker"},
+		"github_exclude_labels":  {"wontfix"},
+		"github_exclude_authors": {"dependabot[bot]"},
+		"github_kinds":           {"issue"},
+		"github_exclude_title":   {`(?i)^wip\b`},
+	})
+	assert.Nil(t, err)
+	tracker, wontfix := webhookLabel{Name: "Tracker"}, webhookLabel{Name: "wontfix"}
+	testCases := []struct {
+		name        string
+		givenKind   string
+		givenAuthor string
+		givenTitle  string
+		givenLabels []webhookLabel
+		expected    bool
+	}{
+		{name: "labelled", givenKind: githubKindIssue, givenAuthor: "alice", givenTitle: "hello", givenLabels: []webhookLabel{tracker}, expected: true},
+		{name: "not labelled", givenKind: githubKindIssue, givenAuthor: "alice", givenTitle: "hello"},
+		{name: "excluded label", givenKind: githubKindIssue, givenAuthor: "alice", givenTitle: "hello", givenLabels: []webhookLabel{tracker, wontfix}},
+		{name: "excluded author", givenKind: githubKindIssue, givenAuthor: "Dependabot[bot]", givenTitle: "hello", givenLabels: []webhookLabel{tracker}},
+		{name: "unknown author", givenKind: githubKindIssue, givenTitle: "hello", givenLabels: []webhookLabel{tracker}, expected: true},
+		{name: "pull request", givenKind: githubKindPullRequest, givenAuthor: "alice", givenTitle: "hello", givenLabels: []webhookLabel{tracker}},
+		{name: "excluded title", givenKind: githubKindIssue, givenAuthor: "alice", givenTitle: "WIP hello", givenLabels: []webhookLabel{tracker}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason := f.issueOutOfScope(tc.givenKind, tc.givenAuthor, tc.givenTitle, tc.givenLabels)
+			assert.Equal(t, tc.expected, reason == "", reason)
+		})
+	}
+}
+
+func TestStoryOutOfScope(t *testing.T) {
+	f, err := syncFiltersFromValues(url.Values{
+		"tracker_labels":         {"tracker"},
+		"tracker_story_types":    {"feature", "bug"},
+		"tracker_exclude_states": {"accepted"},
+	})
+	assert.Nil(t, err)
+	testCases := []struct {
+		name           string
+		givenStoryType string
+		givenState     string
+		givenLabels    []string
+		expected       bool
+	}{
+		{name: "in scope", givenStoryType: "feature", givenState: "started", givenLabels: []string{"Tracker"}, expected: true},
+		{name: "nothing known", expected: true},
+		{name: "not labelled", givenStoryType: "feature", givenLabels: []string{}},
+		{name: "chore", givenStoryType: "chore", givenLabels: []string{"tracker"}},
+		{name: "accepted", givenState: "accepted"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason := f.storyOutOfScope(tc.givenStoryType, tc.givenState, tc.givenLabels)
+			assert.Equal(t, tc.expected, reason == "", reason)
+		})
+	}
+}
+
+func TestIssueFilters(t *testing.T) {
+	opts, err := syncOptionsFromValues(url.Values{"opt_in_label": {"tracker"}})
+	assert.Nil(t, err)
+	issue := `"issue":{"title":"hello","body":"some text","html_url":"https://github.com/user123/repo456/issues/1","user":{"login":"alice"},"labels":%s}`
+	testCases := []struct {
+		name            string
+		givenData       string
+		givenFoundStory *trackerSearchResultRow
+		expectedMethods []string
+		expectedBody    string
+	}{
+		{
+			name:            "out of scope",
+			givenData:       `{"action":"edited",` + strings.Replace(issue, "%s", `[]`, 1) + `,"changes":{"body":{"from":"old text"}}}`,
+			expectedMethods: []string{},
+		},
+		{
+			name:            "unlabelled",
+			givenData:       `{"action":"unlabeled","label":{"name":"tracker"},` + strings.Replace(issue, "%s", `[]`, 1) + `}`,
+			givenFoundStory: &trackerSearchResultRow{ID: alwaysString{"42"}, Description: "https://github.com/user123/repo456/issues/1\r\n\r\nsome text"},
+			expectedMethods: []string{"FindStoryByIssueURL", "UpdateStory"},
+			expectedBody:    "some text",
+		},
+		{
+			name:            "labelled",
+			givenData:       `{"action":"labeled","label":{"name":"tracker"},` + strings.Replace(issue, "%s", `[{"name":"tracker"}]`, 1) + `}`,
+			expectedMethods: []string{"FindStory", "CreateIssue"}, // i.e. CreateStory
+			expectedBody:    "https://github.com/user123/repo456/issues/1\r\n\r\nsome text",
+		},
+		{
+			name:            "labelled with something else",
+			givenData:       `{"action":"labeled","label":{"name":"bug"},` + strings.Replace(issue, "%s", `[{"name":"bug"}]`, 1) + `}`,
+			expectedMethods: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logclient := logTrackerClient{ExpectedFoundStory: tc.givenFoundStory}
+			err := WebhookIssueHandler{}.handle([]byte(tc.givenData), &logclient, "https://www.pivotaltracker.com", opts)
+			assert.Nil(t, err)
+			methods := []string{}
+			for _, action := range logclient.History {
+				methods = append(methods, action.Method)
+			}
+			assert.Equal(t, tc.expectedMethods, methods)
+			if len(logclient.History) > 0 {
+				assert.Equal(t, tc.expectedBody, logclient.History[len(logclient.History)-1].GivenBody)
+			}
+		})
+	}
+}
+
+func TestStoryFilters(t *testing.T) {
+	opts, err := syncOptionsFromValues(url.Values{"opt_in_label": {"tracker"}})
+	assert.Nil(t, err)
+	storyURL := "https://www.pivotaltracker.com/story/show/153926473"
+	change := `{"changes":[{"id":153926473,"change_type":"update","kind":"story","story_type":"feature","name":"hello","new_values":{"labels":%s},"original_values":{"labels":%s}}]}`
+	testCases := []struct {
+		name            string
+		givenData       string
+		givenFoundIssue *githubSearchResultRow
+		expectedMethods []string
+		expectedBody    string
+	}{
+		{
+			name:            "unlabelled",
+			givenData:       strings.Replace(strings.Replace(change, "%s", `[]`, 1), "%s", `["tracker"]`, 1),
+			givenFoundIssue: &githubSearchResultRow{Number: 42, Body: storyURL + "\r\n<!-- tracker link: " + storyURL + " version:1 -->\r\n\r\nsome text"},
+			expectedMethods: []string{"FindIssueByTrackerURL", "UpdateIssue"},
+			expectedBody:    "some text",
+		},
+		{
+			name:            "labelled",
+			givenData:       strings.Replace(strings.Replace(change, "%s", `["tracker"]`, 1), "%s", `[]`, 1),
+			expectedMethods: []string{"FindIssue", "CreateIssue"},
+			expectedBody:    storyURL + "\r\n<!-- tracker link: " + storyURL + " version:1 -->\r\n\r\n",
+		},
+		{
+			name:            "labelled with something else",
+			givenData:       strings.Replace(strings.Replace(change, "%s", `["bug"]`, 1), "%s", `[]`, 1),
+			expectedMethods: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logclient := logGithubClient{ExpectedFoundIssue: tc.givenFoundIssue}
+			err := WebhookStoryHandler{}.handle([]byte(tc.givenData), &logclient, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com", opts)
+			assert.Nil(t, err)
+			methods := []string{}
+			for _, action := range logclient.History {
+				methods = append(methods, action.Method)
+			}
+			assert.Equal(t, tc.expectedMethods, methods)
+			if len(logclient.History) > 0 {
+				assert.Equal(t, tc.expectedBody, logclient.History[len(logclient.History)-1].GivenBody)
+			}
+		})
+	}
+}
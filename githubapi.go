@@ -8,17 +8,21 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 type issueDetail struct {
-	Title         string `json:"title,omitempty"`
-	Body          string `json:"body,omitempty"`
-	State         string `json:"state,omitempty"`
+	Title         string   `json:"title,omitempty"`
+	Body          string   `json:"body,omitempty"`
+	State         string   `json:"state,omitempty"`
+	Labels        []string `json:"labels,omitempty"`
 	repo          string
 	id            string
 	searchFilters []string
+	storyURL      string    // to tell issues of the same title apart
+	createdAt     time.Time // of the story, when known
 }
 
 type githubAPIClient interface {
@@ -26,6 +30,9 @@ type githubAPIClient interface {
 	CreateIssue(issue *issueDetail) error
 	UpdateIssue(issue *issueDetail, rs *githubSearchResultRow) error
 	GetIssue(issue *issueDetail, rs *githubSearchResultRow) (*githubGetResult, error)
+	FindIssueByTrackerURL(repo, trackerURL string) (*githubSearchResultRow, error)
+	SearchIssues(query string) ([]githubSearchResultRow, error)
+	ListIssues(repo, state string, page int) ([]githubSearchResultRow, error)
 }
 
 type githubAPI struct {
@@ -41,9 +48,16 @@ type githubSearchResult struct {
 }
 
 type githubSearchResultRow struct {
-	Number int64  `json:"number"`
-	Title  string `json:"title"`
-	Body   string `json:"body"`
+	Number      int64          `json:"number"`
+	Title       string         `json:"title"`
+	Body        string         `json:"body"`
+	HTMLURL     string         `json:"html_url,omitempty"`
+	State       string         `json:"state,omitempty"`
+	Labels      []webhookLabel `json:"labels,omitempty"`
+	PullRequest *struct{}      `json:"pull_request,omitempty"`
+	User        *webhookUser   `json:"user,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
 }
 
 type githubGetResult struct {
@@ -80,27 +94,90 @@ func (g githubAPI) FindIssue(issue *issueDetail) (*githubSearchResultRow, error)
 		}
 
 		expectedTitle = strings.TrimSpace(expectedTitle)
-		var found *githubSearchResultRow
+		found := []githubSearchResultRow{}
 		for _, item := range result.Items {
-			item := item
 			if expectedTitle == strings.TrimSpace(item.Title) {
 				fmt.Printf("found expect=%#v vs found=%#v\n", expectedTitle, item.Title)
-				if found != nil {
-					return nil, multipleMatchesError
-				}
-				found = &item
+				found = append(found, item)
 			} else {
 				fmt.Printf("no match expect=%#v vs found=%#v\n", expectedTitle, item.Title)
 			}
 		}
-		if found != nil {
-			return found, nil
+		switch {
+		case len(found) == 1:
+			return &found[0], nil
+		case len(found) > 1:
+			if picked := pickIssue(issue, found); picked != nil {
+				return picked, nil
+			}
+			return nil, &ambiguousError{Issues: found}
 		}
 	}
 
 	return nil, nil
 }
 
+// FindIssueByTrackerURL returns the issue whose body links to `trackerURL`, e.g. a story url
+func (g githubAPI) FindIssueByTrackerURL(repo, trackerURL string) (*githubSearchResultRow, error) {
+	items, err := g.SearchIssues(fmt.Sprintf("%q in:body is:issue repo:%s", trackerURL, repo))
+	if err != nil {
+		return nil, err
+	}
+
+	var found *githubSearchResultRow
+	for _, item := range items {
+		item := item
+		if !bodyLinksTo(item.Body, trackerURL) {
+			continue
+		}
+		if found != nil {
+			return nil, multipleMatchesError
+		}
+		found = &item
+	}
+	return found, nil
+}
+
+func (g githubAPI) SearchIssues(query string) ([]githubSearchResultRow, error) {
+	targetURL := g.URL + "/search/issues?q=" + url.QueryEscape(query)
+	data, err := g.perform("GET", targetURL, nil, http.StatusOK)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET %s", targetURL)
+	}
+
+	var result githubSearchResult
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal")
+	}
+	return result.Items, nil
+}
+
+// ListIssues returns a page of issues in `repo`, oldest first; `state` is open, closed or all.
+// github lists pull requests as issues too, see `PullRequest`
+func (g githubAPI) ListIssues(repo, state string, page int) ([]githubSearchResultRow, error) {
+	targetURL := fmt.Sprintf("%s/repos/%s/issues?state=%s&sort=created&direction=asc&per_page=100&page=%d", g.URL, repo, state, page)
+	data, err := g.perform("GET", targetURL, nil, http.StatusOK)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET %s", targetURL)
+	}
+
+	var items []githubSearchResultRow
+	if err = json.Unmarshal(data, &items); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal")
+	}
+	return items, nil
+}
+
+// statusError is an unexpected http status from github
+type statusError struct {
+	Wanted int
+	Got    int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("wanted %d but got %d", e.Wanted, e.Got)
+}
+
 func (g githubAPI) perform(method, url string, body []byte, expectedStatus int) ([]byte, error) {
 	log.Println(method, url, string(body))
 	req, err := http.NewRequest(method, url, bytes.NewReader(body))
@@ -123,8 +200,11 @@ func (g githubAPI) perform(method, url string, body []byte, expectedStatus int)
 	}
 	// end debug
 
+	if err = rateLimitFrom(resp); err != nil {
+		return nil, err
+	}
 	if expectedStatus != resp.StatusCode {
-		return nil, errors.Errorf("wanted %d but got %d", expectedStatus, resp.StatusCode)
+		return nil, &statusError{Wanted: expectedStatus, Got: resp.StatusCode}
 	}
 
 	return data, nil
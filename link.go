@@ -0,0 +1,112 @@
+package githubtracker
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// storyLinkVersion is bumped whenever the marker format changes
+const storyLinkVersion = 1
+
+// defaultLinkTemplate renders the visible link the way we always have: the bare story url
+const defaultLinkTemplate = "{{ .URL }}"
+
+// storyLinkMarker matches the marker and the visible link line right above it, if any
+var storyLinkMarker = regexp.MustCompile(`(?m)(?:^.*\n)?<!-- tracker link: (\S+?/story/show/(\d+))((?: \w+:\S+)*) -->`)
+
+// storyLink is what a github issue body knows about its story: a visible link
+// rendered from the installation's `link_template`, then a hidden marker we parse, e.g.
+//
+//	Tracked in PT #153926444
+//	<!-- tracker link: https://www.pivotaltracker.com/story/show/153926444 project:2120247 version:1 -->
+//
+// bodies written before the marker only have the story url as prefix; `Version` is 0 for those
+type storyLink struct {
+	URL       string
+	StoryID   string
+	ProjectID string
+	Version   int
+}
+
+func (l storyLink) marker() string {
+	s := "<!-- tracker link: " + l.URL
+	if l.ProjectID != "" {
+		s += " project:" + l.ProjectID
+	}
+	return s + fmt.Sprintf(" version:%d -->", l.Version)
+}
+
+// render returns the visible link followed by the marker
+func (l storyLink) render(linkTemplate string) (string, error) {
+	t, err := parseLinkTemplate(linkTemplate)
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.Buffer{}
+	if err = t.Execute(&buf, l); err != nil {
+		return "", errors.Wrapf(err, "link template %#v", linkTemplate)
+	}
+	// one line, so stripStoryLink knows where the visible link starts
+	visible := strings.Join(strings.Fields(buf.String()), " ")
+	return visible + "\r\n" + l.marker(), nil
+}
+
+func parseLinkTemplate(s string) (*template.Template, error) {
+	if s == "" {
+		s = defaultLinkTemplate
+	}
+	t, err := template.New("link").Parse(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "link template %#v", s)
+	}
+	return t, nil
+}
+
+// parseStoryLink reads the marker of a github issue body, falling back to the legacy url prefix
+func parseStoryLink(body, trackerHTMLURL string) *storyLink {
+	if m := storyLinkMarker.FindStringSubmatch(body); m != nil {
+		link := storyLink{URL: m[1], StoryID: m[2]}
+		for _, field := range strings.Fields(m[3]) {
+			kv := strings.SplitN(field, ":", 2)
+			switch kv[0] {
+			case "project":
+				link.ProjectID = kv[1]
+			case "version":
+				link.Version, _ = strconv.Atoi(kv[1])
+			}
+		}
+		return &link
+	}
+	if m := bodyStripRegexpFor(trackerHTMLURL).FindStringSubmatch(body); m != nil {
+		return &storyLink{URL: m[0], StoryID: m[1]}
+	}
+	return nil
+}
+
+// stripStoryLink removes the visible link and marker, or the legacy url prefix, from a github issue body.
+// the line right above the marker is the visible link, even if someone edited it; text around them is kept
+func stripStoryLink(body, trackerHTMLURL string) string {
+	if loc := storyLinkMarker.FindStringIndex(body); loc != nil {
+		return body[:loc[0]] + body[loc[1]:]
+	}
+	return bodyStripRegexpFor(trackerHTMLURL).ReplaceAllString(body, "")
+}
+
+// bodyLinksTo tells if a github issue body links to `trackerURL`, e.g. a story or epic url
+func bodyLinksTo(body, trackerURL string) bool {
+	if m := storyLinkMarker.FindStringSubmatch(body); m != nil {
+		return m[1] == trackerURL
+	}
+	return hasLinkPrefix(body, trackerURL)
+}
+
+// hasLinkPrefix tells if `s` starts with `linkURL`, e.g. a PT story description with its GH issue url
+func hasLinkPrefix(s, linkURL string) bool {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(linkURL) + `(\D|$)`).MatchString(s)
+}
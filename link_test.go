@@ -0,0 +1,89 @@
+package githubtracker
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoryLink(t *testing.T) {
+	trackerHTMLURL := "https://www.pivotaltracker.com"
+	storyURL := "https://www.pivotaltracker.com/story/show/153926444"
+	marker := "<!-- tracker link: " + storyURL + " project:2120247 version:1 -->"
+
+	testCases := []struct {
+		givenBody        string
+		expectedLink     *storyLink
+		expectedStripped string
+	}{
+		{
+			givenBody:        "no link here",
+			expectedLink:     nil,
+			expectedStripped: "no link here",
+		},
+		{
+			givenBody:        storyURL + "\r\n\r\nlegacy body",
+			expectedLink:     &storyLink{URL: storyURL, StoryID: "153926444"},
+			expectedStripped: "\r\n\r\nlegacy body",
+		},
+		{
+			givenBody:        "Tracked in PT #153926444\r\n" + marker + "\r\n\r\nnew body",
+			expectedLink:     &storyLink{URL: storyURL, StoryID: "153926444", ProjectID: "2120247", Version: 1},
+			expectedStripped: "\r\n\r\nnew body",
+		},
+		{
+			givenBody:        "someone reworded the visible link\r\n" + marker + "\r\n\r\nnew body",
+			expectedLink:     &storyLink{URL: storyURL, StoryID: "153926444", ProjectID: "2120247", Version: 1},
+			expectedStripped: "\r\n\r\nnew body",
+		},
+		{
+			givenBody:        "a note above the link\r\n\r\nTracked in PT #153926444\r\n" + marker + "\r\n\r\nnew body",
+			expectedLink:     &storyLink{URL: storyURL, StoryID: "153926444", ProjectID: "2120247", Version: 1},
+			expectedStripped: "a note above the link\r\n\r\n\r\n\r\nnew body",
+		},
+		{
+			givenBody:        marker + "\r\n\r\nno visible link",
+			expectedLink:     &storyLink{URL: storyURL, StoryID: "153926444", ProjectID: "2120247", Version: 1},
+			expectedStripped: "\r\n\r\nno visible link",
+		},
+		{
+			givenBody:        "https://www.pivotaltracker.com/story/show/1\r\n" + marker + "\r\n\r\nmarker wins",
+			expectedLink:     &storyLink{URL: storyURL, StoryID: "153926444", ProjectID: "2120247", Version: 1},
+			expectedStripped: "\r\n\r\nmarker wins",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.givenBody, func(t *testing.T) {
+			assert.Equal(t, tc.expectedLink, parseStoryLink(tc.givenBody, trackerHTMLURL))
+			assert.Equal(t, tc.expectedStripped, stripStoryLink(tc.givenBody, trackerHTMLURL))
+			if tc.expectedLink != nil {
+				assert.True(t, bodyLinksTo(tc.givenBody, storyURL))
+				assert.False(t, bodyLinksTo(tc.givenBody, storyURL+"0"))
+			}
+		})
+	}
+}
+
+func TestStoryLinkRender(t *testing.T) {
+	link := storyLink{URL: "https://www.pivotaltracker.com/story/show/153926444", StoryID: "153926444", ProjectID: "2120247", Version: storyLinkVersion}
+
+	s, err := link.render("")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://www.pivotaltracker.com/story/show/153926444\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926444 project:2120247 version:1 -->", s)
+	assert.Equal(t, &link, parseStoryLink(s+"\r\n\r\nbody", ""))
+
+	s, err = link.render("![PT](https://img.shields.io/badge/PT-{{ .StoryID }}-blue)")
+	assert.Nil(t, err)
+	assert.Equal(t, "![PT](https://img.shields.io/badge/PT-153926444-blue)\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926444 project:2120247 version:1 -->", s)
+	assert.Equal(t, "\r\n\r\nbody", stripStoryLink(s+"\r\n\r\nbody", ""))
+
+	s, err = link.render("Tracked in\n[PT #{{ .StoryID }}]({{ .URL }})\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "Tracked in [PT #153926444](https://www.pivotaltracker.com/story/show/153926444)\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926444 project:2120247 version:1 -->", s)
+
+	_, err = syncOptionsFromValues(url.Values{"link_template": []string{"{{ .Nope }}"}})
+	assert.NotNil(t, err)
+	_, err = syncOptionsFromValues(url.Values{"link_template": []string{"{{ .URL "}})
+	assert.NotNil(t, err)
+}
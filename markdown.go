@@ -0,0 +1,226 @@
+package githubtracker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// github-flavored markdown that pivotal tracker renders badly, and what we write instead
+var (
+	// e.g. "#12" or "user123/repo456#12"; longer numbers are likely pivotal tracker story ids
+	issueRefText = regexp.MustCompile(`(^|[^\w/\[#&])((?:([\w.-]+/[\w.-]+))?#(\d{1,7}))\b`)
+	issueRefLink = regexp.MustCompile(`\[((?:[\w.-]+/[\w.-]+)?#\d{1,7})\]\((\S+?)\)`)
+
+	linkTarget     = regexp.MustCompile(`(\]\(|\b(?:src|href)=")([^)"\s]+)`)
+	absoluteTarget = regexp.MustCompile(`^(?i:[a-z][a-z0-9+.-]*:|#)`)
+
+	taskListItem    = regexp.MustCompile(`^(\s*[-*+] )\[([ xX])\] `)
+	trackerListItem = regexp.MustCompile(`^(\s*[-*+] )([☐☑]) `)
+
+	detailsOpen   = regexp.MustCompile(`(?s)<details>\s*<summary>(.*?)</summary>`)
+	detailsClose  = regexp.MustCompile(`</details>`)
+	trackerOpen   = regexp.MustCompile(`\*\*▸ (.*?)\*\*`)
+	trackerClose  = regexp.MustCompile(`\*\*◂\*\*`)
+	tableRow      = regexp.MustCompile(`^\s*\|.*\|\s*$`)
+	tableDivider  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	codeFence     = regexp.MustCompile("^\\s*(```|~~~)")
+	inlineCode    = regexp.MustCompile("`[^`\n]*`")
+	emojiName     = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+	tableFenceTag = "```table"
+)
+
+// emojiMark follows the emoji that were shortcodes, so only those become shortcodes again;
+// emoji typed as such stay as they are
+const emojiMark = "\u200b" // zero width space
+
+var emojiByName = map[string]string{
+	"+1":               "👍",
+	"-1":               "👎",
+	"bug":              "🐛",
+	"eyes":             "👀",
+	"fire":             "🔥",
+	"heart":            "❤️",
+	"rocket":           "🚀",
+	"smile":            "😄",
+	"tada":             "🎉",
+	"warning":          "⚠️",
+	"white_check_mark": "✅",
+	"x":                "❌",
+}
+
+// markdownToTracker rewrites a github issue body for a pivotal tracker story description,
+// `repoURL` is e.g. https://github.com/user123/repo456
+func markdownToTracker(body, repoURL string, mentions people) string {
+	lines := strings.Split(body, "\n")
+	result := []string{}
+	inFence := false
+	for i := 0; i < len(lines); i++ {
+		line, cr := trimCR(lines[i])
+		if codeFence.MatchString(line) {
+			inFence = !inFence
+			result = append(result, line+cr)
+			continue
+		}
+		if inFence {
+			result = append(result, line+cr)
+			continue
+		}
+
+		// tables become preformatted text
+		if tableRow.MatchString(line) && i+1 < len(lines) && tableDivider.MatchString(strings.TrimSuffix(lines[i+1], "\r")) {
+			result = append(result, tableFenceTag+cr)
+			for ; i < len(lines) && tableRow.MatchString(strings.TrimSuffix(lines[i], "\r")); i++ {
+				result = append(result, lines[i])
+			}
+			i--
+			result = append(result, "```"+cr)
+			continue
+		}
+
+		line = taskListItem.ReplaceAllStringFunc(line, func(s string) string {
+			m := taskListItem.FindStringSubmatch(s)
+			if m[2] == " " {
+				return m[1] + "☐ "
+			}
+			return m[1] + "☑ "
+		})
+		line = outsideInlineCode(line, func(s string) string {
+			s = linkTarget.ReplaceAllStringFunc(s, func(t string) string {
+				m := linkTarget.FindStringSubmatch(t)
+				return m[1] + absoluteURL(m[2], repoURL)
+			})
+			s = issueRefText.ReplaceAllStringFunc(s, func(t string) string {
+				m := issueRefText.FindStringSubmatch(t)
+				return m[1] + "[" + m[2] + "](" + issueRefURL(m[3], m[4], repoURL) + ")"
+			})
+			s = mentions.mentionsToTracker(s)
+			return emojiName.ReplaceAllStringFunc(s, func(t string) string {
+				if e, ok := emojiByName[strings.Trim(t, ":")]; ok {
+					return e + emojiMark
+				}
+				return t
+			})
+		})
+		result = append(result, line+cr)
+	}
+
+	body = strings.Join(result, "\n")
+	body = detailsOpen.ReplaceAllString(body, "**▸ $1**")
+	return detailsClose.ReplaceAllString(body, "**◂**")
+}
+
+// markdownToGithub reverses markdownToTracker for a pivotal tracker story description
+func markdownToGithub(description, repoURL string, mentions people) string {
+	lines := strings.Split(description, "\n")
+	result := []string{}
+	inFence, inTable := false, false
+	for _, line := range lines {
+		line, cr := trimCR(line)
+		if !inFence && strings.TrimSpace(line) == tableFenceTag {
+			inTable = true
+			continue
+		}
+		if inTable {
+			if codeFence.MatchString(line) {
+				inTable = false
+				continue
+			}
+			result = append(result, line+cr)
+			continue
+		}
+		if codeFence.MatchString(line) {
+			inFence = !inFence
+			result = append(result, line+cr)
+			continue
+		}
+		if inFence {
+			result = append(result, line+cr)
+			continue
+		}
+
+		line = trackerListItem.ReplaceAllStringFunc(line, func(s string) string {
+			m := trackerListItem.FindStringSubmatch(s)
+			if m[2] == "☐" {
+				return m[1] + "[ ] "
+			}
+			return m[1] + "[x] "
+		})
+		line = outsideInlineCode(line, func(s string) string {
+			s = issueRefLink.ReplaceAllStringFunc(s, func(t string) string {
+				m := issueRefLink.FindStringSubmatch(t)
+				ref := issueRefText.FindStringSubmatch(m[1])
+				if ref == nil || issueRefURL(ref[3], ref[4], repoURL) != m[2] {
+					return t
+				}
+				return m[1]
+			})
+			s = linkTarget.ReplaceAllStringFunc(s, func(t string) string {
+				m := linkTarget.FindStringSubmatch(t)
+				return m[1] + strings.TrimPrefix(m[2], repoURL+"/blob/HEAD/")
+			})
+			for name, e := range emojiByName {
+				s = strings.Replace(s, e+emojiMark, ":"+name+":", -1)
+			}
+			return mentions.mentionsToGithub(s)
+		})
+		result = append(result, line+cr)
+	}
+
+	description = strings.Join(result, "\n")
+	description = trackerOpen.ReplaceAllString(description, "<details><summary>$1</summary>")
+	return trackerClose.ReplaceAllString(description, "</details>")
+}
+
+func trimCR(line string) (string, string) {
+	if strings.HasSuffix(line, "\r") {
+		return strings.TrimSuffix(line, "\r"), "\r"
+	}
+	return line, ""
+}
+
+// outsideInlineCode applies `fn` to parts of `line` that are not `inline code`
+func outsideInlineCode(line string, fn func(string) string) string {
+	result := ""
+	last := 0
+	for _, loc := range inlineCode.FindAllStringIndex(line, -1) {
+		result = result + fn(line[last:loc[0]]) + line[loc[0]:loc[1]]
+		last = loc[1]
+	}
+	return result + fn(line[last:])
+}
+
+// absoluteURL resolves links relative to the repository, e.g. "docs/setup.md"
+func absoluteURL(target, repoURL string) string {
+	if absoluteTarget.MatchString(target) || strings.HasPrefix(target, "//") {
+		return target
+	}
+	if strings.HasPrefix(target, "/") {
+		return hostURL(repoURL) + target
+	}
+	return repoURL + "/blob/HEAD/" + strings.TrimPrefix(target, "./")
+}
+
+// issueRefURL returns the url of issue `number` in `ownerRepo`, or in `repoURL` if blank
+func issueRefURL(ownerRepo, number, repoURL string) string {
+	if ownerRepo == "" {
+		return repoURL + "/issues/" + number
+	}
+	return hostURL(repoURL) + "/" + ownerRepo + "/issues/" + number
+}
+
+// hostURL returns e.g. https://github.com for https://github.com/user123/repo456
+func hostURL(repoURL string) string {
+	parts := strings.Split(strings.TrimRight(repoURL, "/"), "/")
+	if len(parts) < 5 {
+		return repoURL
+	}
+	return strings.Join(parts[:len(parts)-2], "/")
+}
+
+// repoURLOf returns e.g. https://github.com/user123/repo456 for https://github.com/user123/repo456/issues/1
+func repoURLOf(issueURL string) string {
+	if i := strings.LastIndex(issueURL, "/issues/"); i > 0 {
+		return issueURL[:i]
+	}
+	return issueURL
+}
@@ -0,0 +1,71 @@
+package githubtracker
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownTranslation(t *testing.T) {
+	repoURL := "https://github.com/user123/repo456"
+	testCases := []struct {
+		givenGithub     string
+		expectedTracker string
+		expectedGithub  string // if not the same as `givenGithub`
+	}{
+		{
+			givenGithub:     "see #12 and acme/api#3, not [Finishes #153984041] or &#35;",
+			expectedTracker: "see [#12](https://github.com/user123/repo456/issues/12) and [acme/api#3](https://github.com/acme/api/issues/3), not [Finishes #153984041] or &#35;",
+		},
+		{
+			givenGithub:     "![shot](docs/shot.png) [wiki](/acme/api/wiki) [site](https://example.com) [top](#top) <img src=\"img/a.png\">",
+			expectedTracker: "![shot](https://github.com/user123/repo456/blob/HEAD/docs/shot.png) [wiki](https://github.com/acme/api/wiki) [site](https://example.com) [top](#top) <img src=\"https://github.com/user123/repo456/blob/HEAD/img/a.png\">",
+			expectedGithub:  "![shot](docs/shot.png) [wiki](https://github.com/acme/api/wiki) [site](https://example.com) [top](#top) <img src=\"img/a.png\">",
+		},
+		{
+			givenGithub:     "todo\r\n- [ ] one\r\n- [x] two\r\n  * [ ] nested",
+			expectedTracker: "todo\r\n- ☐ one\r\n- ☑ two\r\n  * ☐ nested",
+		},
+		{
+			givenGithub:     "before\r\n| a | b |\r\n|---|:-:|\r\n| 1 | #2 |\r\nafter",
+			expectedTracker: "before\r\n```table\r\n| a | b |\r\n|---|:-:|\r\n| 1 | #2 |\r\n```\r\nafter",
+		},
+		{
+			givenGithub:     "<details><summary>Logs</summary>\r\n\r\nstack trace\r\n</details>",
+			expectedTracker: "**▸ Logs**\r\n\r\nstack trace\r\n**◂**",
+		},
+		{
+			givenGithub:     ":tada: done :notanemoji: at 10:30:00 :+1:",
+			expectedTracker: "🎉\u200b done :notanemoji: at 10:30:00 👍\u200b",
+		},
+		{
+			givenGithub:     "typed 🚀 and ❤️, not :rocket:",
+			expectedTracker: "typed 🚀 and ❤️, not 🚀\u200b",
+		},
+		{
+			givenGithub:     "`#12 :tada:` stays\n```\n#12 - [ ] :tada:\n```\n#12",
+			expectedTracker: "`#12 :tada:` stays\n```\n#12 - [ ] :tada:\n```\n[#12](https://github.com/user123/repo456/issues/12)",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual := markdownToTracker(tc.givenGithub, repoURL, nil)
+			assert.Equal(t, tc.expectedTracker, actual)
+			expectedGithub := tc.expectedGithub
+			if expectedGithub == "" {
+				expectedGithub = tc.givenGithub
+			}
+			assert.Equal(t, expectedGithub, markdownToGithub(actual, repoURL, nil))
+			assert.Equal(t, actual, markdownToTracker(markdownToGithub(actual, repoURL, nil), repoURL, nil))
+		})
+	}
+}
+
+func TestMarkdownTranslationKeepsTrackerEmoji(t *testing.T) {
+	repoURL := "https://github.com/user123/repo456"
+	description := "shipped 🚀 🎉 ✅"
+	assert.Equal(t, description, markdownToGithub(description, repoURL, nil))
+	assert.Equal(t, description, markdownToTracker(markdownToGithub(description, repoURL, nil), repoURL, nil))
+}
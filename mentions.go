@@ -0,0 +1,75 @@
+package githubtracker
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// e.g. "@alice", but not "alice@example.com"
+var mentionText = regexp.MustCompile(`(^|[^\w@/.` + "`" + `])@([A-Za-z0-9][\w-]*)`)
+
+// mentionMark keeps an unknown mention from notifying anyone on the other side, e.g. "@\u200bcarol";
+// it is taken out again on the way back, where the mention came from
+const mentionMark = "@\u200b" // zero width space
+
+// people maps github logins to pivotal tracker usernames, e.g. "alice" => "ab"
+type people map[string]string
+
+// peopleFromValues reads `people` values, one "github_login pt_username" per line; a PT username
+// can only be one GH login, else mentions of it would go back to either
+func peopleFromValues(values url.Values) (people, error) {
+	result := people{}
+	logins := map[string]string{}
+	for _, value := range values["people"] {
+		for _, line := range strings.Split(value, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			login, username := strings.ToLower(strings.TrimPrefix(fields[0], "@")), strings.TrimPrefix(fields[1], "@")
+			if other, ok := logins[strings.ToLower(username)]; ok && other != login {
+				return nil, errors.Errorf("people: %s and %s are both PT user %q", other, login, username)
+			}
+			logins[strings.ToLower(username)] = login
+			result[login] = username
+		}
+	}
+	return result, nil
+}
+
+// mentionsToTracker rewrites @github_login into @pt_username; unknown mentions don't notify, see `mentionMark`
+func (p people) mentionsToTracker(s string) string {
+	return replaceMentions(s, func(login string) string {
+		return p[strings.ToLower(login)]
+	})
+}
+
+// mentionsToGithub rewrites @pt_username into @github_login; unknown mentions don't notify, see `mentionMark`
+func (p people) mentionsToGithub(s string) string {
+	return replaceMentions(s, func(username string) string {
+		for login, u := range p {
+			if strings.EqualFold(u, username) {
+				return login
+			}
+		}
+		return ""
+	})
+}
+
+// replaceMentions also takes the mark out of mentions marked on the other side
+func replaceMentions(s string, lookup func(string) string) string {
+	parts := strings.Split(s, mentionMark)
+	for i, part := range parts {
+		parts[i] = mentionText.ReplaceAllStringFunc(part, func(t string) string {
+			m := mentionText.FindStringSubmatch(t)
+			if name := lookup(m[2]); name != "" {
+				return m[1] + "@" + name
+			}
+			return m[1] + mentionMark + m[2] // never notify the wrong person
+		})
+	}
+	return strings.Join(parts, "@")
+}
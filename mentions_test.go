@@ -0,0 +1,74 @@
+package githubtracker
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeopleFromValues(t *testing.T) {
+	values := url.Values{"people": []string{"@Alice ab\r\nbob @bc\n\nnonsense"}}
+	p, err := peopleFromValues(values)
+	assert.Nil(t, err)
+	assert.Equal(t, people{"alice": "ab", "bob": "bc"}, p)
+
+	// the same line twice is fine, but a PT username of two logins can't be mentioned back
+	_, err = peopleFromValues(url.Values{"people": []string{"alice ab\nalice ab"}})
+	assert.Nil(t, err)
+	_, err = peopleFromValues(url.Values{"people": []string{"alice ab\nbob AB"}})
+	if assert.NotNil(t, err) {
+		assert.Equal(t, `people: alice and bob are both PT user "AB"`, err.Error())
+	}
+	_, err = syncOptionsFromValues(url.Values{"people": []string{"alice ab\nbob ab"}})
+	assert.NotNil(t, err)
+}
+
+func TestMentions(t *testing.T) {
+	mentions := people{"alice": "ab", "bob": "bc"}
+	repoURL := "https://github.com/user123/repo456"
+	testCases := []struct {
+		givenGithub     string
+		expectedTracker string
+		expectedGithub  string
+	}{
+		{
+			givenGithub:     "@alice please review, cc @Bob",
+			expectedTracker: "@ab please review, cc @bc",
+			expectedGithub:  "@alice please review, cc @bob",
+		},
+		{
+			givenGithub:     "@carol and alice@example.com and `@alice`",
+			expectedTracker: "@\u200bcarol and alice@example.com and `@alice`",
+			expectedGithub:  "@carol and alice@example.com and `@alice`",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			actual := markdownToTracker(tc.givenGithub, repoURL, mentions)
+			assert.Equal(t, tc.expectedTracker, actual)
+			assert.Equal(t, tc.expectedGithub, markdownToGithub(actual, repoURL, mentions))
+		})
+	}
+
+	// pt mentions of people without a github login never reach github as a ping
+	assert.Equal(t, "ask @\u200bzz", markdownToGithub("ask @zz", repoURL, mentions))
+	assert.Equal(t, "ask @zz", markdownToTracker(markdownToGithub("ask @zz", repoURL, mentions), repoURL, mentions))
+}
+
+func TestMentionsRoundTrip(t *testing.T) {
+	mentions := people{"alice": "ab"}
+	repoURL := "https://github.com/user123/repo456"
+	for _, body := range []string{
+		"@carol and @dave, cc @alice",
+		"@carol wrote `@carol` in code",
+		"already (@carol)\r\n- [ ] @carol to check",
+	} {
+		tracker := markdownToTracker(body, repoURL, mentions)
+		assert.NotContains(t, tracker, "@carol ", "never notifies carol on PT")
+		assert.Equal(t, body, markdownToGithub(tracker, repoURL, mentions), "GH to PT to GH")
+		assert.Equal(t, tracker, markdownToTracker(markdownToGithub(tracker, repoURL, mentions), repoURL, mentions), "PT to GH to PT")
+	}
+}
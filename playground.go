@@ -0,0 +1,180 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// PlaygroundHandler shows what a raw GH or PT webhook payload translates into, without
+// calling any api. Options are read from the query string, like the webhook urls but unencrypted,
+// e.g. `POST /playground/?repo=user/repo&people=...` with the payload as body
+type PlaygroundHandler struct {
+}
+
+// playgroundIssue is what `parseWebhookIssue` and `ptStoryFromWebhookIssue` produced
+type playgroundIssue struct {
+	Source         string            `json:"source"`
+	Issue          *webhookIssue     `json:"issue"`
+	IsOpened       bool              `json:"is_opened"`
+	IsClosed       bool              `json:"is_closed"`
+	TitleWas       *string           `json:"title_was,omitempty"`
+	Story          *storyDetail      `json:"story"`
+	SearchFilters  []string          `json:"search_filters,omitempty"`
+	TaskChanges    []checklistChange `json:"task_changes,omitempty"`
+	BlockerChanges []checklistChange `json:"blocker_changes,omitempty"`
+	Note           string            `json:"note,omitempty"`
+}
+
+// playgroundStory is what `parseWebhookStory` and `ghIssueFromWebhookStory` produced
+type playgroundStory struct {
+	Source         string            `json:"source"`
+	Story          *webhookStory     `json:"story"`
+	ProjectID      string            `json:"project_id,omitempty"`
+	TitleWas       *string           `json:"title_was,omitempty"`
+	LabelsAdded    []string          `json:"labels_added,omitempty"`
+	LabelsRemoved  []string          `json:"labels_removed,omitempty"`
+	Issue          *issueDetail      `json:"issue"`
+	IssueNumber    string            `json:"issue_number,omitempty"`
+	SearchFilters  []string          `json:"search_filters,omitempty"`
+	TaskChanges    []checklistChange `json:"task_changes,omitempty"`
+	BlockerChanges []checklistChange `json:"blocker_changes,omitempty"`
+	Note           string            `json:"note,omitempty"`
+}
+
+func (s PlaygroundHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "POST a github or pivotaltracker webhook payload", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	values := r.URL.Query()
+	opts, err := syncOptionsFromValues(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	githubHTMLURL := valueOr(values.Get("github_html_url"), "https://github.com")
+	trackerHTMLURL := valueOr(values.Get("tracker_html_url"), "https://www.pivotaltracker.com")
+
+	var result interface{}
+	source := values.Get("source")
+	if source == "" {
+		source = payloadSource(r.Header, data)
+	}
+	switch source {
+	case "github":
+		result, err = s.issue(data, trackerHTMLURL, opts)
+	default:
+		result, err = s.story(data, values.Get("repo"), githubHTMLURL, trackerHTMLURL, opts)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
+}
+
+func (s PlaygroundHandler) issue(data []byte, trackerHTMLURL string, opts syncOptions) (*playgroundIssue, error) {
+	result := &playgroundIssue{Source: "github"}
+	issue, err := parseWebhookIssue(data, trackerHTMLURL)
+	if err != nil {
+		return nil, err
+	}
+	if issue == nil {
+		result.Note = "not an issue event, or skipped because of " + noStorySuffix
+		return result, nil
+	}
+	issue.opts = opts
+	result.Issue = issue
+	if now, was := opts.Filters.issueScope(issue); now != "" {
+		result.Note = "out of the sync filters: " + now
+		if was == "" {
+			result.Note += "; its story gets unlinked"
+		}
+		return result, nil
+	}
+	result.IsOpened, result.IsClosed, result.TitleWas = issue.isOpened, issue.isClosed, issue.titleWas
+	if issue.isDeleted {
+		result.Note = "deleted issues are handled by on_issue_deleted=" + opts.OnIssueDeleted
+		return result, nil
+	}
+
+	story, err := ptStoryFromWebhookIssue(issue)
+	if err != nil {
+		return nil, err
+	}
+	if story == nil {
+		result.Note = "nothing to sync"
+		return result, nil
+	}
+	result.Story = story
+	result.SearchFilters = story.SearchFilters
+	result.TaskChanges = story.TaskChanges
+	result.BlockerChanges = story.BlockerChanges
+	return result, nil
+}
+
+func (s PlaygroundHandler) story(data []byte, repo, githubHTMLURL, trackerHTMLURL string, opts syncOptions) (*playgroundStory, error) {
+	result := &playgroundStory{Source: "pivotaltracker"}
+	story, err := parseWebhookStory(data, githubHTMLURL, trackerHTMLURL)
+	if err != nil {
+		return nil, err
+	}
+	if story == nil {
+		result.Note = "not a story event"
+		return result, nil
+	}
+	story.opts = opts
+	result.Story = story
+	if now, was := opts.Filters.storyScope(story); now != "" && !story.isMoved && story.CurrentState != changeTypeDelete {
+		result.Note = "out of the sync filters: " + now
+		if was == "" {
+			result.Note += "; its issue gets unlinked"
+		}
+		return result, nil
+	}
+	result.ProjectID, result.TitleWas = story.projectID, story.titleWas
+	result.LabelsAdded, result.LabelsRemoved = story.labelsAdded, story.labelsRemoved
+	result.TaskChanges, result.BlockerChanges = story.taskChanges, story.blockerChanges
+
+	issue, err := ghIssueFromWebhookStory(*story, repo, githubHTMLURL)
+	if err != nil {
+		return nil, err
+	}
+	result.Issue = issue
+	result.IssueNumber = issue.id
+	result.SearchFilters = issue.searchFilters
+	return result, nil
+}
+
+// payloadSource tells github payloads from pivotaltracker ones
+func payloadSource(header http.Header, data []byte) string {
+	if header.Get("X-GitHub-Event") != "" {
+		return "github"
+	}
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(data, &payload); err == nil {
+		for _, key := range []string{"issue", "repository", "sender"} {
+			if _, ok := payload[key]; ok {
+				return "github"
+			}
+		}
+	}
+	return "pivotaltracker"
+}
+
+func valueOr(s, defaultValue string) string {
+	if s = strings.TrimSpace(s); s != "" {
+		return s
+	}
+	return defaultValue
+}
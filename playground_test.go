@@ -0,0 +1,88 @@
+package githubtracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaygroundHandler(t *testing.T) {
+	testCases := []struct {
+		givenFile     string
+		givenQuery    string
+		expectedCode  int
+		expectedJSON  map[string]interface{}
+		expectedTitle string
+		expectedBody  string
+	}{
+		{
+			givenFile:    "testdata/github/issues.new.json",
+			expectedCode: http.StatusOK,
+			expectedJSON: map[string]interface{}{
+				"source":         "github",
+				"search_filters": []interface{}{`name:"users.email should have unique constraint"`},
+			},
+			expectedTitle: "users.email should have unique constraint",
+			expectedBody:  "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five",
+		},
+		{
+			givenFile:    "testdata/github/issues.assigned.json",
+			expectedCode: http.StatusOK,
+			expectedJSON: map[string]interface{}{
+				"source": "github",
+				"note":   "nothing to sync",
+			},
+		},
+		{
+			givenFile:    "testdata/tracker/story_update_activity.json",
+			givenQuery:   "?repo=user123/repo456",
+			expectedCode: http.StatusOK,
+			expectedJSON: map[string]interface{}{
+				"source":       "pivotaltracker",
+				"issue_number": nil,
+			},
+			expectedTitle: "Hey, World!",
+		},
+		{
+			givenFile:    "testdata/github/issues.new.json",
+			givenQuery:   "?link_template={{",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.givenFile+tc.givenQuery, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.givenFile)
+			assert.Nil(t, err)
+			r := httptest.NewRequest("POST", "/playground/"+tc.givenQuery, bytes.NewReader(data))
+			w := httptest.NewRecorder()
+			PlaygroundHandler{}.ServeHTTP(w, r)
+			assert.Equal(t, tc.expectedCode, w.Code)
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+
+			result := map[string]interface{}{}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &result))
+			for k, v := range tc.expectedJSON {
+				assert.Equal(t, v, result[k], k)
+			}
+			if tc.expectedTitle == "" {
+				return
+			}
+			if result["source"] == "github" {
+				story, _ := result["story"].(map[string]interface{})
+				assert.Equal(t, tc.expectedTitle, story["name"])
+				assert.Equal(t, tc.expectedBody, story["description"])
+			} else {
+				issue, _ := result["issue"].(map[string]interface{})
+				assert.Equal(t, tc.expectedTitle, issue["title"])
+			}
+		})
+	}
+}
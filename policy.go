@@ -0,0 +1,210 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// policy values
+const (
+	policyKeep        = "keep" // leave the story or issue state alone
+	issueStateOpen    = "open"
+	issueStateClosed  = "closed"
+	unestimatedPolicy = "unestimated_feature"
+)
+
+// statePolicy decides how story and issue states follow each other; missing
+// entries fall back to `defaultStatePolicy`, e.g.
+//
+//	{"close": {"unestimated_feature": "keep"}, "keep_unestimated_features": true, "issue_state": {"delivered": "closed"}}
+//
+// a reopen state PT only allows from some states, i.e. rejected from delivered, falls back to
+// `ReopenFallback` from the others, e.g. {"reopen": {"feature": "rejected"}, "reopen_fallback": {"feature": "keep"}}
+type statePolicy struct {
+	Close                   map[string]string `json:"close,omitempty"`           // story type => story state, when issue is closed
+	Reopen                  map[string]string `json:"reopen,omitempty"`          // story type => story state, when issue is reopened
+	ReopenFallback          map[string]string `json:"reopen_fallback,omitempty"` // story type => story state, when `Reopen` can't be used
+	IssueState              map[string]string `json:"issue_state,omitempty"`     // story state => issue state
+	KeepUnestimatedFeatures bool              `json:"keep_unestimated_features,omitempty"`
+}
+
+var defaultStatePolicy = statePolicy{
+	Close: map[string]string{
+		storyTypeFeature:  storyStateFinished,
+		storyTypeBug:      storyStateAccepted,
+		storyTypeChore:    storyStateAccepted,
+		storyTypeRelease:  storyStateAccepted,
+		unestimatedPolicy: storyStateAccepted, // as a chore
+	},
+	Reopen: map[string]string{
+		storyTypeFeature: storyStateStarted,
+		storyTypeBug:     storyStateStarted,
+		storyTypeChore:   storyStateStarted,
+	},
+	IssueState: map[string]string{
+		storyStateAccepted:    issueStateClosed,
+		storyStateRejected:    issueStateOpen,
+		storyStatePlanned:     issueStateOpen,
+		storyStateStarted:     issueStateOpen,
+		storyStateUnstarted:   issueStateOpen,
+		storyStateUnscheduled: issueStateOpen,
+		// e.g. a merged pull request may close an issue, marking story=finished
+		//      it isn't right to re-open issue again
+		// e.g. if story is marked as finished, but not accepted by product owner
+		//      it isn't right to reach in and close issue too
+		storyStateFinished:  policyKeep,
+		storyStateDelivered: policyKeep,
+	},
+}
+
+// legal states in pivotal tracker
+var (
+	storyStates = []string{storyStateUnscheduled, storyStateUnstarted, storyStatePlanned, storyStateStarted,
+		storyStateFinished, storyStateDelivered, storyStateRejected, storyStateAccepted}
+	choreStates       = []string{storyStateUnscheduled, storyStateUnstarted, storyStatePlanned, storyStateStarted, storyStateAccepted}
+	unestimatedStates = []string{storyStateUnscheduled, storyStateUnstarted, storyStatePlanned}
+
+	// stories move from these states when their issue is closed, or reopened
+	closeFromStates  = []string{storyStateStarted, storyStatePlanned, storyStateUnstarted, storyStateUnscheduled, storyStateRejected}
+	reopenFromStates = []string{storyStateFinished, storyStateDelivered, storyStateAccepted}
+
+	// onlyFrom are the states pivotal tracker only moves stories into from some others
+	onlyFrom = map[string][]string{
+		storyStateRejected: {storyStateDelivered},
+	}
+)
+
+func statePolicyFromValues(values url.Values) (statePolicy, error) {
+	p := statePolicy{}
+	if s := values.Get("policy"); s != "" {
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			return p, errors.Wrapf(err, "policy")
+		}
+	}
+	return p, p.validate()
+}
+
+func lookup(m, defaults map[string]string, key string) string {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return defaults[key]
+}
+
+// closedStoryState returns the story state to use when its issue is closed, or `policyKeep`
+func (p statePolicy) closedStoryState(storyType string, estimated bool) string {
+	if storyType == storyTypeFeature && !estimated {
+		return lookup(p.Close, defaultStatePolicy.Close, unestimatedPolicy)
+	}
+	return lookup(p.Close, defaultStatePolicy.Close, storyType)
+}
+
+// reopenedStoryState returns the story state to use when its issue is reopened, or `policyKeep`,
+// for a story that is `currentState`
+func (p statePolicy) reopenedStoryState(storyType, currentState string) string {
+	state := lookup(p.Reopen, defaultStatePolicy.Reopen, storyType)
+	if allowed, ok := onlyFrom[state]; ok && !oneOf(currentState, allowed...) {
+		return lookup(p.ReopenFallback, defaultStatePolicy.Reopen, storyType)
+	}
+	return state
+}
+
+// issueState returns "open", "closed" or `policyKeep` for a story that moved into `storyState`
+func (p statePolicy) issueState(storyState string) string {
+	if v := lookup(p.IssueState, defaultStatePolicy.IssueState, storyState); v != "" {
+		return v
+	}
+	return policyKeep
+}
+
+// validate rejects rules that pivotal tracker would refuse
+func (p statePolicy) validate() error {
+	for _, storyType := range sortedKeys(p.Close) {
+		if !oneOf(storyType, storyTypeFeature, storyTypeBug, storyTypeChore, storyTypeRelease, unestimatedPolicy) {
+			return errors.Errorf("close: unknown story type %q", storyType)
+		}
+	}
+	for _, storyType := range sortedKeys(p.Reopen) {
+		if !oneOf(storyType, storyTypeFeature, storyTypeBug, storyTypeChore) {
+			return errors.Errorf("reopen: unknown story type %q", storyType)
+		}
+	}
+	for _, storyType := range sortedKeys(p.ReopenFallback) {
+		if !oneOf(storyType, storyTypeFeature, storyTypeBug, storyTypeChore) {
+			return errors.Errorf("reopen_fallback: unknown story type %q", storyType)
+		}
+	}
+	for _, storyType := range []string{storyTypeFeature, storyTypeBug, storyTypeChore} {
+		if err := validateState(p.closedStoryState(storyType, true), storyType, closeFromStates); err != nil {
+			return errors.Wrapf(err, "close %s", storyType)
+		}
+		// PT may refuse the reopen state from some states; the fallback is used then
+		if err := validateState(lookup(p.Reopen, defaultStatePolicy.Reopen, storyType), storyType, nil); err != nil {
+			return errors.Wrapf(err, "reopen %s", storyType)
+		}
+		if err := validateState(lookup(p.ReopenFallback, defaultStatePolicy.Reopen, storyType), storyType, reopenFromStates); err != nil {
+			return errors.Wrapf(err, "reopen_fallback %s", storyType)
+		}
+	}
+
+	state := p.closedStoryState(storyTypeFeature, false)
+	if p.KeepUnestimatedFeatures {
+		if state != policyKeep && !oneOf(state, unestimatedStates...) {
+			return errors.Errorf("close %s: unestimated features cannot be %q", unestimatedPolicy, state)
+		}
+	} else if err := validateState(state, storyTypeChore, closeFromStates); err != nil {
+		return errors.Wrapf(err, "close %s", unestimatedPolicy)
+	}
+
+	for _, storyState := range sortedKeys(p.IssueState) {
+		if !oneOf(storyState, storyStates...) {
+			return errors.Errorf("issue_state: unknown story state %q", storyState)
+		}
+		if v := p.IssueState[storyState]; !oneOf(v, issueStateOpen, issueStateClosed, policyKeep) {
+			return errors.Errorf("issue_state %s: unknown issue state %q", storyState, v)
+		}
+	}
+	return nil
+}
+
+// validateState tells if stories of `storyType` can move into `state` from every one of `fromStates`
+func validateState(state, storyType string, fromStates []string) error {
+	switch {
+	case state == policyKeep:
+		return nil
+	case !oneOf(state, storyStates...):
+		return errors.Errorf("unknown story state %q", state)
+	case storyType == storyTypeChore && !oneOf(state, choreStates...):
+		return errors.Errorf("chores cannot be %q", state)
+	}
+	if allowed, ok := onlyFrom[state]; ok {
+		for _, from := range fromStates {
+			if from != state && !oneOf(from, allowed...) {
+				return errors.Errorf("stories cannot be %q once %s, only once %s", state, from, strings.Join(allowed, " or "))
+			}
+		}
+	}
+	return nil
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,200 @@
+package githubtracker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatePolicyFromValues(t *testing.T) {
+	testCases := []struct {
+		givenPolicy   string
+		expectedError string
+	}{
+		{givenPolicy: ""},
+		{givenPolicy: `{"issue_state": {"delivered": "closed"}}`},
+		{givenPolicy: `{"reopen": {"feature": "unstarted", "bug": "unstarted"}}`},
+		{givenPolicy: `{"reopen": {"feature": "rejected", "bug": "rejected"}}`},
+		{givenPolicy: `{"reopen": {"feature": "rejected"}, "reopen_fallback": {"feature": "keep"}}`},
+		{
+			givenPolicy:   `{"reopen_fallback": {"feature": "rejected"}}`,
+			expectedError: `reopen_fallback feature: stories cannot be "rejected" once finished, only once delivered`,
+		},
+		{
+			givenPolicy:   `{"reopen_fallback": {"epic": "started"}}`,
+			expectedError: `reopen_fallback: unknown story type "epic"`,
+		},
+		{
+			givenPolicy:   `{"close": {"bug": "rejected"}}`,
+			expectedError: `close bug: stories cannot be "rejected" once started, only once delivered`,
+		},
+		{givenPolicy: `{"close": {"unestimated_feature": "keep"}, "keep_unestimated_features": true}`},
+		{givenPolicy: `{"close": {"unestimated_feature": "unstarted"}, "keep_unestimated_features": true}`},
+		{
+			givenPolicy:   `{"keep_unestimated_features": true}`,
+			expectedError: `close unestimated_feature: unestimated features cannot be "accepted"`,
+		},
+		{
+			givenPolicy:   `{"reopen": {"chore": "rejected"}}`,
+			expectedError: `reopen chore: chores cannot be "rejected"`,
+		},
+		{
+			givenPolicy:   `{"close": {"chore": "done"}}`,
+			expectedError: `close chore: unknown story state "done"`,
+		},
+		{
+			givenPolicy:   `{"close": {"unestimated_feature": "finished"}}`,
+			expectedError: `close unestimated_feature: chores cannot be "finished"`,
+		},
+		{
+			givenPolicy:   `{"close": {"epic": "accepted"}}`,
+			expectedError: `close: unknown story type "epic"`,
+		},
+		{
+			givenPolicy:   `{"issue_state": {"delivered": "shut"}}`,
+			expectedError: `issue_state delivered: unknown issue state "shut"`,
+		},
+		{
+			givenPolicy:   `{"issue_state": `,
+			expectedError: `policy: unexpected end of JSON input`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.givenPolicy, func(t *testing.T) {
+			_, err := statePolicyFromValues(url.Values{"policy": []string{tc.givenPolicy}})
+			if tc.expectedError == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equal(t, tc.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+func TestStatePolicy(t *testing.T) {
+	custom := statePolicy{
+		Close:                   map[string]string{unestimatedPolicy: policyKeep},
+		Reopen:                  map[string]string{storyTypeFeature: storyStateUnstarted},
+		IssueState:              map[string]string{storyStateDelivered: issueStateClosed},
+		KeepUnestimatedFeatures: true,
+	}
+	testCases := []struct {
+		givenPolicy     statePolicy
+		givenStoryType  string
+		givenEstimated  bool
+		givenStoryState string
+		expectedClose   string
+		expectedReopen  string
+		expectedIssue   string
+	}{
+		{givenStoryType: storyTypeFeature, givenEstimated: true, givenStoryState: storyStateAccepted, expectedClose: storyStateFinished, expectedReopen: storyStateStarted, expectedIssue: issueStateClosed},
+		{givenStoryType: storyTypeFeature, givenEstimated: false, givenStoryState: storyStateDelivered, expectedClose: storyStateAccepted, expectedReopen: storyStateStarted, expectedIssue: policyKeep},
+		{givenStoryType: storyTypeBug, givenEstimated: false, givenStoryState: storyStateRejected, expectedClose: storyStateAccepted, expectedReopen: storyStateStarted, expectedIssue: issueStateOpen},
+		{givenStoryType: storyTypeChore, givenEstimated: true, givenStoryState: storyStateFinished, expectedClose: storyStateAccepted, expectedReopen: storyStateStarted, expectedIssue: policyKeep},
+		{givenPolicy: custom, givenStoryType: storyTypeFeature, givenEstimated: true, givenStoryState: storyStateDelivered, expectedClose: storyStateFinished, expectedReopen: storyStateUnstarted, expectedIssue: issueStateClosed},
+		{givenPolicy: custom, givenStoryType: storyTypeFeature, givenEstimated: false, givenStoryState: storyStateAccepted, expectedClose: policyKeep, expectedReopen: storyStateUnstarted, expectedIssue: issueStateClosed},
+		{givenPolicy: custom, givenStoryType: storyTypeChore, givenEstimated: false, givenStoryState: storyStateFinished, expectedClose: storyStateAccepted, expectedReopen: storyStateStarted, expectedIssue: policyKeep},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d %s", i, tc.givenStoryType), func(t *testing.T) {
+			assert.Equal(t, tc.expectedClose, tc.givenPolicy.closedStoryState(tc.givenStoryType, tc.givenEstimated))
+			assert.Equal(t, tc.expectedReopen, tc.givenPolicy.reopenedStoryState(tc.givenStoryType, tc.givenStoryState))
+			assert.Equal(t, tc.expectedIssue, tc.givenPolicy.issueState(tc.givenStoryState))
+		})
+	}
+}
+
+func TestStatePolicyIssueClosed(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/github/issues.closed.json")
+	if err != nil {
+		t.Fatalf("readfile: %s", err.Error())
+	}
+	logclient := logTrackerClient{
+		ExpectedFoundStory: &trackerSearchResultRow{
+			ID:           alwaysString{Value: "42"},
+			StoryType:    storyTypeFeature,
+			CurrentState: storyStateUnscheduled,
+		},
+	}
+	opts := syncOptions{Policy: statePolicy{
+		Close:                   map[string]string{unestimatedPolicy: policyKeep},
+		KeepUnestimatedFeatures: true,
+	}}
+	err = WebhookIssueHandler{}.handle(data, &logclient, "https://www.pivotaltracker.com", opts)
+	assert.Nil(t, err)
+	assert.Equal(t, []logTrackerAction{
+		{Method: "FindStory", GivenTitle: "some story from ghe", GivenBody: "https://github.com/user123/repo456/issues/8\r\n\r\n", GivenIsClosed: true, GivenSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "name:\"some story from ghe\""}},
+		{Method: "GetStory", GivenID: "42"},
+		{Method: "UpdateStory", GivenID: "42", GivenTitle: "some story from ghe", GivenBody: "https://github.com/user123/repo456/issues/8\r\n\r\n", GivenIsClosed: true, GivenSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "name:\"some story from ghe\""}},
+	}, logclient.History)
+}
+
+func TestStatePolicyIssueClosedKeepsUnestimatedFeature(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/github/issues.closed.json")
+	if err != nil {
+		t.Fatalf("readfile: %s", err.Error())
+	}
+	logclient := logTrackerClient{
+		ExpectedFoundStory: &trackerSearchResultRow{
+			ID:           alwaysString{Value: "42"},
+			StoryType:    storyTypeFeature,
+			CurrentState: storyStateStarted,
+		},
+	}
+	opts := syncOptions{Policy: statePolicy{Close: map[string]string{unestimatedPolicy: policyKeep}}}
+	assert.Nil(t, opts.Policy.validate())
+	err = WebhookIssueHandler{}.handle(data, &logclient, "https://www.pivotaltracker.com", opts)
+	assert.Nil(t, err)
+	if assert.Len(t, logclient.History, 3) {
+		update := logclient.History[2]
+		assert.Equal(t, "UpdateStory", update.Method)
+		assert.Equal(t, "", update.GivenStoryType, "not turned into a chore")
+		assert.Equal(t, "", update.GivenCurrentState)
+	}
+}
+
+func TestStatePolicyIssueReopened(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/github/issues.reopened.json")
+	if err != nil {
+		t.Fatalf("readfile: %s", err.Error())
+	}
+	rejecting := statePolicy{Reopen: map[string]string{storyTypeFeature: storyStateRejected}}
+	keeping := statePolicy{Reopen: map[string]string{storyTypeFeature: storyStateRejected}, ReopenFallback: map[string]string{storyTypeFeature: policyKeep}}
+	testCases := []struct {
+		givenPolicy        statePolicy
+		givenStoryState    string
+		expectedStoryState string
+	}{
+		{givenPolicy: rejecting, givenStoryState: storyStateDelivered, expectedStoryState: storyStateRejected},
+		{givenPolicy: rejecting, givenStoryState: storyStateFinished, expectedStoryState: storyStateStarted},
+		{givenPolicy: rejecting, givenStoryState: storyStateAccepted, expectedStoryState: storyStateStarted},
+		{givenPolicy: keeping, givenStoryState: storyStateDelivered, expectedStoryState: storyStateRejected},
+		{givenPolicy: keeping, givenStoryState: storyStateFinished, expectedStoryState: ""},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d %s", i, tc.givenStoryState), func(t *testing.T) {
+			assert.Nil(t, tc.givenPolicy.validate())
+			logclient := logTrackerClient{
+				ExpectedFoundStory: &trackerSearchResultRow{
+					ID:           alwaysString{Value: "42"},
+					StoryType:    storyTypeFeature,
+					CurrentState: tc.givenStoryState,
+					Estimate:     2,
+				},
+			}
+			err := WebhookIssueHandler{}.handle(data, &logclient, "https://www.pivotaltracker.com", syncOptions{Policy: tc.givenPolicy})
+			assert.Nil(t, err)
+			if assert.Len(t, logclient.History, 3) {
+				assert.Equal(t, "GetStory", logclient.History[1].Method)
+				assert.Equal(t, "UpdateStory", logclient.History[2].Method)
+				assert.Equal(t, tc.expectedStoryState, logclient.History[2].GivenCurrentState)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package githubtracker
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// how a linked pair drifted apart
+const (
+	driftNone    = "in sync"
+	driftGithub  = "github changed"
+	driftTracker = "tracker changed"
+	driftBoth    = "both changed"
+	driftUnknown = "no baseline" // never seen in sync, can't tell which side changed
+)
+
+// pairSide is what gets compared on either side of a linked pair; bodies are in PT markdown
+type pairSide struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	State string `json:"state"`
+}
+
+// pairSnapshot is how a linked pair looked the last time it was reconciled
+type pairSnapshot struct {
+	Github  pairSide `json:"github"`
+	Tracker pairSide `json:"tracker"`
+}
+
+// reconcileReport is how every pair looked to the last run, for the admin dashboard
+type reconcileReport struct {
+	At    time.Time    `json:"at"`
+	Pairs []pairReport `json:"pairs"`
+}
+
+type pairReport struct {
+	IssueURL string   `json:"issue_url,omitempty"`
+	StoryURL string   `json:"story_url,omitempty"`
+	Status   string   `json:"status"` // in sync, fixed, conflict, broken or error
+	Drift    string   `json:"drift,omitempty"`
+	Fields   []string `json:"fields,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Reconciler compares every linked issue and story, repairs drift that happened on one side
+// (e.g. missed webhooks) the way the webhooks would have, and reports the rest for humans
+type Reconciler struct {
+	walker
+	StateFile  string // snapshots of every pair, to tell which side changed since
+	ReportFile string // optional `reconcileReport` of the last run
+}
+
+// NewReconciler reads credentials and options from both webhook urls, see `newWalker`
+func NewReconciler(issueValues, storyValues url.Values) (*Reconciler, error) {
+	w, err := newWalker(issueValues, storyValues)
+	if err != nil {
+		return nil, err
+	}
+	return &Reconciler{walker: w}, nil
+}
+
+// Run reconciles every pair once
+func (r *Reconciler) Run() error {
+	snapshots := map[string]pairSnapshot{}
+	if err := loadStateFile(r.StateFile, &snapshots); err != nil {
+		return errors.Wrapf(err, "load %s", r.StateFile)
+	}
+	issues, err := r.listIssues("all")
+	if err != nil {
+		return err
+	}
+	stories, err := r.listStories(true)
+	if err != nil {
+		return err
+	}
+
+	storyIndex := map[string]int{}
+	for s, story := range stories {
+		storyIndex[story.ID.String()] = s
+	}
+	issueIndex := map[string]int{}
+	for i, issue := range issues {
+		issueIndex[issue.HTMLURL] = i
+	}
+
+	counts := map[string]int{}
+	failed := 0
+	report := reconcileReport{At: time.Now().UTC(), Pairs: []pairReport{}}
+	for _, issue := range issues {
+		link := parseStoryLink(issue.Body, r.trackerHTMLURL)
+		if link == nil || !r.issueInScope(issue) {
+			continue
+		}
+		s, ok := storyIndex[link.StoryID]
+		if ok && !r.storyInScope(stories[s]) {
+			continue // unlinked from the tracker side
+		}
+		if !ok {
+			counts["broken"]++
+			fmt.Fprintf(r.Out, "broken    #%d links to story %s, which is not in the project\n", issue.Number, link.StoryID)
+			report.Pairs = append(report.Pairs, pairReport{IssueURL: issue.HTMLURL, StoryURL: link.URL, Status: "broken", Error: "story is not in the project"})
+			continue
+		}
+		story := stories[s]
+		if !hasLinkPrefix(story.Description, issue.HTMLURL) {
+			counts["broken"]++
+			fmt.Fprintf(r.Out, "broken    #%d links to story %s, which does not link back\n", issue.Number, link.StoryID)
+			report.Pairs = append(report.Pairs, pairReport{IssueURL: issue.HTMLURL, StoryURL: link.URL, Status: "broken", Error: "story does not link back"})
+			continue
+		}
+
+		gh, pt := r.githubSide(issue), r.trackerSide(story)
+		fields := r.differences(gh, pt)
+		snapshot, seen := snapshots[story.ID.String()]
+		drift := driftNone
+		switch {
+		case len(fields) == 0:
+		case !seen:
+			drift = driftUnknown
+		case gh != snapshot.Github && pt == snapshot.Tracker:
+			drift = driftGithub
+		case gh == snapshot.Github && pt != snapshot.Tracker:
+			drift = driftTracker
+		default:
+			drift = driftBoth
+		}
+		if fields = r.owned(drift, fields); len(fields) == 0 {
+			drift = driftNone // e.g. github edited a title that tracker owns
+		}
+		counts[drift]++
+		pair := pairReport{IssueURL: issue.HTMLURL, StoryURL: r.storyURL(story), Status: driftNone, Drift: drift, Fields: fields}
+
+		switch drift {
+		case driftNone:
+			pair.Drift, pair.Fields = "", nil
+		case driftGithub, driftTracker:
+			if err := r.repair(drift, fields, issue, story); err != nil {
+				failed++
+				fmt.Fprintf(r.Out, "error     #%d / story %s (%s: %s): %s\n", issue.Number, story.ID.String(), drift, strings.Join(fields, ", "), err.Error())
+				pair.Status, pair.Error = "error", err.Error()
+				report.Pairs = append(report.Pairs, pair)
+				continue
+			}
+			fmt.Fprintf(r.Out, "fixed     #%d / story %s (%s: %s)\n", issue.Number, story.ID.String(), drift, strings.Join(fields, ", "))
+			pair.Status = "fixed"
+		default:
+			fmt.Fprintf(r.Out, "conflict  #%d / story %s (%s: %s)\n", issue.Number, story.ID.String(), drift, strings.Join(fields, ", "))
+			pair.Status = "conflict"
+			report.Pairs = append(report.Pairs, pair)
+			continue // keep the old snapshot until a human sorts it out
+		}
+		report.Pairs = append(report.Pairs, pair)
+		snapshots[story.ID.String()] = pairSnapshot{Github: gh, Tracker: pt}
+	}
+
+	// stories pointing at issues of this repo that don't point back
+	repoURL := strings.TrimRight(r.githubHTMLURL, "/") + "/" + r.repo + "/issues/"
+	for _, story := range stories {
+		if !strings.HasPrefix(story.Description, repoURL) || !r.storyInScope(story) {
+			continue
+		}
+		issueURL := strings.Fields(story.Description)[0]
+		if i, ok := issueIndex[issueURL]; ok && (bodyLinksTo(issues[i].Body, r.storyURL(story)) || !r.issueInScope(issues[i])) {
+			continue
+		}
+		counts["broken"]++
+		fmt.Fprintf(r.Out, "broken    story %s links to %s, which does not link back\n", story.ID.String(), issueURL)
+		report.Pairs = append(report.Pairs, pairReport{IssueURL: issueURL, StoryURL: r.storyURL(story), Status: "broken", Error: "issue does not link back"})
+	}
+
+	if err := saveStateFile(r.StateFile, snapshots); err != nil {
+		return errors.Wrapf(err, "save %s", r.StateFile)
+	}
+	if err := saveStateFile(r.ReportFile, report); err != nil {
+		return errors.Wrapf(err, "save %s", r.ReportFile)
+	}
+	fmt.Fprintf(r.Out, "%d in sync, %d fixed, %d conflicts, %d broken links\n",
+		counts[driftNone], counts[driftGithub]+counts[driftTracker]-failed, counts[driftBoth]+counts[driftUnknown], counts["broken"])
+	if failed > 0 {
+		return errors.Errorf("%d repairs failed", failed)
+	}
+	return nil
+}
+
+func (r *Reconciler) githubSide(issue githubSearchResultRow) pairSide {
+	wi := webhookIssue{Body: issue.Body, trackerHTMLURL: r.trackerHTMLURL}
+	return pairSide{
+		Title: strings.TrimSpace(issue.Title),
+		Body:  normalizeNewlines(markdownToTracker(wi.StrippedBody(), repoURLOf(issue.HTMLURL), r.issueOpts.People)),
+		State: issue.State,
+	}
+}
+
+func (r *Reconciler) trackerSide(story trackerSearchResultRow) pairSide {
+	ws := webhookStory{Body: &story.Description, githubHTMLURL: r.githubHTMLURL}
+	return pairSide{
+		Title: strings.TrimSpace(story.Name),
+		Body:  normalizeNewlines(ws.StrippedBody()),
+		State: story.CurrentState,
+	}
+}
+
+// differences lists the fields that disagree; states only disagree if the policy has an opinion
+func (r *Reconciler) differences(gh, pt pairSide) []string {
+	fields := []string{}
+	if gh.Title != pt.Title {
+		fields = append(fields, "title")
+	}
+	if gh.Body != pt.Body {
+		fields = append(fields, "body")
+	}
+	if state := r.storyOpts.Policy.issueState(pt.State); state != policyKeep && state != gh.State {
+		fields = append(fields, "state")
+	}
+	return fields
+}
+
+// owned leaves out the fields that don't sync from the side that drifted, see `fieldOwners`
+func (r *Reconciler) owned(drift string, fields []string) []string {
+	owners := map[string][2]string{
+		"title": {r.issueOpts.Fields.Title, r.storyOpts.Fields.Title},
+		"body":  {r.issueOpts.Fields.Body, r.storyOpts.Fields.Body},
+		"state": {r.issueOpts.Fields.State, r.storyOpts.Fields.State},
+	}
+	result := []string{}
+	for _, field := range fields {
+		github, tracker := fromGithub(owners[field][0]), fromTracker(owners[field][1])
+		switch {
+		case drift == driftGithub && !github, drift == driftTracker && !tracker, !github && !tracker:
+			continue
+		}
+		result = append(result, field)
+	}
+	return result
+}
+
+// repair copies the side that changed over to the other, through the webhook handlers
+func (r *Reconciler) repair(drift string, fields []string, issue githubSearchResultRow, story trackerSearchResultRow) error {
+	if drift == driftGithub {
+		wi := &webhookIssue{
+			isDrifted:      true,
+			Title:          issue.Title,
+			Body:           issue.Body,
+			State:          issue.State,
+			URL:            issue.HTMLURL,
+			trackerHTMLURL: r.trackerHTMLURL,
+			opts:           r.issueOpts,
+		}
+		if oneOf("title", fields...) {
+			wi.titleWas = &story.Name
+		}
+		if oneOf("state", fields...) {
+			wi.isClosed = (issue.State == issueStateClosed)
+			wi.isOpened = !wi.isClosed
+		}
+		return WebhookIssueHandler{}.handleIssue(wi, r.tracker, r.trackerHTMLURL, r.issueOpts)
+	}
+
+	ws := &webhookStory{
+		URL:           r.storyURL(story),
+		Title:         story.Name,
+		StoryID:       story.ID.String(),
+		githubHTMLURL: r.githubHTMLURL,
+	}
+	if story.ProjectID != 0 {
+		ws.projectID = fmt.Sprintf("%d", story.ProjectID)
+	}
+	if oneOf("title", fields...) {
+		ws.titleWas = &issue.Title
+	}
+	if oneOf("body", fields...) {
+		ws.Body = &story.Description
+	}
+	if oneOf("state", fields...) {
+		ws.CurrentState = story.CurrentState
+	}
+	return WebhookStoryHandler{}.handleStory(ws, r.github, r.repo, r.githubHTMLURL, r.trackerHTMLURL, r.storyOpts)
+}
+
+func normalizeNewlines(s string) string {
+	return strings.TrimSpace(strings.Replace(s, "\r\n", "\n", -1))
+}
@@ -0,0 +1,115 @@
+package githubtracker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconciler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+	assert.Nil(t, saveStateFile(stateFile, map[string]pairSnapshot{
+		"102": {
+			Github:  pairSide{Title: "Old title", Body: "two", State: "open"},
+			Tracker: pairSide{Title: "Old title", Body: "two", State: "started"},
+		},
+		"103": {
+			Github:  pairSide{Title: "Three", Body: "three", State: "open"},
+			Tracker: pairSide{Title: "Three", Body: "three", State: "started"},
+		},
+	}))
+
+	github := &logGithubClient{
+		ExpectedFoundIssue: &githubSearchResultRow{Number: 3, Title: "Three"},
+		ExpectedIssues: []githubSearchResultRow{
+			{Number: 1, Title: "One", Body: "https://www.pivotaltracker.com/story/show/101\r\n\r\none #2", HTMLURL: "https://github.com/user123/repo456/issues/1", State: "open"},
+			{Number: 2, Title: "New title", Body: "https://www.pivotaltracker.com/story/show/102\r\n\r\ntwo", HTMLURL: "https://github.com/user123/repo456/issues/2", State: "open"},
+			{Number: 3, Title: "Three", Body: "https://www.pivotaltracker.com/story/show/103\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/103 version:1 -->\r\n\r\nthree", HTMLURL: "https://github.com/user123/repo456/issues/3", State: "open"},
+			{Number: 4, Title: "Four", Body: "https://www.pivotaltracker.com/story/show/104\r\n\r\nfour", HTMLURL: "https://github.com/user123/repo456/issues/4", State: "open"},
+			{Number: 5, Title: "Five", Body: "https://www.pivotaltracker.com/story/show/999\r\n\r\nfive", HTMLURL: "https://github.com/user123/repo456/issues/5", State: "open"},
+		},
+	}
+	tracker := &logTrackerClient{
+		ExpectedFoundStory: &trackerSearchResultRow{ID: alwaysString{"102"}, Name: "Old title", CurrentState: "started"},
+		ExpectedStories: []trackerSearchResultRow{
+			{ID: alwaysString{"101"}, Name: "One", Description: "https://github.com/user123/repo456/issues/1\r\n\r\none [#2](https://github.com/user123/repo456/issues/2)", CurrentState: "started"},
+			{ID: alwaysString{"102"}, Name: "Old title", Description: "https://github.com/user123/repo456/issues/2\r\n\r\ntwo", CurrentState: "started"},
+			{ID: alwaysString{"103"}, Name: "Three", Description: "https://github.com/user123/repo456/issues/3\r\n\r\nthree", CurrentState: "accepted"},
+			{ID: alwaysString{"104"}, Name: "Four?", Description: "https://github.com/user123/repo456/issues/4\r\n\r\nfour", CurrentState: "started"},
+			{ID: alwaysString{"106"}, Name: "Six", Description: "https://github.com/user123/repo456/issues/6\r\n\r\nsix", CurrentState: "started"},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	reportFile := filepath.Join(dir, "report.json")
+	r := Reconciler{walker: newTestWalker(github, tracker, out), StateFile: stateFile, ReportFile: reportFile}
+	r.storyOpts.Policy = defaultStatePolicy
+	r.issueOpts.Policy = defaultStatePolicy
+	assert.Nil(t, r.Run())
+	assert.Equal(t, `fixed     #2 / story 102 (github changed: title)
+fixed     #3 / story 103 (tracker changed: state)
+conflict  #4 / story 104 (no baseline: title)
+broken    #5 links to story 999, which is not in the project
+broken    story 106 links to https://github.com/user123/repo456/issues/6, which does not link back
+1 in sync, 2 fixed, 1 conflicts, 2 broken links
+`, out.String())
+
+	assert.Equal(t, []logTrackerAction{
+		{Method: "ListStories", GivenID: "0"},
+		{Method: "ListStories", GivenID: "5"},
+		{
+			Method:             "FindStory",
+			GivenTitle:         "New title",
+			GivenBody:          "https://github.com/user123/repo456/issues/2\r\n\r\ntwo",
+			GivenSearchFilters: []string{`id:"102"`, `id:"102"`, `name:"Old title"`, `name:"New title"`},
+		},
+		{
+			Method:             "UpdateStory",
+			GivenID:            "102",
+			GivenTitle:         "New title",
+			GivenBody:          "https://github.com/user123/repo456/issues/2\r\n\r\ntwo",
+			GivenSearchFilters: []string{`id:"102"`, `id:"102"`, `name:"Old title"`, `name:"New title"`},
+		},
+	}, tracker.History)
+
+	assert.Equal(t, []logAction{
+		{Method: "ListIssues", GivenID: "1", GivenState: "all"},
+		{Method: "ListIssues", GivenID: "2", GivenState: "all"},
+		{
+			Method:             "FindIssue",
+			GivenTitle:         "Three",
+			GivenState:         "closed",
+			GivenSearchFilters: []string{"Three in:title is:issue repo:user123/repo456"},
+		},
+		{Method: "SearchIssues", GivenID: `103 in:body is:issue label:epic repo:user123/repo456`},
+		{Method: "UpdateIssue", GivenID: "3", GivenTitle: "Three", GivenState: "closed"},
+	}, github.History)
+
+	snapshots := map[string]pairSnapshot{}
+	assert.Nil(t, loadStateFile(stateFile, &snapshots))
+	assert.Len(t, snapshots, 3) // no snapshot for the conflict
+	assert.Equal(t, "one [#2](https://github.com/user123/repo456/issues/2)", snapshots["101"].Github.Body)
+	assert.Equal(t, "New title", snapshots["102"].Github.Title)
+
+	report := reconcileReport{}
+	assert.Nil(t, loadStateFile(reportFile, &report))
+	statuses := []string{}
+	for _, pair := range report.Pairs {
+		statuses = append(statuses, pair.Status)
+	}
+	assert.Equal(t, []string{driftNone, "fixed", "fixed", "conflict", "broken", "broken"}, statuses)
+	assert.Equal(t, pairReport{
+		IssueURL: "https://github.com/user123/repo456/issues/4",
+		StoryURL: "https://www.pivotaltracker.com/story/show/104",
+		Status:   "conflict",
+		Drift:    driftUnknown,
+		Fields:   []string{"title"},
+	}, report.Pairs[3])
+}
@@ -0,0 +1,401 @@
+package githubtracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/pkg/errors"
+)
+
+// githubHookEvents are the GH events the webhook handles
+var githubHookEvents = []string{"issues", "pull_request", "push", "sub_issues"}
+
+// trackerWebhookVersion is the PT activity format the webhook parses
+const trackerWebhookVersion = "v5"
+
+// trackerAPIHost is where PT projects are; GH can be GH enterprise, so its host is configured
+const trackerAPIHost = "www.pivotaltracker.com"
+
+// APIHosts are the hosts that forms anyone can post may call: GH at `githubAPIURL`
+// (api.github.com by default), and PT
+func APIHosts(githubAPIURL string) ([]string, error) {
+	u, err := url.Parse(valueOr(githubAPIURL, "https://api.github.com"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "GH api url")
+	}
+	return []string{u.Host, trackerAPIHost}, nil
+}
+
+// allowedAPI tells if `apiURL` is on one of `hosts`, so the server doesn't call anywhere it is
+// told to, e.g. with a token; any when there are no `hosts`
+func allowedAPI(apiURL string, hosts []string) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if u.Scheme == "https" && strings.EqualFold(u.Host, host) {
+			return nil
+		}
+	}
+	return errors.Errorf("%s is not on %s", apiURL, strings.Join(hosts, " or "))
+}
+
+// Register adds both webhook urls where they belong, with the credentials inside them: the GH
+// url to the repo of the PT url (which has the GH token), the PT url to the project of the GH
+// url (which has the PT token). hooks already pointing at the same url are updated instead
+type Register struct {
+	Secret      string
+	Client      *http.Client
+	APIHosts    []string // the GH and PT api urls must be on one of these, e.g. api.github.com; any when empty
+	WebhookHost string   // the webhook urls must point at this host, i.e. this server; any when empty
+	sleep       func(time.Duration)
+}
+
+type registerResult struct {
+	Target string `json:"target"` // the GH repo or PT project
+	Hook   string `json:"hook"`   // created or updated
+	Ping   string `json:"ping"`
+	Error  string `json:"error,omitempty"`
+}
+
+type githubHook struct {
+	ID           int64            `json:"id,omitempty"`
+	Name         string           `json:"name,omitempty"`
+	Active       bool             `json:"active"`
+	Events       []string         `json:"events"`
+	Config       githubHookConfig `json:"config"`
+	LastResponse *struct {
+		Code    *int   `json:"code"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"last_response,omitempty"`
+}
+
+type githubHookConfig struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Secret      string `json:"secret,omitempty"`
+	InsecureSSL string `json:"insecure_ssl"`
+}
+
+type trackerProjectWebhook struct {
+	ID             int64  `json:"id,omitempty"`
+	WebhookURL     string `json:"webhook_url"`
+	WebhookVersion string `json:"webhook_version"`
+}
+
+// Run registers both urls, which must be absolute: the GH url on every repo the PT url syncs to,
+// routes included, and the PT url on every project the GH url syncs to. one failing doesn't stop the others
+func (reg Register) Run(githubWebhookURL, trackerWebhookURL string) ([]registerResult, error) {
+	githubURL, issueValues, err := reg.parse(githubWebhookURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "github webhook url")
+	}
+	trackerURL, storyValues, err := reg.parse(trackerWebhookURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pivotaltracker webhook url")
+	}
+
+	github := githubAPI{
+		Client:   reg.client(),
+		Token:    storyValues.Get("token"),
+		Username: storyValues.Get("username"),
+		URL:      storyValues.Get("api_url"),
+	}
+	githubs := []githubAPI{}
+	for _, group := range routeGroups(routesFromValues(storyValues), storyValues.Get("repo")) {
+		for _, repo := range group.targets {
+			g := group.route.github(github)
+			g.Repo = repo
+			githubs = append(githubs, g)
+		}
+	}
+	tracker := trackerAPI{
+		Client: reg.client(),
+		Token:  issueValues.Get("token"),
+	}
+	trackers := []trackerAPI{}
+	for _, group := range routeGroups(routesFromValues(issueValues), issueValues.Get("api_url")) {
+		for _, project := range group.targets {
+			t := group.route.tracker(tracker)
+			t.URL = strings.TrimRight(project, "/")
+			trackers = append(trackers, t)
+		}
+	}
+
+	// nothing is called unless every api is allowed
+	for _, g := range githubs {
+		if err = allowedAPI(g.URL, reg.APIHosts); err != nil {
+			return nil, errors.Wrapf(err, "GH api_url of the pivotaltracker webhook url")
+		}
+	}
+	for _, t := range trackers {
+		if err = allowedAPI(t.URL, reg.APIHosts); err != nil {
+			return nil, errors.Wrapf(err, "PT api_url of the github webhook url")
+		}
+	}
+
+	results := []registerResult{}
+	seen := map[string]bool{}
+	for _, g := range githubs {
+		if key := strings.ToLower(g.Repo); !seen[key] {
+			seen[key] = true
+			results = append(results, reg.github(g, githubURL))
+		}
+	}
+	for _, t := range trackers {
+		if key := strings.ToLower(t.URL); !seen[key] {
+			seen[key] = true
+			results = append(results, reg.tracker(t, trackerURL))
+		}
+	}
+	return results, nil
+}
+
+func (reg Register) client() *http.Client {
+	if reg.Client != nil {
+		return reg.Client
+	}
+	return http.DefaultClient
+}
+
+func (reg Register) parse(webhookURL string) (*url.URL, url.Values, error) {
+	u, err := url.Parse(strings.TrimSpace(webhookURL))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !u.IsAbs() {
+		return nil, nil, errors.Errorf("%s is not absolute, e.g. https://example.com/github/?...", webhookURL)
+	}
+	if reg.WebhookHost != "" && !strings.EqualFold(u.Host, reg.WebhookHost) {
+		return nil, nil, errors.Errorf("%s is not a webhook url of this server (%s)", webhookURL, reg.WebhookHost)
+	}
+	values, err := crypto.DecryptValues(reg.Secret, u.Query())
+	return u, values, err
+}
+
+func (reg Register) github(g githubAPI, webhookURL *url.URL) registerResult {
+	result := registerResult{Target: g.Repo}
+	hooksURL := fmt.Sprintf("%s/repos/%s/hooks", g.URL, g.Repo)
+	data, err := g.perform("GET", hooksURL, nil, http.StatusOK)
+	if err != nil {
+		result.Error = hookError(err, "list hooks", "the GH token needs admin access to the repo, or the admin:repo_hook scope")
+		return result
+	}
+	hooks := []githubHook{}
+	if err = json.Unmarshal(data, &hooks); err != nil {
+		result.Error = errors.Wrapf(err, "json unmarshal").Error()
+		return result
+	}
+
+	hook := githubHook{
+		Name:   "web",
+		Active: true,
+		Events: githubHookEvents,
+		Config: githubHookConfig{
+			URL:         webhookURL.String(),
+			ContentType: "json",
+			Secret:      crypto.HookSecret(reg.Secret, webhookURL.Query().Get("nonce")),
+			InsecureSSL: "0",
+		},
+	}
+	body, err := json.Marshal(hook)
+	if err != nil {
+		result.Error = errors.Wrapf(err, "json marshal").Error()
+		return result
+	}
+	result.Hook = "created"
+	method, targetURL, expectedStatus := "POST", hooksURL, http.StatusCreated
+	for _, h := range hooks {
+		if sameWebhook(h.Config.URL, webhookURL, "api_url") {
+			result.Hook, method, targetURL, expectedStatus = "updated", "PATCH", fmt.Sprintf("%s/%d", hooksURL, h.ID), http.StatusOK
+			break
+		}
+	}
+	data, err = g.perform(method, targetURL, body, expectedStatus)
+	if err == nil {
+		err = json.Unmarshal(data, &hook)
+	}
+	if err != nil {
+		result.Hook, result.Error = "", hookError(err, "save hook", "the GH token needs admin access to the repo, or the admin:repo_hook scope")
+		return result
+	}
+	log.Printf("register: %s hook %d of %s", result.Hook, hook.ID, g.Repo)
+
+	hookURL := fmt.Sprintf("%s/%d", hooksURL, hook.ID)
+	if _, err = g.perform("POST", hookURL+"/pings", nil, http.StatusNoContent); err != nil {
+		result.Error = hookError(err, "ping", "")
+		return result
+	}
+	// GH delivers the ping in the background, and shows the answer on the hook
+	result.Ping = "sent; not answered yet, see the hook's Recent Deliveries on GH"
+	for i := 0; i < 5; i++ {
+		reg.wait(time.Second)
+		data, err = g.perform("GET", hookURL, nil, http.StatusOK)
+		if err != nil {
+			result.Error = hookError(err, "get hook", "")
+			return result
+		}
+		if err = json.Unmarshal(data, &hook); err != nil {
+			result.Error = errors.Wrapf(err, "json unmarshal").Error()
+			return result
+		}
+		if last := hook.LastResponse; last != nil && last.Code != nil {
+			result.Ping = fmt.Sprintf("answered %d %s", *last.Code, strings.TrimSpace(last.Message))
+			if *last.Code < 200 || *last.Code >= 300 {
+				result.Error = "ping failed; is this server reachable from GH?"
+			}
+			break
+		}
+	}
+	return result
+}
+
+func (reg Register) tracker(t trackerAPI, webhookURL *url.URL) registerResult {
+	result := registerResult{Target: t.URL}
+	webhooksURL := t.URL + "/webhooks"
+	data, err := t.perform("GET", webhooksURL, nil)
+	if err == nil {
+		err = trackerError(data)
+	}
+	if err != nil {
+		result.Error = hookError(err, "list webhooks", "the PT token needs to be an owner of the project")
+		return result
+	}
+	webhooks := []trackerProjectWebhook{}
+	if err = json.Unmarshal(data, &webhooks); err != nil {
+		result.Error = errors.Wrapf(err, "json unmarshal").Error()
+		return result
+	}
+
+	body, err := json.Marshal(trackerProjectWebhook{WebhookURL: webhookURL.String(), WebhookVersion: trackerWebhookVersion})
+	if err != nil {
+		result.Error = errors.Wrapf(err, "json marshal").Error()
+		return result
+	}
+	result.Hook = "created"
+	method, targetURL := "POST", webhooksURL
+	for _, w := range webhooks {
+		if sameWebhook(w.WebhookURL, webhookURL, "repo") {
+			result.Hook, method, targetURL = "updated", "PUT", fmt.Sprintf("%s/%d", webhooksURL, w.ID)
+			break
+		}
+	}
+	data, err = t.perform(method, targetURL, body)
+	if err == nil {
+		err = trackerError(data)
+	}
+	if err != nil {
+		result.Hook, result.Error = "", hookError(err, "save webhook", "the PT token needs to be an owner of the project")
+		return result
+	}
+	log.Printf("register: %s webhook of %s", result.Hook, t.URL)
+
+	// PT has no ping; send a harmless activity ourselves
+	resp, err := reg.client().Post(webhookURL.String(), "application/json", bytes.NewReader([]byte(`{"kind":"ping","changes":[]}`)))
+	if err != nil {
+		result.Error = hookError(err, "ping", "")
+		return result
+	}
+	resp.Body.Close()
+	result.Ping = fmt.Sprintf("answered %s (sent by this server, PT has no ping)", resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = "ping failed"
+	}
+	return result
+}
+
+func (reg Register) wait(d time.Duration) {
+	if reg.sleep != nil {
+		reg.sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+// sameWebhook tells if `existing` is `webhookURL`, maybe with another token: same path, and
+// the same `key` value, i.e. syncing to the same place
+func sameWebhook(existing string, webhookURL *url.URL, key string) bool {
+	u, err := url.Parse(existing)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == webhookURL.Scheme && u.Host == webhookURL.Host && u.Path == webhookURL.Path &&
+		u.Query().Get(key) == webhookURL.Query().Get(key)
+}
+
+// trackerError returns the error PT answered with, if any
+func trackerError(data []byte) error {
+	var result struct {
+		Kind           string `json:"kind"`
+		Code           string `json:"code"`
+		Error          string `json:"error"`
+		GeneralProblem string `json:"general_problem"`
+	}
+	if json.Unmarshal(data, &result) != nil || result.Kind != "error" {
+		return nil
+	}
+	return errors.Errorf("%s: %s %s", result.Code, result.Error, result.GeneralProblem)
+}
+
+func hookError(err error, doing, hint string) string {
+	if hint == "" {
+		return fmt.Sprintf("%s: %s", doing, err.Error())
+	}
+	return fmt.Sprintf("%s: %s (%s)", doing, err.Error(), hint)
+}
+
+// RegisterHandler registers the webhook urls posted as `github_webhook_url` and
+// `tracker_webhook_url`, see `Register`. anyone can post, so only urls of this server are
+// registered, and only on GH at `GithubAPIURL` (api.github.com by default) or on PT
+type RegisterHandler struct {
+	Secret       string
+	GithubAPIURL string
+}
+
+func (h RegisterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hosts, err := APIHosts(h.GithubAPIURL)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reg := Register{Secret: h.Secret, APIHosts: hosts, WebhookHost: r.Host}
+	results, err := reg.Run(r.FormValue("github_webhook_url"), r.FormValue("tracker_webhook_url"))
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	for _, result := range results {
+		if result.Error != "" {
+			log.Printf("register: %s: %s", result.Target, result.Error)
+			w.WriteHeader(http.StatusBadGateway)
+			break
+		}
+	}
+	for _, result := range results {
+		status := html.EscapeString(result.Hook + " webhook")
+		if result.Error != "" {
+			status = "<b>" + html.EscapeString(result.Error) + "</b>"
+		}
+		fmt.Fprintf(w, "<p>%s: %s<br><small>ping: %s</small></p>\n", html.EscapeString(result.Target), status, html.EscapeString(result.Ping))
+	}
+}
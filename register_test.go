@@ -0,0 +1,192 @@
+package githubtracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHookAPIs pretends to be GH and PT, delivering GH pings to the registered hook
+type fakeHookAPIs struct {
+	t            *testing.T
+	githubHooks  []githubHook
+	trackerHooks []trackerProjectWebhook
+	pingStatus   int
+}
+
+func (f *fakeHookAPIs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.URL.Path == "/api/v3/repos/user123/repo456/hooks" && r.Method == "GET":
+		json.NewEncoder(w).Encode(f.githubHooks)
+	case r.URL.Path == "/api/v3/repos/user123/repo456/hooks" && r.Method == "POST":
+		hook := githubHook{}
+		assert.Nil(f.t, json.Unmarshal(body, &hook))
+		hook.ID = int64(len(f.githubHooks) + 1)
+		f.githubHooks = append(f.githubHooks, hook)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(hook)
+	case r.URL.Path == "/api/v3/repos/user123/repo456/hooks/1" && r.Method == "PATCH":
+		hook := githubHook{}
+		assert.Nil(f.t, json.Unmarshal(body, &hook))
+		hook.ID = 1
+		f.githubHooks[0] = hook
+		json.NewEncoder(w).Encode(hook)
+	case r.URL.Path == "/api/v3/repos/user123/repo456/hooks/1/pings":
+		hook := &f.githubHooks[0]
+		ping := []byte(`{"zen":"Keep it logically awesome.","hook_id":1}`)
+		req, _ := http.NewRequest("POST", hook.Config.URL, bytes.NewReader(ping))
+		req.Header.Set("X-GitHub-Event", "ping")
+		req.Header.Set("X-Hub-Signature-256", crypto.Signature(hook.Config.Secret, ping))
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(f.t, err)
+		resp.Body.Close()
+		f.pingStatus = resp.StatusCode
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/api/v3/repos/user123/repo456/hooks/1":
+		hook := f.githubHooks[0]
+		if f.pingStatus != 0 {
+			hook.LastResponse = &struct {
+				Code    *int   `json:"code"`
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			}{Code: &f.pingStatus, Status: "active", Message: "OK"}
+		}
+		json.NewEncoder(w).Encode(hook)
+	case r.URL.Path == "/services/v5/projects/99/webhooks" && r.Method == "GET":
+		json.NewEncoder(w).Encode(f.trackerHooks)
+	case r.URL.Path == "/services/v5/projects/99/webhooks" && r.Method == "POST":
+		hook := trackerProjectWebhook{}
+		assert.Nil(f.t, json.Unmarshal(body, &hook))
+		hook.ID = int64(len(f.trackerHooks) + 1)
+		f.trackerHooks = append(f.trackerHooks, hook)
+		json.NewEncoder(w).Encode(hook)
+	case r.URL.Path == "/services/v5/projects/99/webhooks/1" && r.Method == "PUT":
+		hook := trackerProjectWebhook{}
+		assert.Nil(f.t, json.Unmarshal(body, &hook))
+		hook.ID = 1
+		f.trackerHooks[0] = hook
+		json.NewEncoder(w).Encode(hook)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"kind":"error","code":"not_found","error":"not found"}`))
+	}
+}
+
+func TestRegister(t *testing.T) {
+	secret := "c1626442-0327-40a6-a830-c5517d6782d2"
+	cryptoServer := crypto.Server{Secret: secret}
+	apis := &fakeHookAPIs{t: t}
+	mux := http.NewServeMux()
+	mux.Handle("/api/v3/", apis)
+	mux.Handle("/services/v5/", apis)
+	mux.Handle("/github/", cryptoServer.RequireCipherNonce(WebhookIssueHandler{}))
+	mux.Handle("/pivotaltracker/", cryptoServer.RequireCipherNonce(WebhookStoryHandler{}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	generate := func(form url.Values) string {
+		r := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		cryptoServer.ServeHTTP(w, r)
+		return server.URL + w.Header().Get("X-Result-URL")
+	}
+	githubWebhookURL := generate(url.Values{"token": {"pt-token"}, "api_url": {server.URL + "/services/v5/projects/99"}, "target_path": {"/github/"}})
+	trackerWebhookURL := generate(url.Values{"token": {"gh-token"}, "username": {"octocat"}, "api_url": {server.URL + "/api/v3"}, "repo": {"user123/repo456"}, "github_html_url": {"https://github.com"}, "tracker_html_url": {"https://www.pivotaltracker.com"}, "target_path": {"/pivotaltracker/"}})
+
+	reg := Register{Secret: secret, sleep: func(time.Duration) {}}
+	results, err := reg.Run(githubWebhookURL, trackerWebhookURL)
+	assert.Nil(t, err)
+	assert.Equal(t, []registerResult{
+		{Target: "user123/repo456", Hook: "created", Ping: "answered 200 OK"},
+		{Target: server.URL + "/services/v5/projects/99", Hook: "created", Ping: "answered 200 OK (sent by this server, PT has no ping)"},
+	}, results)
+	if assert.Len(t, apis.githubHooks, 1) {
+		hook := apis.githubHooks[0]
+		assert.Equal(t, githubHookEvents, hook.Events)
+		assert.Equal(t, githubHookConfig{URL: githubWebhookURL, ContentType: "json", Secret: crypto.HookSecret(secret, mustParse(githubWebhookURL).Query().Get("nonce")), InsecureSSL: "0"}, hook.Config)
+	}
+	assert.Equal(t, []trackerProjectWebhook{{ID: 1, WebhookURL: trackerWebhookURL, WebhookVersion: "v5"}}, apis.trackerHooks)
+
+	// urls generated again are updated in place
+	githubWebhookURL = generate(url.Values{"token": {"pt-token"}, "api_url": {server.URL + "/services/v5/projects/99"}, "target_path": {"/github/"}})
+	results, err = reg.Run(githubWebhookURL, trackerWebhookURL)
+	assert.Nil(t, err)
+	assert.Equal(t, "updated", results[0].Hook)
+	assert.Equal(t, "updated", results[1].Hook)
+	assert.Len(t, apis.githubHooks, 1)
+	assert.Equal(t, githubWebhookURL, apis.githubHooks[0].Config.URL)
+	assert.Len(t, apis.trackerHooks, 1)
+
+	// a forged signature is refused
+	req, _ := http.NewRequest("POST", githubWebhookURL, strings.NewReader(`{"zen":"forged"}`))
+	req.Header.Set("X-Hub-Signature-256", crypto.Signature("guessed", []byte(`{"zen":"forged"}`)))
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// another project is refused, and says why
+	githubWebhookURL = generate(url.Values{"token": {"pt-token"}, "api_url": {server.URL + "/services/v5/projects/100"}, "target_path": {"/github/"}})
+	results, err = reg.Run(githubWebhookURL, trackerWebhookURL)
+	assert.Nil(t, err)
+	assert.Contains(t, results[1].Error, "not_found: not found")
+	assert.Contains(t, results[1].Error, "owner of the project")
+
+	_, err = reg.Run("/github/?token=x", trackerWebhookURL)
+	assert.NotNil(t, err, "not absolute")
+
+	// apis and webhook urls elsewhere are refused before anything is called
+	reg.APIHosts = []string{"api.github.com", trackerAPIHost}
+	_, err = reg.Run(githubWebhookURL, trackerWebhookURL)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "GH api_url of the pivotaltracker webhook url: "+server.URL+"/api/v3 is not on api.github.com or www.pivotaltracker.com", err.Error())
+	}
+	reg.APIHosts = nil
+	reg.WebhookHost = "example.com"
+	_, err = reg.Run(githubWebhookURL, trackerWebhookURL)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "is not a webhook url of this server (example.com)")
+	}
+
+	// routed repos and projects get hooks too, each with its own result
+	reg.WebhookHost = ""
+	githubWebhookURL = generate(url.Values{"token": {"pt-token"}, "api_url": {server.URL + "/services/v5/projects/99"}, "route": {"label:backend " + server.URL + "/services/v5/projects/100\nlabel:frontend " + server.URL + "/services/v5/projects/99"}, "target_path": {"/github/"}})
+	trackerWebhookURL = generate(url.Values{"token": {"gh-token"}, "username": {"octocat"}, "api_url": {server.URL + "/api/v3"}, "repo": {"user123/repo456"}, "route": {"label:repo:web user123/web"}, "target_path": {"/pivotaltracker/"}})
+	results, err = reg.Run(githubWebhookURL, trackerWebhookURL)
+	assert.Nil(t, err)
+	targets := []string{}
+	for _, result := range results {
+		targets = append(targets, result.Target)
+	}
+	assert.Equal(t, []string{"user123/repo456", "user123/web", server.URL + "/services/v5/projects/99", server.URL + "/services/v5/projects/100"}, targets)
+	assert.Equal(t, "updated", results[0].Hook)
+	assert.Contains(t, results[1].Error, "list hooks")
+	assert.Equal(t, "updated", results[2].Hook)
+	assert.Contains(t, results[3].Error, "not_found: not found")
+
+	r := httptest.NewRequest("POST", "http://example.com/register/", strings.NewReader(url.Values{"github_webhook_url": {githubWebhookURL}, "tracker_webhook_url": {trackerWebhookURL}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	RegisterHandler{Secret: secret}.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "is not a webhook url of this server (example.com)")
+}
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
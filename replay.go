@@ -0,0 +1,156 @@
+package githubtracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/pkg/errors"
+)
+
+// Replay pushes a captured payload through the webhook handlers again
+type Replay struct {
+	Out        io.Writer
+	WebhookURL string // the webhook url the payload was sent to; options are read from it
+	Secret     string // to decrypt the token of `WebhookURL`; not needed when `Fake`
+	Fake       bool   // find nothing and only print the writes, instead of calling the real apis
+}
+
+// Run replays `filename`, a payload saved by `Capture` or a fixture in testdata/
+func (r Replay) Run(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if headers, err := ioutil.ReadFile(headersFilename(filename)); err == nil {
+		if err = json.Unmarshal(headers, &header); err != nil {
+			return errors.Wrapf(err, "%s", headersFilename(filename))
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	// `Capture` redacted these and re-indented the body, so a signature can't be checked again
+	for _, k := range redactHeaders {
+		if header.Get(k) == "REDACTED" {
+			header.Del(k)
+		}
+	}
+
+	u, err := url.Parse(r.WebhookURL)
+	if err != nil {
+		return err
+	}
+	source := payloadSource(header, data)
+	switch {
+	case strings.Contains(u.Path, "/github/"):
+		source = "github"
+	case strings.Contains(u.Path, "/pivotaltracker/"):
+		source = "pivotaltracker"
+	}
+	if r.Fake {
+		return r.fake(source, data, u.Query())
+	}
+
+	var handler http.Handler = WebhookStoryHandler{}
+	if source == "github" {
+		handler = WebhookIssueHandler{}
+	}
+	req, err := http.NewRequest("POST", r.WebhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	w := httptest.NewRecorder()
+	crypto.Server{Secret: r.Secret}.RequireCipherNonce(handler).ServeHTTP(w, req)
+	fmt.Fprintf(r.Out, "%d %s\n", w.Code, strings.TrimSpace(w.Body.String()))
+	if w.Code >= 400 {
+		return errors.Errorf("%s responded %d", source, w.Code)
+	}
+	return nil
+}
+
+// fake runs the handler against apis that find nothing, and prints the writes it would have made
+func (r Replay) fake(source string, data []byte, values url.Values) error {
+	opts, err := syncOptionsFromValues(values)
+	if err != nil {
+		return err
+	}
+	writes := &dryRunLog{}
+	opts.dryRun = writes
+	if source == "github" {
+		err = WebhookIssueHandler{}.handle(data, dryRunTracker{fakeTracker{}, writes},
+			valueOr(values.Get("html_url"), "https://www.pivotaltracker.com"), opts)
+	} else {
+		err = WebhookStoryHandler{}.handle(data, dryRunGithub{fakeGithub{}, writes}, values.Get("repo"),
+			valueOr(values.Get("github_html_url"), "https://github.com"),
+			valueOr(values.Get("tracker_html_url"), "https://www.pivotaltracker.com"), opts)
+	}
+	for _, write := range writes.Writes {
+		payload, _ := json.Marshal(write.Payload)
+		fmt.Fprintf(r.Out, "%s %s %s\n", write.Method, write.Target, payload)
+	}
+	return err
+}
+
+// fakeTracker finds nothing; wrap it in `dryRunTracker` for the writes
+type fakeTracker struct {
+	trackerAPIClient
+}
+
+func (fakeTracker) FindStory(story *storyDetail) (*trackerSearchResultRow, error) {
+	return nil, nil
+}
+
+func (fakeTracker) GetStory(storyID string) (*trackerSearchResultRow, error) {
+	return nil, errors.Errorf("fake: no story %s", storyID)
+}
+
+func (fakeTracker) FindStoryByIssueURL(issueURL string) (*trackerSearchResultRow, error) {
+	return nil, nil
+}
+
+func (fakeTracker) GetEpic(epicID string) (*trackerEpic, error) {
+	return nil, errors.Errorf("fake: no epic %s", epicID)
+}
+
+func (fakeTracker) ListStories(offset int) ([]trackerSearchResultRow, error) {
+	return nil, nil
+}
+
+func (fakeTracker) RequiresChoreEstimate() bool {
+	return false
+}
+
+// fakeGithub finds nothing; wrap it in `dryRunGithub` for the writes
+type fakeGithub struct {
+	githubAPIClient
+}
+
+func (fakeGithub) FindIssue(issue *issueDetail) (*githubSearchResultRow, error) {
+	return nil, nil
+}
+
+func (fakeGithub) GetIssue(issue *issueDetail, rs *githubSearchResultRow) (*githubGetResult, error) {
+	return nil, errors.Errorf("fake: no issue %s", rs.HTMLURL)
+}
+
+func (fakeGithub) FindIssueByTrackerURL(repo, trackerURL string) (*githubSearchResultRow, error) {
+	return nil, nil
+}
+
+func (fakeGithub) SearchIssues(query string) ([]githubSearchResultRow, error) {
+	return nil, nil
+}
+
+func (fakeGithub) ListIssues(repo, state string, page int) ([]githubSearchResultRow, error) {
+	return nil, nil
+}
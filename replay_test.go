@@ -0,0 +1,130 @@
+package githubtracker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var received string
+	c := Capture{Dir: dir, Source: "github", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received = string(data)
+	})}
+	body := `{"action":"opened","issue":{"title":"hi"},"sender":{"login":"octocat","email":"octocat@example.com"}}`
+	r := httptest.NewRequest("POST", "/github/?token=abc&nonce=def", strings.NewReader(body))
+	r.Header.Set("X-GitHub-Event", "issues")
+	r.Header.Set("X-Hub-Signature", "sha1=abc")
+	c.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, body, received)
+
+	files, err := filepath.Glob(filepath.Join(dir, "github", "issues.opened.*.json"))
+	assert.Nil(t, err)
+	if !assert.Len(t, files, 2) {
+		return
+	}
+	saved := map[bool]string{}
+	for _, f := range files {
+		saved[strings.HasSuffix(f, ".headers.json")] = f
+	}
+	data, _ := ioutil.ReadFile(saved[false])
+	assert.Contains(t, string(data), `"email": "REDACTED"`)
+	assert.Contains(t, string(data), `"login": "octocat"`)
+	headers, _ := ioutil.ReadFile(saved[true])
+	assert.Contains(t, string(headers), `"REDACTED"`)
+	assert.NotContains(t, string(headers), "sha1=abc")
+}
+
+func TestCapturedName(t *testing.T) {
+	assert.Equal(t, "issues.edited", capturedName("github", http.Header{"X-Github-Event": []string{"issues"}}, []byte(`{"action":"edited"}`)))
+	assert.Equal(t, "push", capturedName("github", http.Header{"X-Github-Event": []string{"push"}}, []byte(`{"ref":"master"}`)))
+	assert.Equal(t, "story_update_activity", capturedName("pivotaltracker", http.Header{}, []byte(`{"kind":"story_update_activity"}`)))
+	assert.Equal(t, "activity", capturedName("pivotaltracker", http.Header{}, []byte(`{}`)))
+}
+
+func TestReplayFake(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := Replay{Out: out, WebhookURL: "https://example.com/github/?people=octocat+pt_cat", Fake: true}
+	assert.Nil(t, r.Run("testdata/github/issues.new.json"))
+	assert.Equal(t, `CreateStory  {"name":"users.email should have unique constraint","description":"https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five"}`+"\n", out.String())
+
+	out.Reset()
+	r = Replay{Out: out, WebhookURL: "https://example.com/pivotaltracker/?repo=user123/repo456", Fake: true}
+	assert.Nil(t, r.Run("testdata/tracker/story_update_activity.json"))
+	assert.True(t, strings.HasPrefix(out.String(), "CreateIssue user123/repo456 "), out.String())
+
+	// every fixture replays without touching an api; these look up an epic or story the fakes don't have
+	expectedErrors := map[string]string{
+		"testdata/github/issues.edited-epic.json":  "GetEpic 4012345: fake: no epic 4012345",
+		"testdata/github/pull_request.draft.json":  "GetStory 153984041: fake: no story 153984041",
+		"testdata/github/pull_request.opened.json": "GetStory 153984041: fake: no story 153984041",
+		"testdata/github/sub_issues.added.json":    "GetEpic 4012345: fake: no epic 4012345",
+	}
+	for _, source := range []string{"github", "tracker"} {
+		files, _ := filepath.Glob(filepath.Join("testdata", source, "*.json"))
+		for _, f := range files {
+			if strings.HasSuffix(f, ".headers.json") {
+				continue
+			}
+			r := Replay{Out: &bytes.Buffer{}, WebhookURL: "https://example.com/" + source + "/", Fake: true}
+			err := r.Run(f)
+			if expected, ok := expectedErrors[f]; ok {
+				if assert.NotNil(t, err, f) {
+					assert.Equal(t, expected, err.Error(), f)
+				}
+				continue
+			}
+			assert.Nil(t, err, f)
+		}
+	}
+}
+
+func TestReplayRun(t *testing.T) {
+	out := &bytes.Buffer{}
+	r := Replay{Out: out, WebhookURL: "https://example.com/github/?token=abc&nonce=def", Secret: "c1626442-0327-40a6-a830-c5517d6782d2"}
+	assert.NotNil(t, r.Run("testdata/github/issues.new.json"))
+	assert.Equal(t, "401 Unauthorized\n", out.String())
+}
+
+func TestReplayRunSigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	secret := "c1626442-0327-40a6-a830-c5517d6782d2"
+	token, nonce, err := crypto.EncryptWithSecretENV(secret, "abc")
+	assert.Nil(t, err)
+	webhookURL := "https://example.com/github/?" + url.Values{"token": {token}, "nonce": {nonce}}.Encode()
+
+	body := `{"zen":"Keep it logically awesome.","hook_id":1}`
+	r := httptest.NewRequest("POST", webhookURL, strings.NewReader(body))
+	r.Header.Set("X-GitHub-Event", "ping")
+	r.Header.Set("X-Hub-Signature-256", crypto.Signature(crypto.HookSecret(secret, nonce), []byte(body)))
+	w := httptest.NewRecorder()
+	c := Capture{Dir: dir, Source: "github", Handler: crypto.Server{Secret: secret}.RequireCipherNonce(WebhookIssueHandler{})}
+	c.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	files, err := filepath.Glob(filepath.Join(dir, "github", "ping.*[0-9].json"))
+	assert.Nil(t, err)
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	out := &bytes.Buffer{}
+	assert.Nil(t, Replay{Out: out, WebhookURL: webhookURL, Secret: secret}.Run(files[0]))
+	assert.Equal(t, "200 \n", out.String())
+}
@@ -0,0 +1,310 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// syncAmbiguousLabel marks github issues that share a title and can't be told apart
+const syncAmbiguousLabel = "sync-ambiguous"
+
+// closestTimeMargin is how much closer in time a candidate must be than the others to be picked;
+// items of the same title made within minutes of each other are as plausible as each other
+const closestTimeMargin = 10 * time.Minute
+
+var issueInURL = regexp.MustCompile(`([^/]+/[^/]+)/issues/(\d+)$`)
+
+// ambiguousError is returned by FindStory and FindIssue when several items have the title,
+// and `pickStory` or `pickIssue` can't tell which one is meant
+type ambiguousError struct {
+	Stories []trackerSearchResultRow
+	Issues  []githubSearchResultRow
+}
+
+func (e *ambiguousError) Error() string {
+	return fmt.Sprintf("%s: %d stories, %d issues", multipleMatchesError.Error(), len(e.Stories), len(e.Issues))
+}
+
+// isMultipleMatches tells if `err` is `multipleMatchesError` or an `ambiguousError`
+func isMultipleMatches(err error) bool {
+	_, ok := err.(*ambiguousError)
+	return ok || err == multipleMatchesError
+}
+
+// pickStory chooses among stories of the same title: the one whose description links back
+// to the issue, then the one created closest to the issue; nil if that's still a tie
+func pickStory(story *storyDetail, candidates []trackerSearchResultRow) *trackerSearchResultRow {
+	linked := []int{}
+	for i, c := range candidates {
+		if story.issueURL != "" && hasLinkPrefix(c.Description, story.issueURL) {
+			linked = append(linked, i)
+		}
+	}
+	if len(linked) == 1 {
+		return &candidates[linked[0]]
+	}
+	times := []time.Time{}
+	for _, c := range candidates {
+		times = append(times, c.CreatedAt)
+	}
+	if i := closestTime(story.createdAt, times); i >= 0 {
+		return &candidates[i]
+	}
+	return nil
+}
+
+// pickIssue is `pickStory` for issues of the same title, linking back to `issue.storyURL`
+func pickIssue(issue *issueDetail, candidates []githubSearchResultRow) *githubSearchResultRow {
+	linked := []int{}
+	for i, c := range candidates {
+		if issue.storyURL != "" && bodyLinksTo(c.Body, issue.storyURL) {
+			linked = append(linked, i)
+		}
+	}
+	if len(linked) == 1 {
+		return &candidates[linked[0]]
+	}
+	times := []time.Time{}
+	for _, c := range candidates {
+		times = append(times, c.CreatedAt)
+	}
+	if i := closestTime(issue.createdAt, times); i >= 0 {
+		return &candidates[i]
+	}
+	return nil
+}
+
+// closestTime returns the index of `times` closest to `t`, or -1 if anything is unknown or the
+// runner-up is within `closestTimeMargin` of it
+func closestTime(t time.Time, times []time.Time) int {
+	if t.IsZero() {
+		return -1
+	}
+	best, bestDistance, runnerUp := -1, time.Duration(0), time.Duration(-1)
+	for i, at := range times {
+		if at.IsZero() {
+			return -1
+		}
+		distance := at.Sub(t)
+		if distance < 0 {
+			distance = -distance
+		}
+		switch {
+		case best < 0:
+			best, bestDistance = i, distance
+		case distance < bestDistance:
+			best, bestDistance, runnerUp = i, distance, bestDistance
+		case runnerUp < 0 || distance < runnerUp:
+			runnerUp = distance
+		}
+	}
+	if runnerUp >= 0 && runnerUp-bestDistance < closestTimeMargin {
+		return -1
+	}
+	return best
+}
+
+// ReviewQueue keeps the issues and stories whose title matched several counterparts, until an
+// operator chooses one with `Choose`; the webhooks then sync with the chosen one. kept in a json file
+type ReviewQueue struct {
+	Filename string
+	Unlabel  func(issueURL string) error // optional; takes `syncAmbiguousLabel` off candidate issues once chosen, see `AmbiguousLabelRemover`
+	mu       sync.Mutex
+}
+
+type reviewItem struct {
+	SourceURL  string    `json:"source_url"`
+	Title      string    `json:"title"`
+	Candidates []string  `json:"candidates"`
+	Chosen     string    `json:"chosen,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+func (q *ReviewQueue) load() ([]reviewItem, error) {
+	items := []reviewItem{}
+	data, err := ioutil.ReadFile(q.Filename)
+	if os.IsNotExist(err) {
+		return items, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return items, errors.Wrapf(json.Unmarshal(data, &items), "%s", q.Filename)
+}
+
+func (q *ReviewQueue) save(items []reviewItem) error {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(q.Filename, data, 0644)
+}
+
+// add records that `sourceURL` matched all of `candidates`, keeping any earlier choice;
+// without a queue it's only logged, and in dry run it goes into `dryRun` instead
+func (q *ReviewQueue) add(sourceURL, title string, candidates []string, dryRun *dryRunLog) error {
+	log.Printf("%s %q matches %v; waiting for a choice", sourceURL, title, candidates)
+	if dryRun != nil {
+		return dryRun.skip("QueueReview", sourceURL, reviewItem{SourceURL: sourceURL, Title: title, Candidates: candidates})
+	}
+	if q == nil || q.Filename == "" {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items, err := q.load()
+	if err != nil {
+		return err
+	}
+	item := reviewItem{SourceURL: sourceURL, Title: title, Candidates: candidates, At: time.Now().UTC()}
+	for i := range items {
+		if items[i].SourceURL == sourceURL {
+			item.Chosen = items[i].Chosen
+			items[i] = item
+			return q.save(items)
+		}
+	}
+	return q.save(append(items, item))
+}
+
+// chosen returns the candidate url an operator chose for `sourceURL`, if any
+func (q *ReviewQueue) chosen(sourceURL string) string {
+	if q == nil || q.Filename == "" {
+		return ""
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items, err := q.load()
+	if err != nil {
+		log.Println(err.Error())
+		return ""
+	}
+	for _, item := range items {
+		if item.SourceURL == sourceURL {
+			return item.Chosen
+		}
+	}
+	return ""
+}
+
+// Choose pairs `sourceURL` with `candidateURL`, one of the candidates it was queued with, and
+// unlabels the candidate issues
+func (q *ReviewQueue) Choose(sourceURL, candidateURL string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items, err := q.load()
+	if err != nil {
+		return err
+	}
+	for i, item := range items {
+		if item.SourceURL != sourceURL {
+			continue
+		}
+		for _, c := range item.Candidates {
+			if c == candidateURL {
+				items[i].Chosen = candidateURL
+				if err = q.save(items); err != nil {
+					return err
+				}
+				return q.unlabel(item.Candidates)
+			}
+		}
+		return errors.Errorf("%s is not a candidate of %s: %v", candidateURL, sourceURL, item.Candidates)
+	}
+	return errors.Errorf("%s is not in %s", sourceURL, q.Filename)
+}
+
+// unlabel takes `syncAmbiguousLabel` off the issues among `candidates`
+func (q *ReviewQueue) unlabel(candidates []string) error {
+	if q.Unlabel == nil {
+		return nil
+	}
+	for _, c := range candidates {
+		if !issueInURL.MatchString(c) {
+			continue
+		}
+		if err := q.Unlabel(c); err != nil {
+			return errors.Wrapf(err, "unlabel %s", c)
+		}
+	}
+	return nil
+}
+
+// AmbiguousLabelRemover is a `ReviewQueue.Unlabel` with the GH credentials of a pivotaltracker
+// webhook url (decrypted), routes included
+func AmbiguousLabelRemover(storyValues url.Values) func(issueURL string) error {
+	g := githubAPI{
+		Client:   http.DefaultClient,
+		Token:    storyValues.Get("token"),
+		Username: storyValues.Get("username"),
+		URL:      storyValues.Get("api_url"),
+	}
+	routes := routesFromValues(storyValues)
+	return func(issueURL string) error {
+		m := issueInURL.FindStringSubmatch(issueURL)
+		if m == nil {
+			return errors.Errorf("%s is not a GH issue url", issueURL)
+		}
+		client := routeTo(routes, m[1]).github(g)
+		targetURL := fmt.Sprintf("%s/repos/%s/issues/%s/labels/%s", client.URL, m[1], m[2], url.PathEscape(syncAmbiguousLabel))
+		if _, err := client.perform("DELETE", targetURL, nil, http.StatusOK); err != nil && statusOf(err) != http.StatusNotFound {
+			return err
+		}
+		return nil
+	}
+}
+
+// Print lists the queue, the ones waiting for a choice first
+func (q *ReviewQueue) Print(w io.Writer) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items, err := q.load()
+	if err != nil {
+		return err
+	}
+	for _, chosen := range []bool{false, true} {
+		for _, item := range items {
+			if (item.Chosen != "") != chosen {
+				continue
+			}
+			fmt.Fprintf(w, "%s %q (%s)\n", item.SourceURL, item.Title, item.At.Format(time.RFC3339))
+			for _, c := range item.Candidates {
+				mark := " "
+				if c == item.Chosen {
+					mark = "*"
+				}
+				fmt.Fprintf(w, "  %s %s\n", mark, c)
+			}
+		}
+	}
+	return nil
+}
+
+// storyURLs and issueURLs are the candidates of `e`, as queued
+func (e *ambiguousError) storyURLs(trackerHTMLURL string) []string {
+	urls := []string{}
+	for _, s := range e.Stories {
+		urls = append(urls, fmt.Sprintf("%s/story/show/%s", strings.TrimRight(trackerHTMLURL, "/"), s.ID.String()))
+	}
+	return urls
+}
+
+func (e *ambiguousError) issueURLs() []string {
+	urls := []string{}
+	for _, i := range e.Issues {
+		urls = append(urls, i.HTMLURL)
+	}
+	return urls
+}
@@ -0,0 +1,232 @@
+package githubtracker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClosestTime(t *testing.T) {
+	at := time.Date(2017, 12, 25, 14, 54, 21, 0, time.UTC)
+	testCases := []struct {
+		name       string
+		givenAt    time.Time
+		givenTimes []time.Time
+		expected   int
+	}{
+		{name: "closest", givenAt: at, givenTimes: []time.Time{at.Add(-time.Hour), at.Add(time.Minute)}, expected: 1},
+		{name: "tied", givenAt: at, givenTimes: []time.Time{at.Add(-time.Minute), at.Add(time.Minute)}, expected: -1},
+		{name: "within the margin", givenAt: at, givenTimes: []time.Time{at.Add(-5 * time.Minute), at.Add(time.Minute), at.Add(time.Hour)}, expected: -1},
+		{name: "runner-up after the closest", givenAt: at, givenTimes: []time.Time{at.Add(time.Second), at.Add(2 * time.Minute)}, expected: -1},
+		{name: "only one", givenAt: at, givenTimes: []time.Time{at.Add(time.Hour)}, expected: 0},
+		{name: "unknown candidate", givenAt: at, givenTimes: []time.Time{at, {}}, expected: -1},
+		{name: "unknown source", givenTimes: []time.Time{at, at.Add(time.Minute)}, expected: -1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, closestTime(tc.givenAt, tc.givenTimes))
+		})
+	}
+}
+
+func TestPickStory(t *testing.T) {
+	at := time.Date(2017, 12, 25, 14, 54, 21, 0, time.UTC)
+	story := &storyDetail{issueURL: "https://github.com/user123/repo456/issues/1", createdAt: at}
+	candidates := []trackerSearchResultRow{
+		{ID: alwaysString{"1"}, Description: "https://github.com/user123/repo456/issues/12\r\n\r\nhi", CreatedAt: at.Add(time.Second)},
+		{ID: alwaysString{"2"}, Description: "https://github.com/user123/repo456/issues/1\r\n\r\nhi", CreatedAt: at.Add(time.Hour)},
+	}
+	assert.Equal(t, "2", pickStory(story, candidates).ID.String(), "links back")
+	candidates[1].Description = "hi"
+	assert.Equal(t, "1", pickStory(story, candidates).ID.String(), "closest")
+	story.createdAt = time.Time{}
+	assert.Nil(t, pickStory(story, candidates))
+}
+
+func TestPickIssue(t *testing.T) {
+	storyURL := "https://www.pivotaltracker.com/story/show/153926473"
+	issue := &issueDetail{storyURL: storyURL}
+	candidates := []githubSearchResultRow{
+		{Number: 1, Body: "hi"},
+		{Number: 2, Body: storyURL + "\r\n<!-- tracker link: " + storyURL + " version:1 -->\r\n\r\nhi"},
+	}
+	assert.Equal(t, int64(2), pickIssue(issue, candidates).Number)
+	candidates[1].Body = "hi"
+	assert.Nil(t, pickIssue(issue, candidates))
+}
+
+func TestReviewQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "review")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	q := &ReviewQueue{Filename: filepath.Join(dir, "review.json")}
+	source, a, b := "https://www.pivotaltracker.com/story/show/1", "https://github.com/user123/repo456/issues/1", "https://github.com/user123/repo456/issues/2"
+	assert.Nil(t, q.add(source, "hello", []string{a, b}, nil))
+	assert.Equal(t, "", q.chosen(source))
+	assert.NotNil(t, q.Choose(source, "https://github.com/user123/repo456/issues/3"))
+	assert.NotNil(t, q.Choose("https://www.pivotaltracker.com/story/show/2", a))
+	assert.Nil(t, q.Choose(source, b))
+	assert.Equal(t, b, q.chosen(source))
+
+	// queued again, e.g. before the next change synced
+	assert.Nil(t, q.add(source, "hello", []string{a, b}, nil))
+	assert.Equal(t, b, q.chosen(source))
+
+	// choosing takes the label off the candidate issues, not the stories
+	unlabelled := []string{}
+	q.Unlabel = func(issueURL string) error {
+		unlabelled = append(unlabelled, issueURL)
+		return nil
+	}
+	assert.Nil(t, q.Choose(source, a))
+	assert.Equal(t, []string{a, b}, unlabelled)
+	assert.Nil(t, q.add("https://github.com/user123/repo456/issues/3", "hello", []string{source}, nil))
+	assert.Nil(t, q.Choose("https://github.com/user123/repo456/issues/3", source))
+	assert.Equal(t, []string{a, b}, unlabelled)
+	q.Unlabel = nil
+	assert.Nil(t, q.Choose(source, b))
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, q.Print(out))
+	assert.Contains(t, out.String(), "\n    "+a+"\n  * "+b+"\n")
+
+	// without a file, nothing is queued nor chosen
+	var none *ReviewQueue
+	assert.Nil(t, none.add(source, "hello", []string{a, b}, nil))
+	assert.Equal(t, "", none.chosen(source))
+}
+
+func TestAmbiguousStories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "review")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile("testdata/github/issues.edited.json")
+	assert.Nil(t, err)
+	ambiguous := &ambiguousError{Stories: []trackerSearchResultRow{{ID: alwaysString{"41"}}, {ID: alwaysString{"42"}}}}
+	handler := WebhookIssueHandler{Review: &ReviewQueue{Filename: filepath.Join(dir, "review.json")}}
+
+	logclient := logTrackerClient{ExpectedError: ambiguous}
+	assert.Nil(t, handler.handle(data, &logclient, "https://www.pivotaltracker.com", syncOptions{}))
+	assert.Len(t, logclient.History, 1) // FindStory, and nothing else
+
+	// in dry run the queue is left alone
+	dryRun := &dryRunLog{}
+	dryRunHandler := WebhookIssueHandler{Review: &ReviewQueue{Filename: filepath.Join(dir, "dry-run.json")}}
+	assert.Nil(t, dryRunHandler.handle(data, &logTrackerClient{ExpectedError: ambiguous}, "https://www.pivotaltracker.com", syncOptions{DryRun: true, dryRun: dryRun}))
+	if assert.Len(t, dryRun.Writes, 1) {
+		assert.Equal(t, "QueueReview", dryRun.Writes[0].Method)
+		assert.Equal(t, "https://github.com/user123/repo456/issues/1", dryRun.Writes[0].Target)
+	}
+	_, err = os.Stat(dryRunHandler.Review.Filename)
+	assert.True(t, os.IsNotExist(err), "review file written in dry run")
+
+	issueURL := "https://github.com/user123/repo456/issues/1"
+	assert.Nil(t, handler.Review.Choose(issueURL, "https://www.pivotaltracker.com/story/show/42"))
+	logclient = logTrackerClient{}
+	client := ambiguousTracker{&logclient, ambiguous}
+	assert.Nil(t, handler.handle(data, client, "https://www.pivotaltracker.com", syncOptions{}))
+	if assert.Len(t, logclient.History, 1) {
+		assert.Equal(t, "UpdateStory", logclient.History[0].Method)
+		assert.Equal(t, "42", logclient.History[0].GivenID)
+	}
+}
+
+// ambiguousTracker finds several stories, and logs the rest
+type ambiguousTracker struct {
+	*logTrackerClient
+	err *ambiguousError
+}
+
+func (a ambiguousTracker) FindStory(story *storyDetail) (*trackerSearchResultRow, error) {
+	return nil, a.err
+}
+
+func TestAmbiguousIssues(t *testing.T) {
+	body := "new description"
+	story := &webhookStory{
+		URL:           "https://www.pivotaltracker.com/story/show/153926473",
+		StoryID:       "153926473",
+		Title:         "Hey, World!",
+		Body:          &body,
+		githubHTMLURL: "https://github.com",
+	}
+	logclient := logGithubClient{}
+	client := ambiguousGithub{&logclient, &ambiguousError{Issues: []githubSearchResultRow{
+		{Number: 1, Labels: []webhookLabel{{Name: "bug"}}},
+		{Number: 2, Labels: []webhookLabel{{Name: syncAmbiguousLabel}}},
+	}}}
+	err := WebhookStoryHandler{}.handleStory(story, client, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com", syncOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []logAction{
+		{Method: "UpdateIssue", GivenID: "1", GivenLabels: []string{"bug", syncAmbiguousLabel}},
+	}, logclient.History)
+}
+
+// ambiguousGithub finds several issues, and logs the rest
+type ambiguousGithub struct {
+	*logGithubClient
+	err *ambiguousError
+}
+
+func (a ambiguousGithub) FindIssue(issue *issueDetail) (*githubSearchResultRow, error) {
+	return nil, a.err
+}
+
+func TestAmbiguousStoriesQueued(t *testing.T) {
+	dir, err := ioutil.TempDir("", "review")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// two stories of the title, made a minute apart around when the issue was
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"stories":{"stories":[
+			{"id":41,"name":"users.email should have unique constraint","created_at":"2017-12-25T14:51:40Z"},
+			{"id":42,"name":"users.email should have unique constraint","created_at":"2017-12-25T14:52:40Z"}
+		]}}`))
+	}))
+	defer server.Close()
+
+	data, err := ioutil.ReadFile("testdata/github/issues.new.json")
+	assert.Nil(t, err)
+	handler := WebhookIssueHandler{Review: &ReviewQueue{Filename: filepath.Join(dir, "review.json")}}
+	client := trackerAPI{Client: http.DefaultClient, Token: "pt-token", URL: server.URL + "/services/v5/projects/99"}
+	assert.Nil(t, handler.handle(data, client, "https://www.pivotaltracker.com", syncOptions{}))
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, handler.Review.Print(out))
+	assert.Contains(t, out.String(), `https://github.com/user123/repo456/issues/1 "users.email should have unique constraint"`)
+	assert.Contains(t, out.String(), "https://www.pivotaltracker.com/story/show/41\n")
+	assert.Contains(t, out.String(), "https://www.pivotaltracker.com/story/show/42\n")
+}
+
+func TestAmbiguousLabelRemover(t *testing.T) {
+	deleted := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/api/v3/repos/user123/repo456/issues/2/labels/sync-ambiguous" {
+			w.WriteHeader(http.StatusNotFound) // not labelled anymore
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	unlabel := AmbiguousLabelRemover(url.Values{"token": {"gh-token"}, "username": {"octocat"}, "api_url": {server.URL + "/api/v3"}, "repo": {"user123/repo456"}})
+	assert.Nil(t, unlabel("https://github.com/user123/repo456/issues/1"))
+	assert.Nil(t, unlabel("https://github.com/user123/repo456/issues/2"))
+	assert.NotNil(t, unlabel("https://www.pivotaltracker.com/story/show/1"))
+	assert.Equal(t, []string{
+		"DELETE /api/v3/repos/user123/repo456/issues/1/labels/sync-ambiguous",
+		"DELETE /api/v3/repos/user123/repo456/issues/2/labels/sync-ambiguous",
+	}, deleted)
+}
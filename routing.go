@@ -0,0 +1,254 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// route sends matching stories, issues or commits somewhere other than the default, e.g.
+// "label:repo:web acme/web" or "path:services/api/ https://www.pivotaltracker.com/services/v5/projects/2".
+// a target the token of the webhook url can't reach takes its own, e.g. "label:repo:web acme/web token=...",
+// and on GH maybe "username=..." and "api_url=..." too
+type route struct {
+	Label      string
+	PathPrefix string
+	Target     string
+	Token      string
+	Username   string
+	APIURL     string
+}
+
+type webhookLabel struct {
+	Name string `json:"name"`
+}
+
+// routesFromValues reads `route` values, one route per line
+func routesFromValues(values url.Values) []route {
+	routes := []route{}
+	for _, value := range values["route"] {
+		for _, line := range strings.Split(value, "\n") {
+			r, fields := route{}, strings.Fields(line)
+		credentials:
+			for len(fields) > 0 {
+				kv := strings.SplitN(fields[len(fields)-1], "=", 2)
+				if len(kv) != 2 {
+					break
+				}
+				switch kv[0] {
+				case "token":
+					r.Token = kv[1]
+				case "username":
+					r.Username = kv[1]
+				case "api_url":
+					r.APIURL = kv[1]
+				default:
+					break credentials
+				}
+				fields = fields[:len(fields)-1]
+			}
+			if len(fields) < 2 {
+				continue
+			}
+			r.Target = fields[len(fields)-1]
+			match := strings.Join(fields[:len(fields)-1], " ")
+			switch {
+			case strings.HasPrefix(match, "label:"):
+				r.Label = strings.TrimPrefix(match, "label:")
+			case strings.HasPrefix(match, "path:"):
+				r.PathPrefix = strings.TrimPrefix(match, "path:")
+			default:
+				continue
+			}
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+func (r route) matches(labels, paths []string) bool {
+	if r.Label != "" {
+		for _, label := range labels {
+			if strings.EqualFold(strings.TrimSpace(label), r.Label) {
+				return true
+			}
+		}
+	}
+	if r.PathPrefix != "" {
+		for _, path := range paths {
+			if strings.HasPrefix(strings.TrimPrefix(path, "/"), strings.TrimPrefix(r.PathPrefix, "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// routeTarget returns the first matching route, or the route to `defaultTarget`
+func routeTarget(routes []route, labels, paths []string, defaultTarget string) route {
+	for _, r := range routes {
+		if r.matches(labels, paths) {
+			return r
+		}
+	}
+	return route{Target: defaultTarget}
+}
+
+// routeTo returns the route to `target`, with its credentials if any
+func routeTo(routes []route, target string) route {
+	for _, r := range routes {
+		if strings.EqualFold(r.Target, target) {
+			return r
+		}
+	}
+	return route{Target: target}
+}
+
+// routeGroup are the targets reached with the same credentials, those of `route`
+type routeGroup struct {
+	route   route
+	targets []string
+}
+
+// routeGroups returns `defaultTarget` with the routes that use the token of the webhook url,
+// then the routes with a token of their own, one group each
+func routeGroups(routes []route, defaultTarget string) []routeGroup {
+	groups := []routeGroup{{route: route{Target: defaultTarget}, targets: []string{defaultTarget}}}
+	for _, r := range routes {
+		if r.Token == "" {
+			groups[0].targets = append(groups[0].targets, r.Target)
+			continue
+		}
+		groups = append(groups, routeGroup{route: r, targets: []string{r.Target}})
+	}
+	groups[0].targets = uniqueStrings(groups[0].targets)
+	return groups
+}
+
+// github returns `g` for the repo of `r`, with its credentials if any
+func (r route) github(g githubAPI) githubAPI {
+	g.Repo = r.Target
+	if r.Token != "" {
+		g.Token = r.Token
+		if r.Username != "" {
+			g.Username = r.Username
+		}
+		if r.APIURL != "" {
+			g.URL = strings.TrimRight(r.APIURL, "/")
+		}
+	}
+	return g
+}
+
+// tracker returns `t` for the project of `r`, with its token if any
+func (r route) tracker(t trackerAPI) trackerAPI {
+	t.URL = strings.TrimRight(r.Target, "/")
+	if r.Token != "" {
+		t.Token = r.Token
+	}
+	return t
+}
+
+// projectRoute picks the route to a pivotal tracker project api url for a github webhook,
+// by labels of the issue or pull request, or by files touched by pushed commits
+func projectRoute(data []byte, routes []route, defaultURL string) (route, error) {
+	if len(routes) == 0 {
+		return route{Target: defaultURL}, nil
+	}
+	wh := githubWebhook{}
+	if err := json.Unmarshal(data, &wh); err != nil {
+		return route{}, errors.Wrap(err, "unmarshal route")
+	}
+
+	labels := []string{}
+	for _, issue := range []*webhookIssue{wh.WebhookIssue, wh.SubIssue} {
+		if issue != nil {
+			for _, l := range issue.Labels {
+				labels = append(labels, l.Name)
+			}
+		}
+	}
+	if wh.PullRequest != nil {
+		for _, l := range wh.PullRequest.Labels {
+			labels = append(labels, l.Name)
+		}
+	}
+	paths := []string{}
+	for _, c := range wh.Commits {
+		paths = append(append(append(paths, c.Added...), c.Removed...), c.Modified...)
+	}
+
+	return routeTarget(routes, labels, paths, defaultURL), nil
+}
+
+// linkedRepo returns "owner/repo" if `s` starts with a github issue url
+func linkedRepo(s, githubHTMLURL string) string {
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(strings.TrimRight(githubHTMLURL, "/")) + `/([^/\s]+/[^/\s]+)/issues/\d+`)
+	if res := re.FindStringSubmatch(strings.TrimSpace(s)); res != nil {
+		return res[1]
+	}
+	return ""
+}
+
+// storyRepo picks the github repository for a pivotal tracker webhook: the repository of the
+// linked issue, else a route matching the story labels, else wherever an issue already links to
+// the story, searched with the credentials of each route
+func storyRepo(data []byte, clientFor func(route) githubAPIClient, routes []route, defaultRepo, githubHTMLURL, trackerHTMLURL string) (string, error) {
+	if len(routes) == 0 {
+		return defaultRepo, nil
+	}
+	var wh trackerWebhook
+	if err := json.Unmarshal(data, &wh); err != nil {
+		return "", errors.Wrapf(err, "json unmarshal")
+	}
+
+	groups := routeGroups(routes, defaultRepo)
+	known := map[string]bool{}
+	for _, g := range groups {
+		for _, repo := range g.targets {
+			known[strings.ToLower(repo)] = true
+		}
+	}
+
+	labels := []string{}
+	var storyID int64
+	for _, c := range wh.Changes {
+		if c.Kind != "story" {
+			continue
+		}
+		storyID = c.ID
+		labels = append(labels, c.NewValues.Labels...)
+		if c.NewValues.Description != nil {
+			if repo := linkedRepo(*c.NewValues.Description, githubHTMLURL); known[strings.ToLower(repo)] {
+				return repo, nil
+			}
+		}
+	}
+	if r := routeTarget(routes, labels, nil, ""); r.Target != "" {
+		return r.Target, nil
+	}
+	if storyID == 0 {
+		return defaultRepo, nil
+	}
+
+	for _, g := range groups {
+		query := fmt.Sprintf("%q in:body is:issue", fmt.Sprintf("%s/story/show/%d", trackerHTMLURL, storyID))
+		for _, repo := range g.targets {
+			query = query + " repo:" + repo
+		}
+		items, err := clientFor(g.route).SearchIssues(query)
+		if err != nil {
+			return "", errors.Wrapf(err, "SearchIssues %s", query)
+		}
+		for _, item := range items {
+			if repo := linkedRepo(item.HTMLURL, githubHTMLURL); known[strings.ToLower(repo)] {
+				return repo, nil
+			}
+		}
+	}
+	return defaultRepo, nil
+}
@@ -0,0 +1,188 @@
+package githubtracker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/choonkeat/githubtracker/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutesFromValues(t *testing.T) {
+	values := url.Values{"route": []string{
+		"label:repo:web acme/web\r\nlabel:needs design acme/design\n\nnonsense",
+		"path:services/api/ https://www.pivotaltracker.com/services/v5/projects/2",
+		"label:repo:ops other/ops token=gh-token-2 username=octobot api_url=https://ghe.example.com/api/v3",
+	}}
+	assert.Equal(t, []route{
+		{Label: "repo:web", Target: "acme/web"},
+		{Label: "needs design", Target: "acme/design"},
+		{PathPrefix: "services/api/", Target: "https://www.pivotaltracker.com/services/v5/projects/2"},
+		{Label: "repo:ops", Target: "other/ops", Token: "gh-token-2", Username: "octobot", APIURL: "https://ghe.example.com/api/v3"},
+	}, routesFromValues(values))
+}
+
+func TestProjectURL(t *testing.T) {
+	routes := []route{
+		{Label: "backend", Target: "https://www.pivotaltracker.com/services/v5/projects/2"},
+		{PathPrefix: "/services/api", Target: "https://www.pivotaltracker.com/services/v5/projects/3"},
+	}
+	testCases := []struct {
+		givenFile   string
+		givenRoutes []route
+		expectedURL string
+	}{
+		{
+			givenFile:   "testdata/github/issues.new-labelled.json",
+			expectedURL: "https://www.pivotaltracker.com/services/v5/projects/1",
+		},
+		{
+			givenFile:   "testdata/github/issues.new-labelled.json",
+			givenRoutes: routes,
+			expectedURL: "https://www.pivotaltracker.com/services/v5/projects/2",
+		},
+		{
+			givenFile:   "testdata/github/push.paths.json",
+			givenRoutes: routes,
+			expectedURL: "https://www.pivotaltracker.com/services/v5/projects/3",
+		},
+		{
+			givenFile:   "testdata/github/issues.new.json",
+			givenRoutes: routes,
+			expectedURL: "https://www.pivotaltracker.com/services/v5/projects/1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.givenFile, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.givenFile)
+			if err != nil {
+				t.Fatalf("readfile: %s", err.Error())
+			}
+			actual, err := projectRoute(data, tc.givenRoutes, "https://www.pivotaltracker.com/services/v5/projects/1")
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedURL, actual.Target)
+		})
+	}
+}
+
+func TestStoryRepo(t *testing.T) {
+	routes := []route{
+		{Label: "checkout flow", Target: "acme/web"},
+		{Label: "repo:api", Target: "acme/api"},
+	}
+	testCases := []struct {
+		givenFile       string
+		givenRoutes     []route
+		givenSearch     []githubSearchResultRow
+		expectedRepo    string
+		expectedHistory []logAction
+	}{
+		{
+			givenFile:    "testdata/tracker/story_label_activity.json",
+			expectedRepo: "user123/repo456",
+		},
+		{
+			givenFile:    "testdata/tracker/story_label_activity.json",
+			givenRoutes:  routes,
+			expectedRepo: "acme/web",
+		},
+		{
+			givenFile:   "testdata/tracker/story_update_activity.accepted.json",
+			givenRoutes: routes,
+			givenSearch: []githubSearchResultRow{
+				{Number: 3, HTMLURL: "https://github.com/acme/api/issues/3"},
+			},
+			expectedRepo: "acme/api",
+			expectedHistory: []logAction{
+				{
+					Method:  "SearchIssues",
+					GivenID: `"https://www.pivotaltracker.com/story/show/153926473" in:body is:issue repo:user123/repo456 repo:acme/web repo:acme/api`,
+				},
+			},
+		},
+		{
+			givenFile:    "testdata/tracker/story_update_activity.accepted.json",
+			givenRoutes:  routes,
+			expectedRepo: "user123/repo456",
+			expectedHistory: []logAction{
+				{
+					Method:  "SearchIssues",
+					GivenID: `"https://www.pivotaltracker.com/story/show/153926473" in:body is:issue repo:user123/repo456 repo:acme/web repo:acme/api`,
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.givenFile, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.givenFile)
+			if err != nil {
+				t.Fatalf("readfile: %s", err.Error())
+			}
+			logclient := logGithubClient{ExpectedSearch: tc.givenSearch}
+			clientFor := func(route) githubAPIClient { return &logclient }
+			actual, err := storyRepo(data, clientFor, tc.givenRoutes, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com")
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedRepo, actual)
+			assert.Equal(t, tc.expectedHistory, logclient.History)
+		})
+	}
+}
+
+func TestRoutedCredentials(t *testing.T) {
+	seen := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-TrackerToken")
+		if _, password, ok := r.BasicAuth(); ok {
+			token = password
+		}
+		seen = append(seen, token+" "+r.URL.Path)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	cryptoServer := crypto.Server{Secret: "c1626442-0327-40a6-a830-c5517d6782d2"}
+	deliver := func(form url.Values, h http.Handler, payload string) {
+		webhookURL, _, err := cryptoServer.Generate(form)
+		assert.Nil(t, err)
+		assert.NotContains(t, webhookURL, "route=", "routes with tokens are encrypted")
+		data, err := ioutil.ReadFile(payload)
+		assert.Nil(t, err)
+		w := httptest.NewRecorder()
+		cryptoServer.RequireCipherNonce(h).ServeHTTP(w, httptest.NewRequest("POST", webhookURL, bytes.NewReader(data)))
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	deliver(url.Values{
+		"target_path": {"/github/"},
+		"token":       {"pt-token"},
+		"api_url":     {server.URL + "/services/v5/projects/1"},
+		"route":       {"label:backend " + server.URL + "/services/v5/projects/2 token=pt-token-2"},
+	}, WebhookIssueHandler{}, "testdata/github/issues.new-labelled.json")
+	if assert.NotEmpty(t, seen) {
+		for _, s := range seen {
+			assert.Regexp(t, `^pt-token-2 /services/v5/projects/2/`, s)
+		}
+	}
+
+	seen = []string{}
+	deliver(url.Values{
+		"target_path":      {"/pivotaltracker/"},
+		"token":            {"gh-token"},
+		"username":         {"octocat"},
+		"api_url":          {server.URL + "/api/v3"},
+		"repo":             {"user123/repo456"},
+		"github_html_url":  {"https://github.com"},
+		"tracker_html_url": {"https://www.pivotaltracker.com"},
+		"route":            {"label:checkout flow other/web token=gh-token-2 username=octobot"},
+	}, WebhookStoryHandler{}, "testdata/tracker/story_label_activity.json")
+	if assert.NotEmpty(t, seen) {
+		for _, s := range seen {
+			assert.Regexp(t, `^gh-token-2 /api/v3/(repos/other/web/|search/)`, s)
+		}
+	}
+}
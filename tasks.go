@@ -0,0 +1,21 @@
+package githubtracker
+
+// tasksSection mirrors pivotal tracker story tasks
+var tasksSection = checklistSection{name: "tasks", idLabel: "task"}
+
+// payload to be sent to pivotaltracker.com story tasks
+type storyTask struct {
+	ID          string `json:"-"`
+	Description string `json:"description,omitempty"`
+	Complete    bool   `json:"complete"`
+	Position    int    `json:"position,omitempty"`
+}
+
+func storyTaskFromChecklistItem(item checklistItem) *storyTask {
+	return &storyTask{
+		ID:          item.ID,
+		Description: item.Text,
+		Complete:    item.Checked,
+		Position:    item.Position,
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -31,14 +32,19 @@ const (
 
 // payload to be sent to pivotaltracker.com
 type storyDetail struct {
-	Title         string   `json:"name,omitempty"`
-	Body          string   `json:"description,omitempty"`
-	SearchFilters []string `json:"-"`
-	IsClosed      bool     `json:"-"`
-	IsOpened      bool     `json:"-"`
-	Estimate      *int     `json:"estimate,omitempty"`
-	CurrentState  string   `json:"current_state,omitempty"`
-	StoryType     string   `json:"story_type,omitempty"`
+	Title          string            `json:"name,omitempty"`
+	Body           string            `json:"description,omitempty"`
+	SearchFilters  []string          `json:"-"`
+	IsClosed       bool              `json:"-"`
+	IsOpened       bool              `json:"-"`
+	Estimate       *int              `json:"estimate,omitempty"`
+	CurrentState   string            `json:"current_state,omitempty"`
+	StoryType      string            `json:"story_type,omitempty"`
+	TaskChanges    []checklistChange `json:"-"`
+	BlockerChanges []checklistChange `json:"-"`
+	Blockers       []storyBlocker    `json:"blockers,omitempty"` // only when creating
+	issueURL       string
+	createdAt      time.Time // of the issue, to tell stories of the same title apart
 }
 
 type trackerAPIClient interface {
@@ -46,6 +52,21 @@ type trackerAPIClient interface {
 	CreateStory(story *storyDetail) error
 	UpdateStory(story *storyDetail, rs *trackerSearchResultRow) error
 	GetStory(storyID string) (*trackerSearchResultRow, error)
+	FindStoryByIssueURL(issueURL string) (*trackerSearchResultRow, error)
+	AddPullRequest(storyID string, pr *pullRequestDetail) error
+	AddSourceCommit(commit *sourceCommitDetail) error
+	DeleteStory(storyID string) error
+	CreateTask(storyID string, task *storyTask) error
+	UpdateTask(storyID string, task *storyTask) error
+	DeleteTask(storyID string, task *storyTask) error
+	CreateBlocker(storyID string, blocker *storyBlocker) error
+	UpdateBlocker(storyID string, blocker *storyBlocker) error
+	DeleteBlocker(storyID string, blocker *storyBlocker) error
+	GetEpic(epicID string) (*trackerEpic, error)
+	UpdateEpic(epicID string, epic *epicDetail) error
+	AddLabel(storyID string, label trackerLabel) error
+	RemoveLabel(storyID string, label trackerLabel) error
+	ListStories(offset int) ([]trackerSearchResultRow, error)
 	RequiresChoreEstimate() bool
 }
 
@@ -69,12 +90,34 @@ type trackerSearchResultRow struct {
 	Description  string
 	Estimate     int
 	Kind         string
-	StoryType    string `json:"story_type"`
-	CurrentState string `json:"current_state"`
+	StoryType    string         `json:"story_type"`
+	CurrentState string         `json:"current_state"`
+	ProjectID    int64          `json:"project_id,omitempty"`
+	Labels       []trackerLabel `json:"labels,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
 }
 
 var titleInSearch = regexp.MustCompile(`^name:"(.+)"$`)
 
+var idInSearch = regexp.MustCompile(`^id:"(\d+)"$`)
+
+// accountURL is the api url outside of the project, e.g. https://www.pivotaltracker.com/services/v5
+func (t trackerAPI) accountURL() string {
+	if i := strings.Index(t.URL, "/projects/"); i > 0 {
+		return t.URL[:i]
+	}
+	return t.URL
+}
+
+// storyURL follows stories that were moved into another project
+func (t trackerAPI) storyURL(rs *trackerSearchResultRow) string {
+	if rs.ProjectID != 0 {
+		return fmt.Sprintf("%s/projects/%d/stories/%s", t.accountURL(), rs.ProjectID, rs.ID.String())
+	}
+	return t.URL + "/stories/" + rs.ID.String()
+}
+
 func (t trackerAPI) FindStory(story *storyDetail) (*trackerSearchResultRow, error) {
 	for _, filter := range story.SearchFilters {
 		expectedTitle := story.Title
@@ -94,23 +137,44 @@ func (t trackerAPI) FindStory(story *storyDetail) (*trackerSearchResultRow, erro
 			return nil, errors.Wrapf(err, "json unmarshal")
 		}
 
-		// if too many matches, abort?; potential infinite loop
 		expectedTitle = strings.TrimSpace(expectedTitle)
-		var found *trackerSearchResultRow
+		found := []trackerSearchResultRow{}
 		for _, item := range result.Stories.Stories {
-			item := item
 			if expectedTitle == strings.TrimSpace(item.Name) {
 				fmt.Printf("found expect=%#v vs found=%#v\n", expectedTitle, item.Name)
-				if found != nil {
-					return nil, multipleMatchesError
-				}
-				found = &item
+				found = append(found, item)
 			} else {
 				fmt.Printf("no match expect=%#v vs found=%#v\n", expectedTitle, item.Name)
 			}
 		}
-		if found != nil {
-			return found, nil
+		switch {
+		case len(found) == 1:
+			return &found[0], nil
+		case len(found) > 1:
+			if picked := pickStory(story, found); picked != nil {
+				return picked, nil
+			}
+			return nil, &ambiguousError{Stories: found}
+		}
+	}
+
+	// the linked story may have been moved out of this project
+	for _, filter := range story.SearchFilters {
+		res := idInSearch.FindStringSubmatch(filter)
+		if res == nil {
+			continue
+		}
+		targetURL := t.accountURL() + "/stories/" + res[1]
+		data, err := t.perform("GET", targetURL, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GET %s", targetURL)
+		}
+		found := trackerSearchResultRow{}
+		if err = json.Unmarshal(data, &found); err != nil {
+			return nil, errors.Wrapf(err, "json unmarshal")
+		}
+		if found.ID.String() == res[1] && found.Kind == "story" {
+			return &found, nil
 		}
 	}
 	return nil, nil
@@ -139,6 +203,9 @@ func (t trackerAPI) perform(method, url string, body []byte) ([]byte, error) {
 	}
 	// end debug
 
+	if err = rateLimitFrom(resp); err != nil {
+		return nil, err
+	}
 	return data, nil
 }
 
@@ -166,7 +233,7 @@ func (t trackerAPI) GetStory(storyID string) (*trackerSearchResultRow, error) {
 }
 
 func (t trackerAPI) UpdateStory(story *storyDetail, rs *trackerSearchResultRow) error {
-	targetURL := t.URL + "/stories/" + rs.ID.String()
+	targetURL := t.storyURL(rs)
 	targetJSON, err := json.Marshal(story)
 	if err != nil {
 		return errors.Wrapf(err, "json marshal")
@@ -176,6 +243,167 @@ func (t trackerAPI) UpdateStory(story *storyDetail, rs *trackerSearchResultRow)
 	return err
 }
 
+// FindStoryByIssueURL returns the story whose description is prefixed by `issueURL`
+func (t trackerAPI) FindStoryByIssueURL(issueURL string) (*trackerSearchResultRow, error) {
+	filter := `description:"` + issueURL + `"`
+	targetURL := t.URL + "/search?query=" + url.QueryEscape(filter)
+	data, err := t.perform("GET", targetURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET %s", targetURL)
+	}
+
+	result := trackerSearchResult{}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal")
+	}
+
+	var found *trackerSearchResultRow
+	for _, item := range result.Stories.Stories {
+		item := item
+		if !hasLinkPrefix(item.Description, issueURL) {
+			continue
+		}
+		if found != nil {
+			return nil, multipleMatchesError
+		}
+		found = &item
+	}
+	return found, nil
+}
+
+func (t trackerAPI) DeleteStory(storyID string) error {
+	targetURL := t.URL + "/stories/" + storyID
+	_, err := t.perform("DELETE", targetURL, nil)
+	return err
+}
+
+func (t trackerAPI) AddPullRequest(storyID string, pr *pullRequestDetail) error {
+	targetURL := t.URL + "/stories/" + storyID + "/pull_requests"
+	targetJSON, err := json.Marshal(pr)
+	if err != nil {
+		return errors.Wrapf(err, "json marshal")
+	}
+	_, err = t.perform("POST", targetURL, targetJSON)
+	return err
+}
+
+// AddSourceCommit posts to /source_commits, which lives outside of the project url
+func (t trackerAPI) AddSourceCommit(commit *sourceCommitDetail) error {
+	targetURL := t.accountURL() + "/source_commits"
+	targetJSON, err := json.Marshal(map[string]*sourceCommitDetail{"source_commit": commit})
+	if err != nil {
+		return errors.Wrapf(err, "json marshal")
+	}
+	_, err = t.perform("POST", targetURL, targetJSON)
+	return err
+}
+
+func (t trackerAPI) CreateTask(storyID string, task *storyTask) error {
+	targetURL := t.URL + "/stories/" + storyID + "/tasks"
+	targetJSON, err := json.Marshal(task)
+	if err != nil {
+		return errors.Wrapf(err, "json marshal")
+	}
+	_, err = t.perform("POST", targetURL, targetJSON)
+	return err
+}
+
+func (t trackerAPI) UpdateTask(storyID string, task *storyTask) error {
+	targetURL := t.URL + "/stories/" + storyID + "/tasks/" + task.ID
+	targetJSON, err := json.Marshal(task)
+	if err != nil {
+		return errors.Wrapf(err, "json marshal")
+	}
+	_, err = t.perform("PUT", targetURL, targetJSON)
+	return err
+}
+
+func (t trackerAPI) DeleteTask(storyID string, task *storyTask) error {
+	targetURL := t.URL + "/stories/" + storyID + "/tasks/" + task.ID
+	_, err := t.perform("DELETE", targetURL, nil)
+	return err
+}
+
+func (t trackerAPI) CreateBlocker(storyID string, blocker *storyBlocker) error {
+	targetURL := t.URL + "/stories/" + storyID + "/blockers"
+	targetJSON, err := json.Marshal(blocker)
+	if err != nil {
+		return errors.Wrapf(err, "json marshal")
+	}
+	_, err = t.perform("POST", targetURL, targetJSON)
+	return err
+}
+
+func (t trackerAPI) UpdateBlocker(storyID string, blocker *storyBlocker) error {
+	targetURL := t.URL + "/stories/" + storyID + "/blockers/" + blocker.ID
+	targetJSON, err := json.Marshal(blocker)
+	if err != nil {
+		return errors.Wrapf(err, "json marshal")
+	}
+	_, err = t.perform("PUT", targetURL, targetJSON)
+	return err
+}
+
+func (t trackerAPI) DeleteBlocker(storyID string, blocker *storyBlocker) error {
+	targetURL := t.URL + "/stories/" + storyID + "/blockers/" + blocker.ID
+	_, err := t.perform("DELETE", targetURL, nil)
+	return err
+}
+
+func (t trackerAPI) GetEpic(epicID string) (*trackerEpic, error) {
+	targetURL := t.URL + "/epics/" + epicID
+	data, err := t.perform("GET", targetURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET %s", targetURL)
+	}
+	epic := trackerEpic{}
+	if err = json.Unmarshal(data, &epic); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal")
+	}
+	return &epic, nil
+}
+
+func (t trackerAPI) UpdateEpic(epicID string, epic *epicDetail) error {
+	targetURL := t.URL + "/epics/" + epicID
+	targetJSON, err := json.Marshal(epic)
+	if err != nil {
+		return errors.Wrapf(err, "json marshal")
+	}
+	_, err = t.perform("PUT", targetURL, targetJSON)
+	return err
+}
+
+func (t trackerAPI) AddLabel(storyID string, label trackerLabel) error {
+	targetURL := t.URL + "/stories/" + storyID + "/labels"
+	targetJSON, err := json.Marshal(map[string]string{"name": label.Name})
+	if err != nil {
+		return errors.Wrapf(err, "json marshal")
+	}
+	_, err = t.perform("POST", targetURL, targetJSON)
+	return err
+}
+
+func (t trackerAPI) RemoveLabel(storyID string, label trackerLabel) error {
+	targetURL := t.URL + "/stories/" + storyID + "/labels/" + label.ID.String()
+	_, err := t.perform("DELETE", targetURL, nil)
+	return err
+}
+
+// ListStories returns a page of stories in the project, oldest first
+func (t trackerAPI) ListStories(offset int) ([]trackerSearchResultRow, error) {
+	targetURL := fmt.Sprintf("%s/stories?limit=100&offset=%d", t.URL, offset)
+	data, err := t.perform("GET", targetURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET %s", targetURL)
+	}
+
+	var rows []trackerSearchResultRow
+	if err = json.Unmarshal(data, &rows); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal")
+	}
+	return rows, nil
+}
+
 func (t trackerAPI) RequiresChoreEstimate() bool {
 	return t.EstimateChores
 }
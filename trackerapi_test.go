@@ -39,3 +39,12 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestStoryURL(t *testing.T) {
+	client := trackerAPI{URL: "https://www.pivotaltracker.com/services/v5/projects/1234567"}
+	assert.Equal(t, "https://www.pivotaltracker.com/services/v5", client.accountURL())
+	assert.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/1234567/stories/153926473",
+		client.storyURL(&trackerSearchResultRow{ID: alwaysString{Value: "153926473"}}))
+	assert.Equal(t, "https://www.pivotaltracker.com/services/v5/projects/2345678/stories/153926473",
+		client.storyURL(&trackerSearchResultRow{ID: alwaysString{Value: "153926473"}, ProjectID: 2345678}))
+}
@@ -0,0 +1,179 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// walker goes through every issue of a repo and story of a project, for the commands
+// that sync outside of webhooks. routes are not followed; only the default repo and
+// project of the webhook urls are walked
+type walker struct {
+	Out io.Writer
+
+	github         githubAPIClient
+	tracker        trackerAPIClient
+	repo           string
+	githubHTMLURL  string
+	trackerHTMLURL string
+	issueOpts      syncOptions
+	storyOpts      syncOptions
+	sleep          func(time.Duration)
+}
+
+// newWalker reads credentials and options from both webhook urls, i.e. `issueValues`
+// of the url added to the GH repo, and `storyValues` of the url added to the PT project
+func newWalker(issueValues, storyValues url.Values) (walker, error) {
+	issueOpts, err := syncOptionsFromValues(issueValues)
+	if err != nil {
+		return walker{}, errors.Wrapf(err, "github webhook url")
+	}
+	storyOpts, err := syncOptionsFromValues(storyValues)
+	if err != nil {
+		return walker{}, errors.Wrapf(err, "pivotaltracker webhook url")
+	}
+	var github githubAPIClient = githubAPI{
+		Client:   http.DefaultClient,
+		Token:    storyValues.Get("token"),
+		Username: storyValues.Get("username"),
+		URL:      storyValues.Get("api_url"),
+		Repo:     storyValues.Get("repo"),
+	}
+	if storyOpts.DryRun {
+		storyOpts.dryRun = &dryRunLog{}
+		github = dryRunGithub{github, storyOpts.dryRun}
+	}
+	var tracker trackerAPIClient = trackerAPI{
+		Client:         http.DefaultClient,
+		Token:          issueValues.Get("token"),
+		URL:            issueValues.Get("api_url"),
+		EstimateChores: (issueValues.Get("estimate_chores") == "1"),
+	}
+	if issueOpts.DryRun {
+		issueOpts.dryRun = &dryRunLog{}
+		tracker = dryRunTracker{tracker, issueOpts.dryRun}
+	}
+	return walker{
+		Out:            os.Stdout,
+		github:         github,
+		tracker:        tracker,
+		repo:           storyValues.Get("repo"),
+		githubHTMLURL:  storyValues.Get("github_html_url"),
+		trackerHTMLURL: storyValues.Get("tracker_html_url"),
+		issueOpts:      issueOpts,
+		storyOpts:      storyOpts,
+		sleep:          time.Sleep,
+	}, nil
+}
+
+// retry waits out rate limits, for as long as the api tells us to
+func (w walker) retry(fn func() error) error {
+	for {
+		err := fn()
+		limit, ok := errors.Cause(err).(*rateLimitError)
+		if !ok {
+			return err
+		}
+		wait := time.Until(limit.Reset) + time.Second
+		fmt.Fprintf(w.Out, "wait  %s (%s)\n", wait, limit.Error())
+		w.sleep(wait)
+	}
+}
+
+// listIssues returns issues that are `state`, i.e. open, closed or all; pull requests excluded
+func (w walker) listIssues(state string) ([]githubSearchResultRow, error) {
+	result := []githubSearchResultRow{}
+	for page := 1; ; page++ {
+		var items []githubSearchResultRow
+		err := w.retry(func() (err error) {
+			items, err = w.github.ListIssues(w.repo, state, page)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "ListIssues %s page %d", w.repo, page)
+		}
+		if len(items) == 0 {
+			return result, nil
+		}
+		for _, item := range items {
+			if item.PullRequest != nil || strings.HasSuffix(strings.TrimSpace(item.Title), noStorySuffix) {
+				continue
+			}
+			result = append(result, item)
+		}
+	}
+}
+
+// listStories returns stories of the project, releases excluded
+func (w walker) listStories(includeAccepted bool) ([]trackerSearchResultRow, error) {
+	result := []trackerSearchResultRow{}
+	for offset := 0; ; {
+		var rows []trackerSearchResultRow
+		err := w.retry(func() (err error) {
+			rows, err = w.tracker.ListStories(offset)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "ListStories offset %d", offset)
+		}
+		if len(rows) == 0 {
+			return result, nil
+		}
+		offset += len(rows)
+		for _, row := range rows {
+			if row.StoryType == storyTypeRelease || (row.CurrentState == storyStateAccepted && !includeAccepted) {
+				continue
+			}
+			result = append(result, row)
+		}
+	}
+}
+
+// issueInScope applies the sync filters of the github webhook url, see `syncFilters`
+func (w walker) issueInScope(issue githubSearchResultRow) bool {
+	return w.issueOpts.Filters.issueOutOfScope(githubKindIssue, issue.User.login(), issue.Title, issue.Labels) == ""
+}
+
+// storyInScope applies the sync filters of the tracker webhook url
+func (w walker) storyInScope(story trackerSearchResultRow) bool {
+	return w.storyOpts.Filters.storyOutOfScope(story.StoryType, story.CurrentState, trackerLabelNames(story.Labels)) == ""
+}
+
+func (w walker) storyURL(story trackerSearchResultRow) string {
+	return fmt.Sprintf("%s/story/show/%s", strings.TrimRight(w.trackerHTMLURL, "/"), story.ID.String())
+}
+
+// loadStateFile reads json `filename` into `v`; a missing file leaves `v` untouched
+func loadStateFile(filename string, v interface{}) error {
+	if filename == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func saveStateFile(filename string, v interface{}) error {
+	if filename == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
@@ -0,0 +1,227 @@
+package githubtracker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func (s WebhookStoryHandler) handleEpic(epic webhookEpic, client githubAPIClient, repo string) error {
+	issue := ghIssueFromWebhookEpic(epic, repo)
+	found, err := client.FindIssueByTrackerURL(repo, epic.URL)
+	if isMultipleMatches(err) {
+		log.Println(err.Error())
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "FindIssueByTrackerURL %s", epic.URL)
+	}
+
+	if found == nil {
+		if epic.isDeleted {
+			return nil // not found? don't create; we're deleting the epic...
+		}
+		err = client.CreateIssue(issue)
+		return errors.Wrapf(err, "CreateIssue %#v", issue)
+	}
+
+	issue.Labels = nil // github replaces all labels on update
+	if epic.isDeleted || issue.Body != "" {
+		// members section is only known to github; keep it when description changes
+		founddetail, err := client.GetIssue(issue, found)
+		if err != nil {
+			return errors.Wrapf(err, "GetIssue %#v", found)
+		}
+		if epic.isDeleted {
+			issue.Body = strings.TrimSpace(epicStripRegexpFor(strings.TrimSuffix(epic.URL, "/epic/show/"+epic.ID)).ReplaceAllString(founddetail.Body, ""))
+		} else {
+			issue.Body = epicMembersSection.merge(issue.Body, founddetail.Body, nil)
+		}
+	}
+	err = client.UpdateIssue(issue, found)
+	return errors.Wrapf(err, "UpdateIssue %#v", issue)
+}
+
+// findEpicIssue returns the github tracking issue of the epic named after `label`
+func findEpicIssue(client githubAPIClient, repo, label string) (*githubSearchResultRow, error) {
+	items, err := client.SearchIssues(fmt.Sprintf("%q in:title is:issue label:%s repo:%s", label, githubEpicLabel, repo))
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		item := item
+		if strings.EqualFold(strings.TrimSpace(item.Title), strings.TrimSpace(label)) {
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+// syncEpicMembers updates the members section of epic issues listing the story issue `found`
+func (s WebhookStoryHandler) syncEpicMembers(story webhookStory, found *githubSearchResultRow, client githubAPIClient, repo string) error {
+	state := story.CurrentState
+	if state == changeTypeDelete {
+		state = ""
+	}
+	member := epicMemberChange(story.StoryID, found.Number, state)
+
+	epics := map[int64]checklistChange{}
+	for _, label := range story.labelsAdded {
+		epic, err := findEpicIssue(client, repo, label)
+		if err != nil {
+			return errors.Wrapf(err, "findEpicIssue %s", label)
+		}
+		if epic != nil {
+			c := member
+			c.Action = checklistCreate
+			epics[epic.Number] = c
+		}
+	}
+	for _, label := range story.labelsRemoved {
+		epic, err := findEpicIssue(client, repo, label)
+		if err != nil {
+			return errors.Wrapf(err, "findEpicIssue %s", label)
+		}
+		if epic != nil {
+			c := member
+			c.Action = checklistDelete
+			epics[epic.Number] = c
+		}
+	}
+	if story.CurrentState != "" {
+		// epics that already list this story
+		items, err := client.SearchIssues(fmt.Sprintf("%s in:body is:issue label:%s repo:%s", story.StoryID, githubEpicLabel, repo))
+		if err != nil {
+			return errors.Wrapf(err, "SearchIssues %s", story.StoryID)
+		}
+		for _, item := range items {
+			if _, ok := epics[item.Number]; ok {
+				continue
+			}
+			c := member
+			if story.CurrentState == changeTypeDelete {
+				c.Action = checklistDelete
+			}
+			epics[item.Number] = c
+		}
+	}
+
+	for number, c := range epics {
+		epic := &githubSearchResultRow{Number: number}
+		target := &issueDetail{repo: repo}
+		founddetail, err := client.GetIssue(target, epic)
+		if err != nil {
+			return errors.Wrapf(err, "GetIssue %d", number)
+		}
+		items := epicMembersSection.parse(founddetail.Body)
+		if items == nil {
+			items = []checklistItem{}
+		}
+		for i, item := range items {
+			if item.ID == "" && epicMemberNumber(item.Text) == fmt.Sprintf("%d", found.Number) {
+				items[i].ID = story.StoryID // added from github
+			}
+		}
+		items = applyChecklistChange(items, c)
+		if c.Action == checklistCreate {
+			items = applyChecklistChange(items, member)
+		}
+		target.Body = epicMembersSection.replace(founddetail.Body, items)
+		if target.Body == founddetail.Body {
+			continue
+		}
+		if err = client.UpdateIssue(target, epic); err != nil {
+			return errors.Wrapf(err, "UpdateIssue %#v", target)
+		}
+	}
+	return nil
+}
+
+// handleTrackingIssue syncs a github tracking issue back to its pivotal tracker epic
+func (s WebhookIssueHandler) handleTrackingIssue(issue *webhookIssue, epicID string, client trackerAPIClient) error {
+	if issue.isChanged() {
+		epic := &epicDetail{
+			Name:        strings.TrimSpace(issue.Title),
+			Description: epicDescriptionFromBody(issue.Body, issue.trackerHTMLURL),
+		}
+		if err := client.UpdateEpic(epicID, epic); err != nil {
+			return errors.Wrapf(err, "UpdateEpic %#v", epic)
+		}
+	}
+
+	changes := []checklistChange{}
+	for _, c := range issue.memberChanges() {
+		// updates are only ever made by us, from tracker
+		if c.Action == checklistCreate || c.Action == checklistDelete {
+			changes = append(changes, c)
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	epic, err := client.GetEpic(epicID)
+	if err != nil {
+		return errors.Wrapf(err, "GetEpic %s", epicID)
+	}
+	for _, c := range changes {
+		if c.Action == checklistDelete {
+			if err = client.RemoveLabel(c.Item.ID, epic.Label); err != nil {
+				return errors.Wrapf(err, "RemoveLabel %#v", c.Item)
+			}
+			continue
+		}
+		issueURL := issueURLFor(issue.URL, epicMemberNumber(c.Item.Text))
+		if err = s.addEpicLabel(client, issueURL, epic.Label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleSubIssue labels the story of a sub issue with the epic of its parent tracking issue
+func (s WebhookIssueHandler) handleSubIssue(sub *webhookSubIssue, client trackerAPIClient, htmlURL string) error {
+	epicID := epicIDFromBody(sub.Parent.Body, htmlURL)
+	if epicID == "" {
+		log.Println("parent is not a tracking issue")
+		return nil
+	}
+	epic, err := client.GetEpic(epicID)
+	if err != nil {
+		return errors.Wrapf(err, "GetEpic %s", epicID)
+	}
+	if sub.isAdded {
+		return s.addEpicLabel(client, sub.Sub.URL, epic.Label)
+	}
+
+	rs, err := client.FindStoryByIssueURL(sub.Sub.URL)
+	if err != nil {
+		return errors.Wrapf(err, "FindStoryByIssueURL %s", sub.Sub.URL)
+	}
+	if rs == nil {
+		return nil
+	}
+	err = client.RemoveLabel(rs.ID.String(), epic.Label)
+	return errors.Wrapf(err, "RemoveLabel %s", rs.ID.String())
+}
+
+func (s WebhookIssueHandler) addEpicLabel(client trackerAPIClient, issueURL string, label trackerLabel) error {
+	if issueURL == "" {
+		return nil
+	}
+	rs, err := client.FindStoryByIssueURL(issueURL)
+	if isMultipleMatches(err) {
+		log.Println(err.Error())
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "FindStoryByIssueURL %s", issueURL)
+	}
+	if rs == nil {
+		return nil
+	}
+	err = client.AddLabel(rs.ID.String(), label)
+	return errors.Wrapf(err, "AddLabel %s", rs.ID.String())
+}
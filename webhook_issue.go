@@ -16,19 +16,60 @@ import (
 type webhookIssue struct {
 	isClosed       bool
 	isOpened       bool
-	Title          string    `json:"title"`
-	Body           string    `json:"body"`
-	State          string    `json:"state"`
-	URL            string    `json:"html_url"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	isCreated      bool
+	isDeleted      bool
+	Title          string         `json:"title"`
+	Body           string         `json:"body"`
+	State          string         `json:"state"`
+	URL            string         `json:"html_url"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Labels         []webhookLabel `json:"labels,omitempty"`
+	User           *webhookUser   `json:"user,omitempty"`
 	titleWas       *string
+	labelsWas      []webhookLabel // only when labeled or unlabeled
 	bodyWas        *string
 	trackerHTMLURL string
+	opts           syncOptions
+	isDrifted      bool // found by the reconciler, sync even though nothing changed
 }
 
 func (i *webhookIssue) StrippedBody() string {
-	return strings.TrimSpace(bodyStripRegexpFor(i.trackerHTMLURL).ReplaceAllString(i.Body, ""))
+	return strings.TrimSpace(stripStoryLink(stripChecklistSections(i.Body), i.trackerHTMLURL))
+}
+
+// taskChanges returns changes made to the task list section of issue body
+func (i *webhookIssue) taskChanges() []checklistChange {
+	if i == nil || i.bodyWas == nil {
+		return nil
+	}
+	return diffChecklist(tasksSection.parse(*i.bodyWas), tasksSection.parse(i.Body))
+}
+
+// blockerChanges returns changes made to the blockers section of issue body,
+// including new "blocked by" lines written anywhere else
+func (i *webhookIssue) blockerChanges() []checklistChange {
+	if i == nil || (i.bodyWas == nil && !i.isCreated) {
+		return nil
+	}
+	was := ""
+	if i.bodyWas != nil {
+		was = *i.bodyWas
+	}
+	changes := diffChecklist(blockersSection.parse(was), blockersSection.parse(i.Body))
+
+	existing := map[string]bool{}
+	for _, text := range blockedByLines(was) {
+		existing[strings.ToLower(text)] = true
+	}
+	for _, text := range blockedByLines(i.Body) {
+		if existing[strings.ToLower(text)] {
+			continue
+		}
+		existing[strings.ToLower(text)] = true
+		changes = append(changes, checklistChange{Action: checklistCreate, Item: checklistItem{Text: text}})
+	}
+	return changes
 }
 
 func (i *webhookIssue) isChanged() bool {
@@ -45,8 +86,7 @@ func (i *webhookIssue) isChanged() bool {
 	}
 
 	if i.bodyWas != nil {
-		bodyStrip := bodyStripRegexpFor(i.trackerHTMLURL)
-		if old, new := sanitizeString(bodyStrip, *i.bodyWas), sanitizeString(bodyStrip, i.Body); old != new {
+		if old, new := strings.TrimSpace(stripStoryLink(stripChecklistSections(*i.bodyWas), i.trackerHTMLURL)), strings.TrimSpace(stripStoryLink(stripChecklistSections(i.Body), i.trackerHTMLURL)); old != new {
 			log.Printf("body changed! %#v -> %#v", old, new)
 			return true
 		}
@@ -69,8 +109,18 @@ func parseWebhookIssue(data []byte, htmlURL string) (*webhookIssue, error) {
 
 	wh.WebhookIssue.isClosed = (wh.Action == "closed")
 	wh.WebhookIssue.isOpened = (wh.Action == "opened" || wh.Action == "reopened")
+	wh.WebhookIssue.isCreated = (wh.Action == "opened")
+	wh.WebhookIssue.isDeleted = (wh.Action == "deleted")
 	wh.WebhookIssue.titleWas = wh.Changes["title"].String()
 	wh.WebhookIssue.bodyWas = wh.Changes["body"].String()
+	if wh.Label != nil {
+		switch wh.Action {
+		case "labeled":
+			wh.WebhookIssue.labelsWas = withoutLabel(wh.WebhookIssue.Labels, wh.Label.Name)
+		case "unlabeled":
+			wh.WebhookIssue.labelsWas = append(withoutLabel(wh.WebhookIssue.Labels, wh.Label.Name), *wh.Label)
+		}
+	}
 	wh.WebhookIssue.trackerHTMLURL = htmlURL
 	return wh.WebhookIssue, nil
 }
@@ -81,36 +131,36 @@ func bodyStripRegexpFor(s string) *regexp.Regexp {
 
 // ptStoryFromWebhookIssue returns nil if storyDetail is not meant to be updated
 func ptStoryFromWebhookIssue(issue *webhookIssue) (*storyDetail, error) {
-	if !issue.isClosed && !issue.isOpened && !issue.isChanged() {
+	taskChanges := issue.taskChanges()
+	blockerChanges := issue.blockerChanges()
+	if !issue.isClosed && !issue.isOpened && !issue.isDrifted && !issue.isChanged() && len(taskChanges) == 0 && len(blockerChanges) == 0 {
 		return nil, nil
 	}
 
 	buf := bytes.Buffer{}
-	if err := bodyTemplate.Execute(&buf, issue); err != nil {
+	parts := bodyParts{Link: issue.URL, StrippedBody: markdownToTracker(issue.StrippedBody(), repoURLOf(issue.URL), issue.opts.People)}
+	if err := bodyTemplate.Execute(&buf, parts); err != nil {
 		return nil, errors.Wrapf(err, "template %#v", bodyTemplate)
 	}
 
 	strippedTitle := strings.TrimSpace(issue.Title)
 	filters := []string{}
 
-	bodyStrip := bodyStripRegexpFor(issue.trackerHTMLURL)
-	fmt.Printf("bodyStrip=%s\n", bodyStrip.String())
-
-	if res := bodyStrip.FindAllStringSubmatch(issue.Body, 1); res != nil {
-		fmt.Printf("res=%#v\n", res)
-		filters = append(filters, `id:"`+res[0][1]+`"`)
+	if link := parseStoryLink(issue.Body, issue.trackerHTMLURL); link != nil {
+		fmt.Printf("link=%#v\n", link)
+		filters = append(filters, `id:"`+link.StoryID+`"`)
 	}
 
 	if issue.bodyWas != nil {
-		if res := bodyStrip.FindAllStringSubmatch(*issue.bodyWas, 1); res != nil {
-			fmt.Printf("res=%#v\n", res)
-			filters = append(filters, `id:"`+res[0][1]+`"`)
+		if link := parseStoryLink(*issue.bodyWas, issue.trackerHTMLURL); link != nil {
+			fmt.Printf("link=%#v\n", link)
+			filters = append(filters, `id:"`+link.StoryID+`"`)
 		}
 	}
 
-	if res := bodyStrip.FindAllStringSubmatch(issue.Body, 1); res != nil {
-		fmt.Printf("res=%#v\n", res)
-		filters = append(filters, `id:"`+res[0][1]+`"`)
+	if link := parseStoryLink(issue.Body, issue.trackerHTMLURL); link != nil {
+		fmt.Printf("link=%#v\n", link)
+		filters = append(filters, `id:"`+link.StoryID+`"`)
 	}
 
 	if issue.titleWas != nil {
@@ -121,11 +171,28 @@ func ptStoryFromWebhookIssue(issue *webhookIssue) (*storyDetail, error) {
 	filters = append(filters, `name:"`+searchFriendly(strippedTitle)+`"`)
 
 	story := storyDetail{
-		Title:         strippedTitle,
-		Body:          buf.String(),
-		SearchFilters: filters,
-		IsClosed:      issue.isClosed,
-		IsOpened:      issue.isOpened,
+		Title:          strippedTitle,
+		Body:           buf.String(),
+		SearchFilters:  filters,
+		IsClosed:       issue.isClosed,
+		IsOpened:       issue.isOpened,
+		TaskChanges:    taskChanges,
+		BlockerChanges: blockerChanges,
+		issueURL:       issue.URL,
+		createdAt:      issue.CreatedAt,
+	}
+
+	// only fields owned by github sync, but a new issue gives its story every field
+	if fields := issue.opts.Fields; !issue.isCreated {
+		if !fromGithub(fields.Title) {
+			story.Title = ""
+		}
+		if !fromGithub(fields.Body) {
+			story.Body = ""
+		}
+		if !fromGithub(fields.State) {
+			story.IsClosed, story.IsOpened = false, false
+		}
 	}
 	return &story, nil
 }
@@ -134,14 +201,28 @@ func searchFriendly(s string) string {
 	return strings.Replace(s, "/", " ", -1)
 }
 
-func sanitizeString(re *regexp.Regexp, s string) string {
-	return strings.TrimSpace(re.ReplaceAllString(s, ""))
-}
-
 type githubWebhook struct {
 	Action       string                 `json:"action"`
 	WebhookIssue *webhookIssue          `json:"issue"`
+	PullRequest  *webhookPullRequest    `json:"pull_request,omitempty"`
+	Ref          string                 `json:"ref,omitempty"`
+	Deleted      bool                   `json:"deleted,omitempty"`
+	Commits      []webhookCommit        `json:"commits,omitempty"`
+	ParentIssue  *webhookIssue          `json:"parent_issue,omitempty"`
+	SubIssue     *webhookIssue          `json:"sub_issue,omitempty"`
 	Changes      map[string]*changeFrom `json:"changes,omitempty"`
+	Label        *webhookLabel          `json:"label,omitempty"` // added or removed
+}
+
+type webhookUser struct {
+	Login string `json:"login"`
+}
+
+func (u *webhookUser) login() string {
+	if u == nil {
+		return ""
+	}
+	return u.Login
 }
 
 type changeFrom struct {
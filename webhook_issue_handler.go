@@ -1,15 +1,16 @@
 package githubtracker
 
 import (
-	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/choonkeat/githubtracker/crypto"
 	"github.com/pkg/errors"
 )
 
 type WebhookIssueHandler struct {
+	Review *ReviewQueue // optional; stories of the same title wait here for an operator
 }
 
 func (s WebhookIssueHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -24,19 +25,72 @@ func (s WebhookIssueHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	values := crypto.ValuesFromContext(r.Context())
-	client := trackerAPI{
+	project, err := projectRoute(data, routesFromValues(values), values.Get("api_url"))
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	client := project.tracker(trackerAPI{
 		Client:         http.DefaultClient,
 		Token:          values.Get("token"),
-		URL:            values.Get("api_url"),
 		EstimateChores: (values.Get("estimate_chores") == "1"),
+	})
+	opts, err := syncOptionsFromValues(values)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if err = s.handle(data, client, values.Get("html_url")); err != nil {
+	var api trackerAPIClient = client
+	dryRun := &dryRunLog{}
+	if opts.DryRun {
+		api, opts.dryRun = dryRunTracker{client, dryRun}, dryRun
+	}
+	api = adminEventFromContext(r.Context()).tracker(api, opts.DryRun)
+	if err = s.handle(data, api, values.Get("html_url"), opts); err != nil {
 		log.Println(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if opts.DryRun {
+		dryRun.writeJSON(w)
 	}
 }
 
-func (s WebhookIssueHandler) handle(data []byte, client trackerAPIClient, htmlURL string) error {
+func (s WebhookIssueHandler) handle(data []byte, client trackerAPIClient, htmlURL string, opts syncOptions) error {
+	pr, err := parseWebhookPullRequest(data)
+	if err != nil {
+		return errors.Wrapf(err, "parse data")
+	}
+	if pr != nil {
+		return s.handlePullRequest(pr, client, htmlURL, opts)
+	}
+
+	push, err := parseWebhookPush(data)
+	if err != nil {
+		return errors.Wrapf(err, "parse data")
+	}
+	if push != nil {
+		return s.handlePush(push, client)
+	}
+
+	sub, err := parseWebhookSubIssue(data)
+	if err != nil {
+		return errors.Wrapf(err, "parse data")
+	}
+	if sub != nil {
+		return s.handleSubIssue(sub, client, htmlURL)
+	}
+
+	transfer, err := parseWebhookTransfer(data)
+	if err != nil {
+		return errors.Wrapf(err, "parse data")
+	}
+	if transfer != nil {
+		return s.handleTransfer(transfer, client)
+	}
+
 	issue, err := parseWebhookIssue(data, htmlURL)
 	if err != nil {
 		return errors.Wrapf(err, "parse data")
@@ -45,6 +99,29 @@ func (s WebhookIssueHandler) handle(data []byte, client trackerAPIClient, htmlUR
 		log.Println("no issue")
 		return nil
 	}
+	switch now, was := opts.Filters.issueScope(issue); {
+	case now != "" && was == "":
+		log.Printf("issue %s left the sync filters: %s", issue.URL, now)
+		return s.unlinkIssue(issue, client)
+	case now != "":
+		log.Printf("skip issue %s: %s", issue.URL, now)
+		return nil
+	case was != "":
+		log.Printf("issue %s came into the sync filters", issue.URL)
+		issue.isDrifted = true // sync even though nothing else changed
+	}
+	if issue.isDeleted {
+		return s.handleDeletedIssue(issue, client, opts)
+	}
+	issue.opts = opts
+	return s.handleIssue(issue, client, htmlURL, opts)
+}
+
+// handleIssue syncs an issue to its story; the reconciler calls this directly
+func (s WebhookIssueHandler) handleIssue(issue *webhookIssue, client trackerAPIClient, htmlURL string, opts syncOptions) error {
+	if epicID := epicIDFromBody(issue.Body, htmlURL); epicID != "" {
+		return s.handleTrackingIssue(issue, epicID, client)
+	}
 
 	story, err := ptStoryFromWebhookIssue(issue)
 	if err != nil {
@@ -57,7 +134,13 @@ func (s WebhookIssueHandler) handle(data []byte, client trackerAPIClient, htmlUR
 	log.Printf("story=%#v", story)
 
 	rs, err := client.FindStory(story)
-	if err == multipleMatchesError {
+	if ambiguous, ok := err.(*ambiguousError); ok {
+		if rs = s.chosenStory(issue.URL, htmlURL, ambiguous); rs == nil {
+			return s.Review.add(issue.URL, story.Title, ambiguous.storyURLs(htmlURL), opts.dryRun)
+		}
+		err = nil
+	}
+	if isMultipleMatches(err) {
 		log.Println(err.Error()) // logging here since we're returning nil
 		return nil
 	}
@@ -65,30 +148,51 @@ func (s WebhookIssueHandler) handle(data []byte, client trackerAPIClient, htmlUR
 		return errors.Wrapf(err, "FindStory %#v", story)
 	}
 	if rs == nil {
-		if story.IsClosed {
+		if issue.isClosed {
 			// finishing an issue that had no story?
 			// issue was created before github-pt sync
 			// don't do anything on pt, let the issue close
 			return nil
 		}
+		if !opts.Fields.createsStories() || story.Title == "" || story.Body == "" {
+			log.Println("no story to update, and title or description is not synced from github")
+			return nil
+		}
+		for _, c := range story.BlockerChanges {
+			blocker := storyBlockerFromChecklistItem(c.Item)
+			if blocker.Description, err = ptBlockerDescription(client, story.issueURL, blocker.Description); err != nil {
+				return errors.Wrapf(err, "ptBlockerDescription %#v", blocker)
+			}
+			story.Blockers = append(story.Blockers, *blocker)
+		}
 		if err = client.CreateStory(story); err != nil {
 			return errors.Wrapf(err, "CreateStory %#v", story)
 		}
 		return nil
 	}
 
+	if reason := opts.Filters.storyOutOfScope(rs.StoryType, rs.CurrentState, trackerLabelNames(rs.Labels)); reason != "" {
+		log.Printf("skip story %s: %s", rs.ID.String(), reason)
+		return nil
+	}
+
+	conflicts, err := resolveStoryConflicts(issue, story, rs)
+	if err != nil {
+		return errors.Wrapf(err, "resolveStoryConflicts")
+	}
+	if len(conflicts) > 0 {
+		log.Printf("%s of story %s changed on both sides since the last sync", strings.Join(conflicts, " and "), rs.ID.String())
+		if err = client.AddLabel(rs.ID.String(), trackerLabel{Name: syncConflictLabel}); err != nil {
+			return errors.Wrapf(err, "AddLabel %s", syncConflictLabel)
+		}
+	}
+
 	if story.IsClosed {
-		if found, err := client.GetStory(rs.ID.String()); err == nil {
-			fmt.Printf("found %#v\n", found)
-			switch cs := found.CurrentState; cs {
-			case storyStateStarted, storyStatePlanned, storyStateUnstarted, storyStateUnscheduled, storyStateRejected:
-				if found.StoryType == storyTypeFeature && found.Estimate == 0 {
-					story.CurrentState = storyStateAccepted
+		if found, err := client.GetStory(rs.ID.String()); err == nil && oneOf(found.CurrentState, closeFromStates...) {
+			if state := opts.Policy.closedStoryState(found.StoryType, found.Estimate != 0); state != policyKeep {
+				story.CurrentState = state
+				if found.StoryType == storyTypeFeature && found.Estimate == 0 && !opts.Policy.KeepUnestimatedFeatures {
 					story.StoryType = storyTypeChore
-				} else if found.StoryType == storyTypeFeature {
-					story.CurrentState = storyStateFinished
-				} else {
-					story.CurrentState = storyStateAccepted
 				}
 				if client.RequiresChoreEstimate() {
 					story.Estimate = &found.Estimate
@@ -97,20 +201,91 @@ func (s WebhookIssueHandler) handle(data []byte, client trackerAPIClient, htmlUR
 		}
 	} else if story.IsOpened {
 		if found, err := client.GetStory(rs.ID.String()); err == nil {
-			fmt.Printf("found %#v\n", found)
 			switch cs := found.CurrentState; cs {
 			case storyStateStarted, storyStatePlanned, storyStateUnstarted, storyStateUnscheduled, storyStateRejected:
 				// not touching CurrentState
 			default:
-				story.CurrentState = storyStateStarted
+				if state := opts.Policy.reopenedStoryState(found.StoryType, cs); state != policyKeep {
+					story.CurrentState = state
+				}
 			}
 		}
 	}
 
-	log.Printf("updating story=%#v with client.RequiresChoreEstimate=%#v", story, client.RequiresChoreEstimate())
-	if err = client.UpdateStory(story, rs); err != nil {
-		return errors.Wrapf(err, "UpdateStory %#v", story)
+	if story.Title != "" || story.Body != "" || story.CurrentState != "" || story.StoryType != "" {
+		log.Printf("updating story=%#v with client.RequiresChoreEstimate=%#v", story, client.RequiresChoreEstimate())
+		if err = client.UpdateStory(story, rs); err != nil {
+			return errors.Wrapf(err, "UpdateStory %#v", story)
+		}
+	}
+
+	for _, c := range story.TaskChanges {
+		task := storyTaskFromChecklistItem(c.Item)
+		switch c.Action {
+		case checklistCreate:
+			err = client.CreateTask(rs.ID.String(), task)
+		case checklistUpdate:
+			err = client.UpdateTask(rs.ID.String(), task)
+		case checklistDelete:
+			err = client.DeleteTask(rs.ID.String(), task)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s task %#v", c.Action, task)
+		}
 	}
 
+	for _, c := range story.BlockerChanges {
+		blocker := storyBlockerFromChecklistItem(c.Item)
+		switch c.Action {
+		case checklistCreate:
+			if blocker.Description, err = ptBlockerDescription(client, story.issueURL, blocker.Description); err != nil {
+				return errors.Wrapf(err, "ptBlockerDescription %#v", blocker)
+			}
+			err = client.CreateBlocker(rs.ID.String(), blocker)
+		case checklistUpdate:
+			blocker.Description = "" // keep tracker wording, only resolve or unresolve
+			err = client.UpdateBlocker(rs.ID.String(), blocker)
+		case checklistDelete:
+			err = client.DeleteBlocker(rs.ID.String(), blocker)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s blocker %#v", c.Action, blocker)
+		}
+	}
+
+	return nil
+}
+
+// unlinkIssue takes the issue link out of the story description, once the issue left the sync filters;
+// the story link stays in the issue, to link them again if the issue comes back
+func (s WebhookIssueHandler) unlinkIssue(issue *webhookIssue, client trackerAPIClient) error {
+	rs, err := client.FindStoryByIssueURL(issue.URL)
+	if isMultipleMatches(err) {
+		log.Println(err.Error())
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "FindStoryByIssueURL %s", issue.URL)
+	}
+	if rs == nil || !hasLinkPrefix(rs.Description, issue.URL) {
+		return nil
+	}
+	story := &storyDetail{Body: strings.TrimSpace(rs.Description[len(issue.URL):])}
+	if story.Body == "" {
+		log.Printf("story %s has nothing but the issue link; leaving it", rs.ID.String())
+		return nil
+	}
+	err = client.UpdateStory(story, rs)
+	return errors.Wrapf(err, "UpdateStory %#v", story)
+}
+
+// chosenStory returns the candidate an operator chose for `issueURL` in the review queue
+func (s WebhookIssueHandler) chosenStory(issueURL, htmlURL string, ambiguous *ambiguousError) *trackerSearchResultRow {
+	chosen := s.Review.chosen(issueURL)
+	for i, url := range ambiguous.storyURLs(htmlURL) {
+		if chosen != "" && url == chosen {
+			return &ambiguous.Stories[i]
+		}
+	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package githubtracker
 
 import (
+	"fmt"
 	"io/ioutil"
 	"testing"
 
@@ -11,6 +12,8 @@ type logTrackerClient struct {
 	History            []logTrackerAction
 	ExpectedFoundStory *trackerSearchResultRow
 	ExpectedError      error
+	ExpectedEpic       *trackerEpic
+	ExpectedStories    []trackerSearchResultRow
 	EstimateChores     bool
 }
 
@@ -24,6 +27,9 @@ type logTrackerAction struct {
 	GivenEstimate      *int
 	GivenCurrentState  string
 	GivenStoryType     string
+	GivenTask          *storyTask
+	GivenBlocker       *storyBlocker
+	GivenBlockers      []storyBlocker
 }
 
 func (l *logTrackerClient) GetStory(storyID string) (*trackerSearchResultRow, error) {
@@ -61,6 +67,7 @@ func (l *logTrackerClient) CreateStory(story *storyDetail) error {
 		GivenEstimate:      story.Estimate,
 		GivenCurrentState:  story.CurrentState,
 		GivenStoryType:     story.StoryType,
+		GivenBlockers:      story.Blockers,
 	})
 	return l.ExpectedError
 }
@@ -80,6 +87,145 @@ func (l *logTrackerClient) UpdateStory(story *storyDetail, rs *trackerSearchResu
 	return l.ExpectedError
 }
 
+func (l *logTrackerClient) FindStoryByIssueURL(issueURL string) (*trackerSearchResultRow, error) {
+	l.History = append(l.History, logTrackerAction{
+		Method:  "FindStoryByIssueURL",
+		GivenID: issueURL,
+	})
+	return l.ExpectedFoundStory, l.ExpectedError
+}
+
+func (l *logTrackerClient) AddPullRequest(storyID string, pr *pullRequestDetail) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:     "AddPullRequest",
+		GivenID:    storyID,
+		GivenTitle: fmt.Sprintf("%s%s/%s#%d", pr.HostURL, pr.Owner, pr.Repo, pr.Number),
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) AddSourceCommit(commit *sourceCommitDetail) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:     "AddSourceCommit",
+		GivenID:    commit.CommitID,
+		GivenTitle: commit.Author,
+		GivenBody:  commit.Message,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) DeleteStory(storyID string) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:  "DeleteStory",
+		GivenID: storyID,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) CreateTask(storyID string, task *storyTask) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:    "CreateTask",
+		GivenID:   storyID,
+		GivenTask: task,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) UpdateTask(storyID string, task *storyTask) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:    "UpdateTask",
+		GivenID:   storyID,
+		GivenTask: task,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) DeleteTask(storyID string, task *storyTask) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:    "DeleteTask",
+		GivenID:   storyID,
+		GivenTask: task,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) CreateBlocker(storyID string, blocker *storyBlocker) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:       "CreateBlocker",
+		GivenID:      storyID,
+		GivenBlocker: blocker,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) UpdateBlocker(storyID string, blocker *storyBlocker) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:       "UpdateBlocker",
+		GivenID:      storyID,
+		GivenBlocker: blocker,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) DeleteBlocker(storyID string, blocker *storyBlocker) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:       "DeleteBlocker",
+		GivenID:      storyID,
+		GivenBlocker: blocker,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) GetEpic(epicID string) (*trackerEpic, error) {
+	l.History = append(l.History, logTrackerAction{
+		Method:  "GetEpic",
+		GivenID: epicID,
+	})
+	if l.ExpectedEpic == nil {
+		return nil, l.ExpectedError
+	}
+	return l.ExpectedEpic, nil
+}
+
+func (l *logTrackerClient) UpdateEpic(epicID string, epic *epicDetail) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:     "UpdateEpic",
+		GivenID:    epicID,
+		GivenTitle: epic.Name,
+		GivenBody:  epic.Description,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) AddLabel(storyID string, label trackerLabel) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:     "AddLabel",
+		GivenID:    storyID,
+		GivenTitle: label.Name,
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) RemoveLabel(storyID string, label trackerLabel) error {
+	l.History = append(l.History, logTrackerAction{
+		Method:     "RemoveLabel",
+		GivenID:    storyID,
+		GivenTitle: label.ID.String(),
+	})
+	return l.ExpectedError
+}
+
+func (l *logTrackerClient) ListStories(offset int) ([]trackerSearchResultRow, error) {
+	l.History = append(l.History, logTrackerAction{
+		Method:  "ListStories",
+		GivenID: fmt.Sprintf("%d", offset),
+	})
+	if offset > 0 {
+		return nil, l.ExpectedError
+	}
+	return l.ExpectedStories, l.ExpectedError
+}
+
 func (l *logTrackerClient) RequiresChoreEstimate() bool {
 	return l.EstimateChores
 }
@@ -131,8 +277,8 @@ func TestTrackerAPIClient(t *testing.T) {
 				CurrentState: storyStateUnscheduled,
 			},
 			expectedHistory: []logTrackerAction{
-				logTrackerAction{Method: "FindStory", GivenID: "", GivenTitle: "should have unique index on users.email column[fixed #12345]", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\n- [ ] what else?", GivenIsClosed: false, GivenSearchFilters: []string{"name:\"should have unique index on users.email column[fixed #12345]\""}},
-				logTrackerAction{Method: "UpdateStory", GivenID: "42", GivenTitle: "should have unique index on users.email column[fixed #12345]", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\n- [ ] what else?", GivenIsClosed: false, GivenSearchFilters: []string{"name:\"should have unique index on users.email column[fixed #12345]\""}},
+				logTrackerAction{Method: "FindStory", GivenID: "", GivenTitle: "should have unique index on users.email column[fixed #12345]", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\n- ☐ what else?", GivenIsClosed: false, GivenSearchFilters: []string{"name:\"should have unique index on users.email column[fixed #12345]\""}},
+				logTrackerAction{Method: "UpdateStory", GivenID: "42", GivenTitle: "should have unique index on users.email column[fixed #12345]", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\n- ☐ what else?", GivenIsClosed: false, GivenSearchFilters: []string{"name:\"should have unique index on users.email column[fixed #12345]\""}},
 			},
 		},
 		{
@@ -246,6 +392,44 @@ func TestTrackerAPIClient(t *testing.T) {
 				logTrackerAction{Method: "FindStory", GivenID: "", GivenTitle: "some story from ghe", GivenBody: "https://github.com/user123/repo456/issues/8\r\n\r\n", GivenIsClosed: true, GivenSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "name:\"some story from ghe\""}},
 			},
 		},
+		{
+			givenFile: "testdata/github/issues.edited-blockers.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "153984041"},
+				StoryType:    "feature",
+				CurrentState: storyStateStarted,
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStory", GivenTitle: "should have unique index on users.email column[fixed #12345]", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\nblocked by [#3](https://github.com/user123/repo456/issues/3)", GivenSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "id:\"153984041\"", "name:\"should have unique index on users.email column[fixed #12345]\""}},
+				logTrackerAction{Method: "UpdateStory", GivenID: "153984041", GivenTitle: "should have unique index on users.email column[fixed #12345]", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\nblocked by [#3](https://github.com/user123/repo456/issues/3)", GivenSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "id:\"153984041\"", "name:\"should have unique index on users.email column[fixed #12345]\""}},
+				logTrackerAction{Method: "UpdateBlocker", GivenID: "153984041", GivenBlocker: &storyBlocker{ID: "7001", Resolved: true}},
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/3"},
+				logTrackerAction{Method: "CreateBlocker", GivenID: "153984041", GivenBlocker: &storyBlocker{Description: "#153984041"}},
+			},
+		},
+		{
+			givenFile: "testdata/github/issues.new-blocked.json",
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStory", GivenTitle: "users.email should have unique constraint", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\nblocked by [#3](https://github.com/user123/repo456/issues/3)", GivenSearchFilters: []string{"name:\"users.email should have unique constraint\""}},
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/3"},
+				logTrackerAction{Method: "CreateIssue", GivenTitle: "users.email should have unique constraint", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\nblocked by [#3](https://github.com/user123/repo456/issues/3)", GivenSearchFilters: []string{"name:\"users.email should have unique constraint\""}, GivenBlockers: []storyBlocker{{Description: "https://github.com/user123/repo456/issues/3"}}},
+			},
+		},
+		{
+			givenFile: "testdata/github/issues.edited-tasks.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "153984041"},
+				StoryType:    "feature",
+				CurrentState: storyStateStarted,
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStory", GivenTitle: "should have unique index on users.email column[fixed #12345]", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five", GivenSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "id:\"153984041\"", "name:\"should have unique index on users.email column[fixed #12345]\""}},
+				logTrackerAction{Method: "UpdateStory", GivenID: "153984041", GivenTitle: "should have unique index on users.email column[fixed #12345]", GivenBody: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five", GivenSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "id:\"153984041\"", "name:\"should have unique index on users.email column[fixed #12345]\""}},
+				logTrackerAction{Method: "UpdateTask", GivenID: "153984041", GivenTask: &storyTask{ID: "61345678", Description: "add migration", Complete: true, Position: 1}},
+				logTrackerAction{Method: "CreateTask", GivenID: "153984041", GivenTask: &storyTask{Description: "add validation", Position: 2}},
+				logTrackerAction{Method: "DeleteTask", GivenID: "153984041", GivenTask: &storyTask{ID: "61345679", Description: "remove old index", Position: 2}},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -261,7 +445,303 @@ func TestTrackerAPIClient(t *testing.T) {
 				EstimateChores:     tc.givenChoresCanBeEstimated,
 			}
 			s := WebhookIssueHandler{}
-			err = s.handle(data, &logclient, "https://www.pivotaltracker.com")
+			err = s.handle(data, &logclient, "https://www.pivotaltracker.com", syncOptions{})
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedHistory, logclient.History)
+		})
+	}
+}
+
+func TestTrackerAPIClientPullRequest(t *testing.T) {
+	testCases := []struct {
+		givenFile       string
+		givenFoundStory *trackerSearchResultRow
+		givenOptions    syncOptions
+		expectedHistory []logTrackerAction
+	}{
+		{
+			givenFile: "testdata/github/pull_request.opened.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "153984041"},
+				StoryType:    storyTypeFeature,
+				Estimate:     1,
+				CurrentState: storyStateUnstarted,
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				logTrackerAction{Method: "GetStory", GivenID: "153984041"},
+				logTrackerAction{Method: "AddPullRequest", GivenID: "153984041", GivenTitle: "https://github.com/user123/repo456#9"},
+				logTrackerAction{Method: "UpdateStory", GivenID: "153984041", GivenCurrentState: storyStateStarted},
+			},
+		},
+		{
+			givenFile: "testdata/github/pull_request.opened.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "153984041"},
+				StoryType:    storyTypeFeature,
+				Estimate:     1,
+				CurrentState: storyStateDelivered,
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				logTrackerAction{Method: "GetStory", GivenID: "153984041"},
+				logTrackerAction{Method: "AddPullRequest", GivenID: "153984041", GivenTitle: "https://github.com/user123/repo456#9"},
+			},
+		},
+		{
+			givenFile: "testdata/github/pull_request.draft.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "153984041"},
+				StoryType:    storyTypeFeature,
+				Estimate:     1,
+				CurrentState: storyStateUnstarted,
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "GetStory", GivenID: "153984041"},
+				logTrackerAction{Method: "AddPullRequest", GivenID: "153984041", GivenTitle: "https://github.com/user123/repo456#10"},
+				logTrackerAction{Method: "UpdateStory", GivenID: "153984041", GivenCurrentState: storyStateStarted},
+			},
+		},
+		{
+			givenFile: "testdata/github/pull_request.draft.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "153984041"},
+				StoryType:    storyTypeFeature,
+				Estimate:     1,
+				CurrentState: storyStateUnstarted,
+			},
+			givenOptions: syncOptions{IgnoreDraftPullRequests: true},
+		},
+		{
+			givenFile: "testdata/github/pull_request.merged.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "42"},
+				StoryType:    storyTypeFeature,
+				Estimate:     1,
+				CurrentState: storyStateStarted,
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				logTrackerAction{Method: "UpdateStory", GivenID: "42", GivenCurrentState: storyStateFinished},
+			},
+		},
+		{
+			givenFile: "testdata/github/pull_request.opened.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "153984041"},
+				StoryType:    storyTypeFeature,
+				CurrentState: storyStateUnstarted,
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				logTrackerAction{Method: "GetStory", GivenID: "153984041"},
+				logTrackerAction{Method: "AddPullRequest", GivenID: "153984041", GivenTitle: "https://github.com/user123/repo456#9"},
+			},
+		},
+		{
+			givenFile: "testdata/github/pull_request.merged.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "42"},
+				StoryType:    storyTypeChore,
+				CurrentState: storyStateStarted,
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				logTrackerAction{Method: "UpdateStory", GivenID: "42", GivenCurrentState: storyStateAccepted},
+			},
+		},
+		{
+			givenFile: "testdata/github/pull_request.merged.json",
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+			},
+		},
+		{
+			givenFile: "testdata/github/pull_request.closed.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID:           alwaysString{Value: "42"},
+				StoryType:    storyTypeFeature,
+				Estimate:     1,
+				CurrentState: storyStateStarted,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.givenFile, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.givenFile)
+			if err != nil {
+				t.Fatalf("readfile: %s", err.Error())
+			}
+
+			logclient := logTrackerClient{
+				ExpectedFoundStory: tc.givenFoundStory,
+			}
+			s := WebhookIssueHandler{}
+			err = s.handle(data, &logclient, "https://www.pivotaltracker.com", tc.givenOptions)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedHistory, logclient.History)
+		})
+	}
+}
+
+func TestTrackerAPIClientPush(t *testing.T) {
+	testCases := []struct {
+		givenFile       string
+		givenFoundStory *trackerSearchResultRow
+		expectedHistory []logTrackerAction
+	}{
+		{
+			givenFile: "testdata/github/push.json",
+		},
+		{
+			givenFile: "testdata/github/push.commits.json",
+			givenFoundStory: &trackerSearchResultRow{
+				ID: alwaysString{Value: "42"},
+			},
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "AddSourceCommit", GivenID: "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c", GivenTitle: "user123", GivenBody: "add unique index on users.email [Finishes #153984041]"},
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				logTrackerAction{Method: "AddSourceCommit", GivenID: "4f3c8a1d1e9cfd1c6f0d8a3ffb0ab7e5c7b8f4a2", GivenTitle: "user123", GivenBody: "validate email format\n\nfixes #1\n\n[Fixes #42]"},
+			},
+		},
+		{
+			givenFile: "testdata/github/push.commits.json",
+			expectedHistory: []logTrackerAction{
+				logTrackerAction{Method: "AddSourceCommit", GivenID: "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c", GivenTitle: "user123", GivenBody: "add unique index on users.email [Finishes #153984041]"},
+				logTrackerAction{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d %s", i, tc.givenFile), func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.givenFile)
+			if err != nil {
+				t.Fatalf("readfile: %s", err.Error())
+			}
+
+			logclient := logTrackerClient{
+				ExpectedFoundStory: tc.givenFoundStory,
+			}
+			s := WebhookIssueHandler{}
+			err = s.handle(data, &logclient, "https://www.pivotaltracker.com", syncOptions{})
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedHistory, logclient.History)
+		})
+	}
+}
+
+func TestTrackerAPIClientEpic(t *testing.T) {
+	epic := &trackerEpic{
+		ID:    alwaysString{Value: "4012345"},
+		Name:  "Checkout flow",
+		Label: trackerLabel{ID: alwaysString{Value: "201"}, Name: "checkout flow"},
+	}
+	testCases := []struct {
+		givenFile       string
+		givenFoundStory *trackerSearchResultRow
+		expectedHistory []logTrackerAction
+	}{
+		{
+			givenFile:       "testdata/github/issues.edited-epic.json",
+			givenFoundStory: &trackerSearchResultRow{ID: alwaysString{Value: "153984043"}},
+			expectedHistory: []logTrackerAction{
+				{Method: "UpdateEpic", GivenID: "4012345", GivenTitle: "Checkout flow", GivenBody: "Everything needed to pay, fast"},
+				{Method: "GetEpic", GivenID: "4012345"},
+				{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/14"},
+				{Method: "AddLabel", GivenID: "153984043", GivenTitle: "checkout flow"},
+				{Method: "RemoveLabel", GivenID: "153984042", GivenTitle: "201"},
+			},
+		},
+		{
+			givenFile:       "testdata/github/sub_issues.added.json",
+			givenFoundStory: &trackerSearchResultRow{ID: alwaysString{Value: "153984041"}},
+			expectedHistory: []logTrackerAction{
+				{Method: "GetEpic", GivenID: "4012345"},
+				{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/12"},
+				{Method: "AddLabel", GivenID: "153984041", GivenTitle: "checkout flow"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.givenFile, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.givenFile)
+			if err != nil {
+				t.Fatalf("readfile: %s", err.Error())
+			}
+
+			logclient := logTrackerClient{
+				ExpectedFoundStory: tc.givenFoundStory,
+				ExpectedEpic:       epic,
+			}
+			s := WebhookIssueHandler{}
+			err = s.handle(data, &logclient, "https://www.pivotaltracker.com", syncOptions{})
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expectedHistory, logclient.History)
+		})
+	}
+}
+
+func TestTrackerAPIClientTransferDelete(t *testing.T) {
+	foundStory := &trackerSearchResultRow{
+		ID:          alwaysString{Value: "153984041"},
+		Description: "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five",
+		Estimate:    2,
+	}
+	testCases := []struct {
+		givenFile                 string
+		givenOptions              syncOptions
+		givenChoresCanBeEstimated bool
+		expectedHistory           []logTrackerAction
+	}{
+		{
+			givenFile: "testdata/github/issues.transferred.json",
+			expectedHistory: []logTrackerAction{
+				{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				{Method: "UpdateStory", GivenID: "153984041", GivenBody: "https://github.com/user123/api/issues/7\r\n\r\notherwise one two three four five"},
+			},
+		},
+		{
+			givenFile: "testdata/github/issues.deleted.json",
+			expectedHistory: []logTrackerAction{
+				{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				{Method: "AddLabel", GivenID: "153984041", GivenTitle: githubDeletedLabel},
+			},
+		},
+		{
+			givenFile:    "testdata/github/issues.deleted.json",
+			givenOptions: syncOptions{OnIssueDeleted: issueDeletedDelete},
+			expectedHistory: []logTrackerAction{
+				{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				{Method: "DeleteStory", GivenID: "153984041"},
+			},
+		},
+		{
+			givenFile:                 "testdata/github/issues.deleted.json",
+			givenOptions:              syncOptions{OnIssueDeleted: issueDeletedChore},
+			givenChoresCanBeEstimated: true,
+			expectedHistory: []logTrackerAction{
+				{Method: "FindStoryByIssueURL", GivenID: "https://github.com/user123/repo456/issues/1"},
+				{Method: "UpdateStory", GivenID: "153984041", GivenEstimate: intptr(2), GivenCurrentState: storyStateAccepted, GivenStoryType: storyTypeChore},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d %s", i, tc.givenFile), func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.givenFile)
+			if err != nil {
+				t.Fatalf("readfile: %s", err.Error())
+			}
+
+			logclient := logTrackerClient{
+				ExpectedFoundStory: foundStory,
+				EstimateChores:     tc.givenChoresCanBeEstimated,
+			}
+			s := WebhookIssueHandler{}
+			err = s.handle(data, &logclient, "https://www.pivotaltracker.com", tc.givenOptions)
 			assert.Nil(t, err)
 			assert.Equal(t, tc.expectedHistory, logclient.History)
 		})
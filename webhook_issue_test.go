@@ -35,7 +35,7 @@ func TestPtStoryFromWebhookIssue(t *testing.T) {
 		{
 			givenFile:             "testdata/github/issues.edited-body.json",
 			expectedTitle:         "should have unique index on users.email column[fixed #12345]",
-			expectedBody:          "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\n- [ ] what else?",
+			expectedBody:          "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\n- ☐ what else?",
 			expectedSearchFilters: []string{"name:\"should have unique index on users.email column[fixed #12345]\""},
 		},
 		{
@@ -45,9 +45,27 @@ func TestPtStoryFromWebhookIssue(t *testing.T) {
 		{
 			givenFile:             "testdata/github/issues.edited-body-del-ptlink.json",
 			expectedTitle:         "should have unique index on users.email column[fixed #12345]",
-			expectedBody:          "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\n- [ ] what else?",
+			expectedBody:          "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\n- ☐ what else?",
 			expectedSearchFilters: []string{"name:\"should have unique index on users.email column[fixed #12345]\""},
 		},
+		{
+			givenFile:             "testdata/github/issues.new-blocked.json",
+			expectedTitle:         "users.email should have unique constraint",
+			expectedBody:          "https://github.com/user123/repo456/issues/1\r\n\r\nblocked by [#3](https://github.com/user123/repo456/issues/3)",
+			expectedSearchFilters: []string{"name:\"users.email should have unique constraint\""},
+		},
+		{
+			givenFile:             "testdata/github/issues.edited-blockers.json",
+			expectedTitle:         "should have unique index on users.email column[fixed #12345]",
+			expectedBody:          "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five\r\n\r\nblocked by [#3](https://github.com/user123/repo456/issues/3)",
+			expectedSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "id:\"153984041\"", "name:\"should have unique index on users.email column[fixed #12345]\""},
+		},
+		{
+			givenFile:             "testdata/github/issues.edited-tasks.json",
+			expectedTitle:         "should have unique index on users.email column[fixed #12345]",
+			expectedBody:          "https://github.com/user123/repo456/issues/1\r\n\r\notherwise one two three four five",
+			expectedSearchFilters: []string{"id:\"153984041\"", "id:\"153984041\"", "id:\"153984041\"", "name:\"should have unique index on users.email column[fixed #12345]\""},
+		},
 		{
 			givenFile:      "testdata/github/issues.assigned.json",
 			expectNoChange: true,
@@ -105,6 +123,18 @@ func TestPtStoryFromWebhookIssue(t *testing.T) {
 			givenFile:     "testdata/github/push.json",
 			expectNoIssue: true,
 		},
+		{
+			givenFile:     "testdata/github/push.commits.json",
+			expectNoIssue: true,
+		},
+		{
+			givenFile:     "testdata/github/pull_request.opened.json",
+			expectNoIssue: true,
+		},
+		{
+			givenFile:     "testdata/github/pull_request.merged.json",
+			expectNoIssue: true,
+		},
 	}
 
 	for _, tc := range testCases {
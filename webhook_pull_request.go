@@ -0,0 +1,132 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type webhookPullRequest struct {
+	isOpened bool
+	isMerged bool
+	Number   int64          `json:"number"`
+	Title    string         `json:"title"`
+	Body     string         `json:"body"`
+	State    string         `json:"state"`
+	URL      string         `json:"html_url"`
+	Draft    bool           `json:"draft"`
+	Merged   bool           `json:"merged"`
+	Labels   []webhookLabel `json:"labels,omitempty"`
+	User     *webhookUser   `json:"user,omitempty"`
+	Head     struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+// e.g. "fixes #12", "Closes #3"
+var pullRequestIssueRef = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s+#(\d+)\b`)
+
+// e.g. "[#153984041]", "[Finishes #153984041]"
+var trackerTagRef = regexp.MustCompile(`\[(?:[a-zA-Z]+\s+)?#(\d+)\]`)
+
+// e.g. github's "create a branch" from issue 12 gives "12-some-title"
+var branchIssueRef = regexp.MustCompile(`^(\d{1,7})-`)
+
+// e.g. "pt-153984041-some-fix", "story/153984041" or "#153984041"; a bare number could be a date
+var branchStoryRef = regexp.MustCompile(`(?i)(?:#|(?:^|[^a-z0-9])(?:pt|story)[-_/]?)(\d{8,})(?:\D|$)`)
+
+func parseWebhookPullRequest(data []byte) (*webhookPullRequest, error) {
+	wh := githubWebhook{}
+	if err := json.Unmarshal(data, &wh); err != nil {
+		return nil, errors.Wrap(err, "unmarshal parse pull request")
+	}
+	if wh.PullRequest == nil {
+		return nil, nil
+	}
+
+	switch wh.Action {
+	case "opened", "reopened", "ready_for_review":
+		wh.PullRequest.isOpened = true
+	case "closed":
+		wh.PullRequest.isMerged = wh.PullRequest.Merged
+	}
+	return wh.PullRequest, nil
+}
+
+// issueURLs returns the html url of github issues this pull request says it will close
+func (pr *webhookPullRequest) issueURLs() []string {
+	i := strings.LastIndex(pr.URL, "/pull/")
+	if i < 0 {
+		return nil
+	}
+	prefix := pr.URL[:i] + "/issues/"
+
+	numbers := []string{}
+	for _, res := range pullRequestIssueRef.FindAllStringSubmatch(pr.Title+"\n"+pr.Body, -1) {
+		numbers = append(numbers, res[1])
+	}
+	if res := branchIssueRef.FindStringSubmatch(pr.Head.Ref); res != nil {
+		numbers = append(numbers, res[1])
+	}
+
+	urls := []string{}
+	for _, n := range uniqueStrings(numbers) {
+		urls = append(urls, prefix+n)
+	}
+	return urls
+}
+
+// storyIDs returns pivotal tracker story ids mentioned in pull request title, body or branch
+func (pr *webhookPullRequest) storyIDs(trackerHTMLURL string) []string {
+	ids := []string{}
+	for _, res := range trackerTagRef.FindAllStringSubmatch(pr.Title+"\n"+pr.Body, -1) {
+		ids = append(ids, res[1])
+	}
+	storyURL := regexp.MustCompile(fmt.Sprintf(`(?i)%s/%s/([\d]+)`, regexp.QuoteMeta(strings.TrimRight(trackerHTMLURL, "/")), "story/show"))
+	for _, res := range storyURL.FindAllStringSubmatch(pr.Body, -1) {
+		ids = append(ids, res[1])
+	}
+	if res := branchStoryRef.FindStringSubmatch(pr.Head.Ref); res != nil {
+		ids = append(ids, res[1])
+	}
+	return uniqueStrings(ids)
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, s := range values {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		result = append(result, s)
+	}
+	return result
+}
+
+// payload to attach a github pull request to a story
+type pullRequestDetail struct {
+	Owner   string `json:"owner"`
+	Repo    string `json:"repo"`
+	Number  int64  `json:"number"`
+	HostURL string `json:"host_url"`
+}
+
+// ptPullRequestFromWebhook returns nil if the pull request url cannot be understood
+func ptPullRequestFromWebhook(pr *webhookPullRequest) *pullRequestDetail {
+	// e.g. https://github.com/user123/repo456/pull/9
+	parts := strings.Split(strings.TrimRight(pr.URL, "/"), "/")
+	if len(parts) < 5 || parts[len(parts)-2] != "pull" {
+		return nil
+	}
+	return &pullRequestDetail{
+		Owner:   parts[len(parts)-4],
+		Repo:    parts[len(parts)-3],
+		Number:  pr.Number,
+		HostURL: strings.Join(parts[:len(parts)-4], "/") + "/",
+	}
+}
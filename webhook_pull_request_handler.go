@@ -0,0 +1,93 @@
+package githubtracker
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+func (s WebhookIssueHandler) handlePullRequest(pr *webhookPullRequest, client trackerAPIClient, htmlURL string, opts syncOptions) error {
+	if !pr.isOpened && !pr.isMerged {
+		log.Printf("skip pull request %s: not opened nor merged", pr.URL)
+		return nil
+	}
+	if reason := opts.Filters.issueOutOfScope(githubKindPullRequest, pr.User.login(), pr.Title, pr.Labels); reason != "" {
+		log.Printf("skip pull request %s: %s", pr.URL, reason)
+		return nil
+	}
+	if pr.Draft && opts.IgnoreDraftPullRequests {
+		log.Printf("skip draft pull request %s", pr.URL)
+		return nil
+	}
+
+	stories := []*trackerSearchResultRow{}
+	for _, issueURL := range pr.issueURLs() {
+		found, err := client.FindStoryByIssueURL(issueURL)
+		if isMultipleMatches(err) {
+			log.Println(err.Error(), issueURL) // logging here since we're skipping
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "FindStoryByIssueURL %s", issueURL)
+		}
+		if found != nil {
+			stories = append(stories, found)
+		}
+	}
+	for _, storyID := range pr.storyIDs(htmlURL) {
+		found, err := client.GetStory(storyID)
+		if err != nil {
+			return errors.Wrapf(err, "GetStory %s", storyID)
+		}
+		if found != nil && found.ID.String() != "" {
+			stories = append(stories, found)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, found := range stories {
+		if seen[found.ID.String()] {
+			continue
+		}
+		seen[found.ID.String()] = true
+
+		if pr.isOpened {
+			if detail := ptPullRequestFromWebhook(pr); detail != nil {
+				if err := client.AddPullRequest(found.ID.String(), detail); err != nil {
+					return errors.Wrapf(err, "AddPullRequest %#v", detail)
+				}
+			}
+		}
+
+		if found.StoryType == storyTypeFeature && found.Estimate == 0 {
+			log.Printf("skip state of story %s for pull request %s: PT only starts and finishes estimated features", found.ID.String(), pr.URL)
+			continue
+		}
+		story := storyDetail{}
+		switch found.CurrentState {
+		case storyStatePlanned, storyStateUnstarted, storyStateUnscheduled, storyStateRejected:
+			if pr.isOpened {
+				story.CurrentState = storyStateStarted
+			}
+			if pr.isMerged {
+				story.CurrentState = storyStateFinished
+			}
+		case storyStateStarted:
+			if pr.isMerged {
+				story.CurrentState = storyStateFinished
+			}
+		}
+		if story.CurrentState == storyStateFinished && found.StoryType == storyTypeChore {
+			story.CurrentState = storyStateAccepted // chores cannot be finished
+		}
+		if story.CurrentState == "" {
+			continue
+		}
+
+		log.Printf("updating story=%#v for pull request %s", story, pr.URL)
+		if err := client.UpdateStory(&story, found); err != nil {
+			return errors.Wrapf(err, "UpdateStory %#v", story)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package githubtracker
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookPullRequest(t *testing.T) {
+	testCases := []struct {
+		givenFile           string
+		expectedIsOpened    bool
+		expectedIsMerged    bool
+		expectedIssueURLs   []string
+		expectedStoryIDs    []string
+		expectedPullRequest *pullRequestDetail
+	}{
+		{
+			givenFile:         "testdata/github/pull_request.opened.json",
+			expectedIsOpened:  true,
+			expectedIssueURLs: []string{"https://github.com/user123/repo456/issues/1"},
+			expectedStoryIDs:  []string{"153984041"},
+			expectedPullRequest: &pullRequestDetail{
+				Owner:   "user123",
+				Repo:    "repo456",
+				Number:  9,
+				HostURL: "https://github.com/",
+			},
+		},
+		{
+			givenFile:         "testdata/github/pull_request.draft.json",
+			expectedIsOpened:  true,
+			expectedIssueURLs: []string{},
+			expectedStoryIDs:  []string{"153984041"},
+			expectedPullRequest: &pullRequestDetail{
+				Owner:   "user123",
+				Repo:    "repo456",
+				Number:  10,
+				HostURL: "https://github.com/",
+			},
+		},
+		{
+			givenFile:         "testdata/github/pull_request.merged.json",
+			expectedIsMerged:  true,
+			expectedIssueURLs: []string{"https://github.com/user123/repo456/issues/1"},
+			expectedStoryIDs:  []string{},
+			expectedPullRequest: &pullRequestDetail{
+				Owner:   "user123",
+				Repo:    "repo456",
+				Number:  9,
+				HostURL: "https://github.com/",
+			},
+		},
+		{
+			givenFile:         "testdata/github/pull_request.closed.json",
+			expectedIssueURLs: []string{"https://github.com/user123/repo456/issues/1"},
+			expectedStoryIDs:  []string{},
+			expectedPullRequest: &pullRequestDetail{
+				Owner:   "user123",
+				Repo:    "repo456",
+				Number:  11,
+				HostURL: "https://github.com/",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.givenFile, func(t *testing.T) {
+			data, err := ioutil.ReadFile(tc.givenFile)
+			if err != nil {
+				t.Fatalf("readfile: %s", err.Error())
+			}
+
+			pr, err := parseWebhookPullRequest(data)
+			if err != nil {
+				t.Fatalf("parseWebhookPullRequest: %s", err.Error())
+			}
+			if !assert.NotNil(t, pr, "pull request") {
+				return
+			}
+
+			assert.Equal(t, tc.expectedIsOpened, pr.isOpened, "isOpened")
+			assert.Equal(t, tc.expectedIsMerged, pr.isMerged, "isMerged")
+			assert.Equal(t, tc.expectedIssueURLs, pr.issueURLs(), "issueURLs")
+			assert.Equal(t, tc.expectedStoryIDs, pr.storyIDs("https://www.pivotaltracker.com"), "storyIDs")
+			assert.Equal(t, tc.expectedPullRequest, ptPullRequestFromWebhook(pr), "pullRequestDetail")
+		})
+	}
+}
+
+func TestWebhookPullRequestIgnoresIssues(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/github/issues.new.json")
+	if err != nil {
+		t.Fatalf("readfile: %s", err.Error())
+	}
+	pr, err := parseWebhookPullRequest(data)
+	assert.Nil(t, err)
+	assert.Nil(t, pr)
+}
+
+func TestWebhookPullRequestBranchStoryIDs(t *testing.T) {
+	testCases := []struct {
+		givenBranch      string
+		expectedStoryIDs []string
+	}{
+		{givenBranch: "pt-153984041-some-fix", expectedStoryIDs: []string{"153984041"}},
+		{givenBranch: "PT_153984041", expectedStoryIDs: []string{"153984041"}},
+		{givenBranch: "feature/story/153984041", expectedStoryIDs: []string{"153984041"}},
+		{givenBranch: "fix#153984041", expectedStoryIDs: []string{"153984041"}},
+		{givenBranch: "fix-20261019", expectedStoryIDs: []string{}},
+		{givenBranch: "20261019-release", expectedStoryIDs: []string{}},
+		{givenBranch: "apt-20261019", expectedStoryIDs: []string{}},
+		{givenBranch: "JIRA-12345678", expectedStoryIDs: []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.givenBranch, func(t *testing.T) {
+			pr := &webhookPullRequest{}
+			pr.Head.Ref = tc.givenBranch
+			assert.Equal(t, tc.expectedStoryIDs, pr.storyIDs("https://www.pivotaltracker.com"))
+		})
+	}
+}
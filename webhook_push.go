@@ -0,0 +1,123 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type webhookPush struct {
+	Ref     string
+	Deleted bool
+	Commits []webhookCommit
+}
+
+type webhookCommit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	URL      string   `json:"url"`
+	Distinct bool     `json:"distinct"`
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	Author   struct {
+		Name     string `json:"name"`
+		Username string `json:"username,omitempty"`
+	} `json:"author"`
+}
+
+// e.g. "#12", "fixes #12"
+var commitIssueRef = regexp.MustCompile(`(?i)(?:\b(close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s+)?#(\d+)\b`)
+
+func parseWebhookPush(data []byte) (*webhookPush, error) {
+	wh := githubWebhook{}
+	if err := json.Unmarshal(data, &wh); err != nil {
+		return nil, errors.Wrap(err, "unmarshal parse push")
+	}
+	if wh.Ref == "" || len(wh.Commits) == 0 {
+		return nil, nil
+	}
+	return &webhookPush{
+		Ref:     wh.Ref,
+		Deleted: wh.Deleted,
+		Commits: wh.Commits,
+	}, nil
+}
+
+// commitIssueLink is a github issue mentioned in a commit message
+type commitIssueLink struct {
+	URL    string
+	Closes bool
+}
+
+// issueLinks returns the github issues mentioned in commit message, excluding pivotal tracker tags
+func (c webhookCommit) issueLinks() []commitIssueLink {
+	i := strings.LastIndex(c.URL, "/commit/")
+	if i < 0 {
+		return nil
+	}
+	prefix := c.URL[:i] + "/issues/"
+
+	seen := map[string]bool{}
+	links := []commitIssueLink{}
+	message := trackerTagRef.ReplaceAllString(c.Message, "")
+	for _, res := range commitIssueRef.FindAllStringSubmatch(message, -1) {
+		if seen[res[2]] {
+			continue
+		}
+		seen[res[2]] = true
+		links = append(links, commitIssueLink{
+			URL:    prefix + res[2],
+			Closes: res[1] != "",
+		})
+	}
+	return links
+}
+
+// payload to be sent to pivotaltracker.com source_commits
+type sourceCommitDetail struct {
+	CommitID string `json:"commit_id"`
+	Message  string `json:"message"`
+	URL      string `json:"url"`
+	Author   string `json:"author"`
+}
+
+// ptSourceCommitFromWebhookCommit returns nil if commit does not mention any story;
+// `storyIDs` maps github issue url to its linked story id
+//
+// tracker applies the state change of tags like `[Finishes #123]` on its own,
+// so issues are translated into such tags instead of updating stories directly
+func ptSourceCommitFromWebhookCommit(c webhookCommit, storyIDs map[string]string) *sourceCommitDetail {
+	message := c.Message
+	tags := []string{}
+	for _, link := range c.issueLinks() {
+		storyID, ok := storyIDs[link.URL]
+		if !ok {
+			continue
+		}
+		if link.Closes {
+			tags = append(tags, "[Fixes #"+storyID+"]")
+		} else {
+			tags = append(tags, "[#"+storyID+"]")
+		}
+	}
+	if len(tags) > 0 {
+		message = strings.TrimSpace(message) + "\n\n" + strings.Join(tags, " ")
+	}
+	if !trackerTagRef.MatchString(message) {
+		return nil
+	}
+
+	author := c.Author.Name
+	if c.Author.Username != "" {
+		author = c.Author.Username
+	}
+	return &sourceCommitDetail{
+		CommitID: c.ID,
+		Message:  message,
+		URL:      c.URL,
+		Author:   author,
+	}
+}
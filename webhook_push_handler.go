@@ -0,0 +1,48 @@
+package githubtracker
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+func (s WebhookIssueHandler) handlePush(push *webhookPush, client trackerAPIClient) error {
+	if push.Deleted {
+		log.Printf("skip deleted %s", push.Ref)
+		return nil
+	}
+
+	storyIDs := map[string]string{}
+	for _, c := range push.Commits {
+		if !c.Distinct {
+			continue // already posted when first pushed to another branch
+		}
+
+		for _, link := range c.issueLinks() {
+			if _, ok := storyIDs[link.URL]; ok {
+				continue
+			}
+			found, err := client.FindStoryByIssueURL(link.URL)
+			if isMultipleMatches(err) {
+				log.Println(err.Error(), link.URL) // logging here since we're skipping
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "FindStoryByIssueURL %s", link.URL)
+			}
+			if found != nil {
+				storyIDs[link.URL] = found.ID.String()
+			}
+		}
+
+		commit := ptSourceCommitFromWebhookCommit(c, storyIDs)
+		if commit == nil {
+			log.Printf("skip commit %s: no story", c.ID)
+			continue
+		}
+		if err := client.AddSourceCommit(commit); err != nil {
+			return errors.Wrapf(err, "AddSourceCommit %#v", commit)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package githubtracker
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookPush(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/github/push.commits.json")
+	if err != nil {
+		t.Fatalf("readfile: %s", err.Error())
+	}
+
+	push, err := parseWebhookPush(data)
+	if err != nil {
+		t.Fatalf("parseWebhookPush: %s", err.Error())
+	}
+	if !assert.NotNil(t, push) {
+		return
+	}
+	assert.Equal(t, "refs/heads/master", push.Ref)
+	assert.Equal(t, 4, len(push.Commits))
+
+	testCases := []struct {
+		givenCommit          webhookCommit
+		givenStoryIDs        map[string]string
+		expectedIssueLinks   []commitIssueLink
+		expectedSourceCommit *sourceCommitDetail
+	}{
+		{
+			givenCommit:        push.Commits[0],
+			expectedIssueLinks: []commitIssueLink{},
+			expectedSourceCommit: &sourceCommitDetail{
+				CommitID: "0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+				Message:  "add unique index on users.email [Finishes #153984041]",
+				URL:      "https://github.com/user123/repo456/commit/0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c",
+				Author:   "user123",
+			},
+		},
+		{
+			givenCommit:   push.Commits[1],
+			givenStoryIDs: map[string]string{"https://github.com/user123/repo456/issues/1": "42"},
+			expectedIssueLinks: []commitIssueLink{
+				{URL: "https://github.com/user123/repo456/issues/1", Closes: true},
+			},
+			expectedSourceCommit: &sourceCommitDetail{
+				CommitID: "4f3c8a1d1e9cfd1c6f0d8a3ffb0ab7e5c7b8f4a2",
+				Message:  "validate email format\n\nfixes #1\n\n[Fixes #42]",
+				URL:      "https://github.com/user123/repo456/commit/4f3c8a1d1e9cfd1c6f0d8a3ffb0ab7e5c7b8f4a2",
+				Author:   "user123",
+			},
+		},
+		{
+			givenCommit: push.Commits[1],
+			expectedIssueLinks: []commitIssueLink{
+				{URL: "https://github.com/user123/repo456/issues/1", Closes: true},
+			},
+		},
+		{
+			givenCommit:        push.Commits[2],
+			expectedIssueLinks: []commitIssueLink{},
+		},
+		{
+			givenCommit: webhookCommit{
+				ID:      "abc",
+				Message: "see #3 and #3",
+				URL:     "https://github.com/user123/repo456/commit/abc",
+			},
+			givenStoryIDs: map[string]string{"https://github.com/user123/repo456/issues/3": "33"},
+			expectedIssueLinks: []commitIssueLink{
+				{URL: "https://github.com/user123/repo456/issues/3"},
+			},
+			expectedSourceCommit: &sourceCommitDetail{
+				CommitID: "abc",
+				Message:  "see #3 and #3\n\n[#33]",
+				URL:      "https://github.com/user123/repo456/commit/abc",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.givenCommit.ID, func(t *testing.T) {
+			assert.Equal(t, tc.expectedIssueLinks, tc.givenCommit.issueLinks())
+			assert.Equal(t, tc.expectedSourceCommit, ptSourceCommitFromWebhookCommit(tc.givenCommit, tc.givenStoryIDs))
+		})
+	}
+}
@@ -6,23 +6,42 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 const (
+	changeTypeCreate = "create"
 	changeTypeUpdate = "update"
 	changeTypeDelete = "delete"
 )
 
 type webhookStory struct {
-	URL           string  `json:"url"`
-	Title         string  `json:"title"`
-	Body          *string `json:"body,omitempty"`
-	StoryID       string  `json:"story_id"`
-	CurrentState  string  `json:"current_state,omitempty"`
-	titleWas      *string
-	githubHTMLURL string
+	URL            string  `json:"url"`
+	Title          string  `json:"title"`
+	Body           *string `json:"body,omitempty"`
+	StoryID        string  `json:"story_id"`
+	CurrentState   string  `json:"current_state,omitempty"`
+	titleWas       *string
+	bodyWas        *string
+	occurredAt     time.Time
+	githubHTMLURL  string
+	taskChanges    []checklistChange
+	blockerChanges []checklistChange
+	labelsAdded    []string
+	labelsRemoved  []string
+	labels         []string // nil when not in the payload
+	labelsWas      []string
+	storyType      string
+	storyTypeWas   *string
+	stateWas       *string
+	onlySections   bool
+	isMoved        bool
+	isCreated      bool
+	isScoped       bool // just came into the sync filters
+	projectID      string
+	opts           syncOptions
 }
 
 func parseWebhookStory(data []byte, githubHTMLURL string, trackerHTMLURL string) (*webhookStory, error) {
@@ -35,9 +54,31 @@ func parseWebhookStory(data []byte, githubHTMLURL string, trackerHTMLURL string)
 	var newBody *string
 	var newState *string
 	story := webhookStory{}
+	if wh.OccurredAt != 0 {
+		story.occurredAt = time.Unix(0, wh.OccurredAt*int64(time.Millisecond))
+	}
+	if wh.Project != nil {
+		story.projectID = fmt.Sprintf("%d", wh.Project.ID)
+	}
+
+	for _, r := range wh.PrimaryResources {
+		if r.Kind == "story" && r.StoryType != storyTypeRelease {
+			story.StoryID = fmt.Sprintf("%d", r.ID)
+			story.Title = r.Name
+			story.storyType = r.StoryType
+		}
+	}
 
 	for _, c := range wh.Changes {
 		c := c
+		if c.Kind == "task" && story.StoryID != "" {
+			story.taskChanges = append(story.taskChanges, taskChangeFromTracker(c))
+			continue
+		}
+		if c.Kind == "blocker" && story.StoryID != "" {
+			story.blockerChanges = append(story.blockerChanges, blockerChangeFromTracker(c))
+			continue
+		}
 		if c.Kind != "story" || c.StoryType == storyTypeRelease {
 			continue
 		}
@@ -47,6 +88,9 @@ func parseWebhookStory(data []byte, githubHTMLURL string, trackerHTMLURL string)
 		if c.OldValues.Name != nil {
 			story.titleWas = c.OldValues.Name
 		}
+		if c.OldValues.Description != nil {
+			story.bodyWas = c.OldValues.Description
+		}
 		if c.NewValues.Name != nil {
 			newTitle = c.NewValues.Name
 			story.Title = *newTitle
@@ -58,16 +102,48 @@ func parseWebhookStory(data []byte, githubHTMLURL string, trackerHTMLURL string)
 		if c.NewValues.CurrentState != nil {
 			newState = c.NewValues.CurrentState
 			story.CurrentState = *newState
+			story.stateWas = c.OldValues.CurrentState
+		}
+		if c.StoryType != "" {
+			story.storyType = c.StoryType
+		}
+		if c.NewValues.StoryType != nil {
+			story.storyType = *c.NewValues.StoryType
+			story.storyTypeWas = c.OldValues.StoryType
 		}
 
+		if c.NewValues.Labels != nil {
+			story.labelsAdded = subtractStrings(c.NewValues.Labels, c.OldValues.Labels)
+			story.labelsRemoved = subtractStrings(c.OldValues.Labels, c.NewValues.Labels)
+			story.labels = c.NewValues.Labels
+			story.labelsWas = append([]string{}, c.OldValues.Labels...)
+		}
+
+		if c.ChangeType == changeTypeCreate {
+			story.isCreated = true
+			if story.labels == nil {
+				story.labels = []string{} // a new story has every label in the payload
+			}
+		}
 		if c.ChangeType == changeTypeDelete {
 			newState = &c.ChangeType
 			story.CurrentState = *newState
 		}
+
+		if c.NewValues.ProjectID != nil && c.OldValues.ProjectID != nil && *c.NewValues.ProjectID != *c.OldValues.ProjectID {
+			story.isMoved = true
+		}
+	}
+
+	if story.isMoved {
+		story.githubHTMLURL = githubHTMLURL
+		story.URL = fmt.Sprintf("%s/story/show/%s", trackerHTMLURL, story.StoryID)
+		return &story, nil
 	}
 
-	if newTitle != nil || newBody != nil || newState != nil {
+	if newTitle != nil || newBody != nil || newState != nil || len(story.taskChanges) > 0 || len(story.blockerChanges) > 0 || len(story.labelsAdded) > 0 || len(story.labelsRemoved) > 0 {
 		story.githubHTMLURL = githubHTMLURL
+		story.onlySections = (newTitle == nil && newBody == nil && newState == nil)
 		story.URL = fmt.Sprintf("%s/story/show/%s", trackerHTMLURL, story.StoryID)
 		return &story, nil
 	}
@@ -75,8 +151,73 @@ func parseWebhookStory(data []byte, githubHTMLURL string, trackerHTMLURL string)
 	return nil, nil
 }
 
+func parseWebhookEpic(data []byte, trackerHTMLURL string) (*webhookEpic, error) {
+	var wh trackerWebhook
+	if err := json.Unmarshal(data, &wh); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal")
+	}
+
+	changed := false
+	epic := webhookEpic{}
+	for _, c := range wh.Changes {
+		c := c
+		if c.Kind != "epic" {
+			continue
+		}
+
+		epic.ID = fmt.Sprintf("%d", c.ID)
+		epic.Name = c.Name
+		if c.OldValues.Name != nil {
+			epic.nameWas = c.OldValues.Name
+		}
+		if c.NewValues.Name != nil {
+			epic.Name = *c.NewValues.Name
+			changed = true
+		}
+		if c.NewValues.Description != nil {
+			epic.Description = c.NewValues.Description
+			changed = true
+		}
+		if c.ChangeType == changeTypeDelete {
+			epic.isDeleted = true
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil, nil
+	}
+	epic.URL = fmt.Sprintf("%s/epic/show/%s", trackerHTMLURL, epic.ID)
+	return &epic, nil
+}
+
+// subtractStrings returns values in `a` that are not in `b`
+func subtractStrings(a, b []string) []string {
+	result := []string{}
+	for _, s := range a {
+		found := false
+		for _, t := range b {
+			found = found || (s == t)
+		}
+		if !found {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 type trackerWebhook struct {
-	Changes []trackerChange `json:"changes,omitempty"`
+	OccurredAt       int64             `json:"occurred_at,omitempty"` // milliseconds
+	Project          *trackerResource  `json:"project,omitempty"`
+	Changes          []trackerChange   `json:"changes,omitempty"`
+	PrimaryResources []trackerResource `json:"primary_resources,omitempty"`
+}
+
+type trackerResource struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	StoryType string `json:"story_type,omitempty"`
 }
 
 type trackerChange struct {
@@ -90,9 +231,35 @@ type trackerChange struct {
 }
 
 type trackerChangeValues struct {
-	Description  *string `json:"description,omitempty"`
-	Name         *string `json:"name,omitempty"`
-	CurrentState *string `json:"current_state,omitempty"`
+	Description  *string  `json:"description,omitempty"`
+	Name         *string  `json:"name,omitempty"`
+	CurrentState *string  `json:"current_state,omitempty"`
+	StoryType    *string  `json:"story_type,omitempty"`
+	Complete     *bool    `json:"complete,omitempty"`
+	Position     *int     `json:"position,omitempty"`
+	Resolved     *bool    `json:"resolved,omitempty"`
+	Labels       []string `json:"labels,omitempty"`
+	ProjectID    *int64   `json:"project_id,omitempty"`
+}
+
+func taskChangeFromTracker(c trackerChange) checklistChange {
+	result := checklistChange{
+		Action: c.ChangeType,
+		Item:   checklistItem{ID: fmt.Sprintf("%d", c.ID)},
+	}
+	if v := c.NewValues.Description; v != nil {
+		result.Item.Text = *v
+		result.hasText = true
+	}
+	if v := c.NewValues.Complete; v != nil {
+		result.Item.Checked = *v
+		result.hasChecked = true
+	}
+	if v := c.NewValues.Position; v != nil {
+		result.Item.Position = *v
+		result.hasPosition = true
+	}
+	return result
 }
 
 func (s webhookStory) StrippedBody() string {
@@ -103,21 +270,34 @@ func (s webhookStory) StrippedBody() string {
 	return strings.TrimSpace(githubLinkBodyPrefix.ReplaceAllString(*s.Body, ""))
 }
 
+func (s webhookStory) link() storyLink {
+	return storyLink{URL: s.URL, StoryID: s.StoryID, ProjectID: s.projectID, Version: storyLinkVersion}
+}
+
 var noStorySuffix = " [no story]"
 var standardTrackerSearchScope = "in:title is:issue" // used to split and extract actual title
 
 func ghIssueFromWebhookStory(story webhookStory, repo, githubHTMLURL string) (*issueDetail, error) {
 	buf := bytes.Buffer{}
 	if story.Body != nil {
-		if err := bodyTemplate.Execute(&buf, story); err != nil {
+		link, err := story.link().render(story.opts.LinkTemplate)
+		if err != nil {
+			return nil, err
+		}
+		parts := bodyParts{Link: link, StrippedBody: markdownToGithub(story.StrippedBody(), strings.TrimRight(githubHTMLURL, "/")+"/"+repo, story.opts.People)}
+		if err := bodyTemplate.Execute(&buf, parts); err != nil {
 			return nil, errors.Wrapf(err, "template %#v", bodyTemplate)
 		}
 	}
 
 	issue := issueDetail{
-		repo:  repo,
-		Body:  buf.String(),
-		Title: story.Title,
+		repo:     repo,
+		Body:     buf.String(),
+		Title:    story.Title,
+		storyURL: story.URL,
+	}
+	if story.isCreated {
+		issue.createdAt = story.occurredAt
 	}
 
 	if story.titleWas != nil {
@@ -134,21 +314,55 @@ func ghIssueFromWebhookStory(story webhookStory, repo, githubHTMLURL string) (*i
 
 	// put after `searchFilters` since we don't want `noStorySuffix` to affect search
 	switch s := story.CurrentState; s {
+	case "":
 	case changeTypeDelete: // unclean; using invalid `delete` value for story state...
 		issue.Title = issue.Title + noStorySuffix
 		issue.Body = "" // don't touch it
-	case storyStateAccepted:
-		issue.State = "closed"
-	case storyStateRejected, storyStatePlanned, storyStateStarted, storyStateUnstarted, storyStateUnscheduled:
-		// if we're moving *into* any of these story state, the issue is `open`
-		issue.State = "open"
-	case storyStateFinished, storyStateDelivered:
-		// not explicitly stating whether issue is close/open
-		// e.g. a merged pull request may close an issue, marking story=finished
-		//      it isn't right to re-open issue again
-		// e.g. if story is marked as finished, but not accepted by product owner
-		//      it isn't right to reach in and close issue too
+		return &issue, nil
+	default:
+		if state := story.opts.Policy.issueState(s); state != policyKeep {
+			issue.State = state
+		}
 	}
 
+	// only fields owned by tracker sync, but a new story gives its issue every field
+	if fields := story.opts.Fields; !story.isCreated {
+		if !fromTracker(fields.Title) {
+			issue.Title = ""
+		}
+		if !fromTracker(fields.Body) {
+			issue.Body = ""
+		}
+		if !fromTracker(fields.State) {
+			issue.State = ""
+		}
+	}
 	return &issue, nil
 }
+
+func blockerChangeFromTracker(c trackerChange) checklistChange {
+	result := checklistChange{
+		Action: c.ChangeType,
+		Item:   checklistItem{ID: fmt.Sprintf("%d", c.ID)},
+	}
+	if v := c.NewValues.Description; v != nil {
+		result.Item.Text = *v
+		result.hasText = true
+	}
+	if v := c.NewValues.Resolved; v != nil {
+		result.Item.Checked = *v
+		result.hasChecked = true
+	}
+	return result
+}
+
+// scopedBody puts the story link on top of `body`, for a story that came into the sync filters
+func (s webhookStory) scopedBody(body string) (string, error) {
+	link, err := s.link().render(s.opts.LinkTemplate)
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.Buffer{}
+	err = bodyTemplate.Execute(&buf, bodyParts{Link: link, StrippedBody: strings.TrimSpace(body)})
+	return buf.String(), errors.Wrapf(err, "template %#v", bodyTemplate)
+}
@@ -11,6 +11,7 @@ import (
 )
 
 type WebhookStoryHandler struct {
+	Review *ReviewQueue // optional; issues of the same title wait here for an operator
 }
 
 func (s WebhookStoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -32,14 +33,47 @@ func (s WebhookStoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		URL:      values.Get("api_url"),
 		Repo:     values.Get("repo"),
 	}
+	routes := routesFromValues(values)
+	clientFor := func(r route) githubAPIClient { return r.github(client) }
+	repo, err := storyRepo(data, clientFor, routes, values.Get("repo"), values.Get("github_html_url"), values.Get("tracker_html_url"))
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	client = routeTo(routes, repo).github(client)
 
-	if err = s.handle(data, client, values.Get("repo"), values.Get("github_html_url"), values.Get("tracker_html_url")); err != nil {
+	opts, err := syncOptionsFromValues(values)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var api githubAPIClient = client
+	dryRun := &dryRunLog{}
+	if opts.DryRun {
+		api, opts.dryRun = dryRunGithub{client, dryRun}, dryRun
+	}
+	api = adminEventFromContext(r.Context()).github(api, opts.DryRun)
+	if err = s.handle(data, api, repo, values.Get("github_html_url"), values.Get("tracker_html_url"), opts); err != nil {
 		log.Println(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if opts.DryRun {
+		dryRun.writeJSON(w)
 	}
 }
 
-func (s WebhookStoryHandler) handle(data []byte, client githubAPIClient, repo, githubHTMLURL, trackerHTMLURL string) error {
+func (s WebhookStoryHandler) handle(data []byte, client githubAPIClient, repo, githubHTMLURL, trackerHTMLURL string, opts syncOptions) error {
+	epic, err := parseWebhookEpic(data, trackerHTMLURL)
+	if err != nil {
+		return errors.Wrapf(err, "json unmarshal")
+	}
+	if epic != nil {
+		return s.handleEpic(*epic, client, repo)
+	}
+
 	story, err := parseWebhookStory(data, githubHTMLURL, trackerHTMLURL)
 	if err != nil {
 		return errors.Wrapf(err, "json unmarshal")
@@ -49,6 +83,33 @@ func (s WebhookStoryHandler) handle(data []byte, client githubAPIClient, repo, g
 		return nil
 	}
 	fmt.Printf("webhook story = %#v\n", story)
+	if !story.isMoved && story.CurrentState != changeTypeDelete {
+		switch now, was := opts.Filters.storyScope(story); {
+		case now != "" && was == "":
+			log.Printf("story %s left the sync filters: %s", story.URL, now)
+			return s.unlinkStory(story, client, repo, trackerHTMLURL)
+		case now != "":
+			log.Printf("skip story %s: %s", story.URL, now)
+			return nil
+		case was != "":
+			log.Printf("story %s came into the sync filters", story.URL)
+			story.isScoped = true
+		}
+	}
+	return s.handleStory(story, client, repo, githubHTMLURL, trackerHTMLURL, opts)
+}
+
+// handleStory syncs a story to its issue; the reconciler calls this directly
+func (s WebhookStoryHandler) handleStory(story *webhookStory, client githubAPIClient, repo, githubHTMLURL, trackerHTMLURL string, opts syncOptions) error {
+	story.opts = opts
+
+	if story.isMoved {
+		if opts.OnProjectMove != projectMoveUnlink {
+			log.Println("story moved; issue still links to it")
+			return nil
+		}
+		story.CurrentState = changeTypeDelete // unlink like a deleted story
+	}
 
 	issue, err := ghIssueFromWebhookStory(*story, repo, githubHTMLURL)
 	if err != nil {
@@ -61,7 +122,13 @@ func (s WebhookStoryHandler) handle(data []byte, client githubAPIClient, repo, g
 	fmt.Printf("issue %#v\n", issue)
 
 	found, err := client.FindIssue(issue)
-	if err == multipleMatchesError {
+	if ambiguous, ok := err.(*ambiguousError); ok {
+		if found = s.chosenIssue(story.URL, ambiguous); found == nil {
+			return s.queueIssues(story, issue, ambiguous, client)
+		}
+		err = nil
+	}
+	if isMultipleMatches(err) {
 		log.Println(err.Error())
 		return nil
 	}
@@ -71,13 +138,77 @@ func (s WebhookStoryHandler) handle(data []byte, client githubAPIClient, repo, g
 	fmt.Printf("found %#v\n", found)
 
 	if found != nil {
+		if reason := opts.Filters.issueOutOfScope(githubKindIssue, found.User.login(), found.Title, found.Labels); reason != "" && !strings.HasSuffix(issue.Title, noStorySuffix) {
+			log.Printf("skip issue #%d: %s", found.Number, reason)
+			return nil
+		}
+		if story.isScoped && !bodyLinksTo(found.Body, story.URL) {
+			// link the issue again; its description follows on the next edit
+			if issue.Body, err = story.scopedBody(found.Body); err != nil {
+				return errors.Wrapf(err, "scopedBody")
+			}
+		}
+
+		if err = s.syncEpicMembers(*story, found, client, repo); err != nil {
+			return errors.Wrapf(err, "syncEpicMembers %#v", found)
+		}
+
+		if !strings.HasSuffix(issue.Title, noStorySuffix) {
+			conflicts, err := resolveIssueConflicts(story, issue, found, githubHTMLURL, trackerHTMLURL)
+			if err != nil {
+				return errors.Wrapf(err, "resolveIssueConflicts")
+			}
+			if len(conflicts) > 0 {
+				log.Printf("%s of issue #%d changed on both sides since the last sync", strings.Join(conflicts, " and "), found.Number)
+				issue.Labels = withLabel(found.Labels, syncConflictLabel)
+			}
+		}
+
 		if strings.HasSuffix(issue.Title, noStorySuffix) {
 			// get github issue and fixup the body
 			founddetail, err := client.GetIssue(issue, found)
 			if err != nil {
 				return errors.Wrapf(err, "GetIssue %#v", found)
 			}
-			issue.Body = strings.TrimSpace(bodyStripRegexpFor(trackerHTMLURL).ReplaceAllString(founddetail.Body, ""))
+			issue.Body = strings.TrimSpace(stripStoryLink(founddetail.Body, trackerHTMLURL))
+		} else if issue.Body != "" || len(story.taskChanges) > 0 || len(story.blockerChanges) > 0 {
+			// checklist sections are only known to github; keep them when description changes
+			founddetail, err := client.GetIssue(issue, found)
+			if err != nil {
+				return errors.Wrapf(err, "GetIssue %#v", found)
+			}
+			blockerChanges := []checklistChange{}
+			for _, c := range story.blockerChanges {
+				if c.hasText {
+					if c.Item.Text, err = ghBlockedByText(client, repo, githubHTMLURL, trackerHTMLURL, c.Item.Text); err != nil {
+						return errors.Wrapf(err, "ghBlockedByText %#v", c)
+					}
+				}
+				blockerChanges = append(blockerChanges, c)
+			}
+
+			body := issue.Body
+			if body == "" {
+				body = founddetail.Body
+			}
+			for _, c := range blockerChanges {
+				if c.Action == checklistCreate {
+					body = removeBlockedByLine(body, c.Item.Text)
+				}
+			}
+			body = tasksSection.merge(body, founddetail.Body, story.taskChanges)
+			body = blockersSection.merge(body, founddetail.Body, blockerChanges)
+			issue.Body = body
+			if story.onlySections && issue.Body == founddetail.Body {
+				log.Println("no checklist changes")
+				return nil
+			}
+		} else if story.onlySections {
+			return nil // e.g. only labels changed
+		}
+		if issue.Title == "" && issue.Body == "" && issue.State == "" && issue.Labels == nil {
+			log.Println("nothing left to update")
+			return nil
 		}
 		err = client.UpdateIssue(issue, found)
 		return errors.Wrapf(err, "UpdateIssue %#v", issue)
@@ -86,7 +217,70 @@ func (s WebhookStoryHandler) handle(data []byte, client githubAPIClient, repo, g
 	if strings.HasSuffix(issue.Title, noStorySuffix) {
 		return nil // not found? don't create; we're deleting the story...
 	}
+	if story.onlySections && !story.isScoped {
+		return nil // not found? don't create an issue just for its tasks, blockers or labels
+	}
+	if story.isScoped && issue.Body == "" {
+		if issue.Body, err = story.scopedBody(""); err != nil {
+			return errors.Wrapf(err, "scopedBody")
+		}
+	}
+	if !opts.Fields.createsIssues() || issue.Title == "" {
+		log.Println("no issue to update, and title is not synced from tracker")
+		return nil
+	}
 
 	err = client.CreateIssue(issue)
 	return errors.Wrapf(err, "CreateIssue %#v", issue)
 }
+
+// unlinkStory takes the story link out of the issue body, once the story left the sync filters;
+// the issue link stays in the story, to link them again if the story comes back
+func (s WebhookStoryHandler) unlinkStory(story *webhookStory, client githubAPIClient, repo, trackerHTMLURL string) error {
+	found, err := client.FindIssueByTrackerURL(repo, story.URL)
+	if isMultipleMatches(err) {
+		log.Println(err.Error())
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "FindIssueByTrackerURL %s", story.URL)
+	}
+	if found == nil || !bodyLinksTo(found.Body, story.URL) {
+		return nil
+	}
+	issue := &issueDetail{repo: repo, Body: strings.TrimSpace(stripStoryLink(found.Body, trackerHTMLURL))}
+	if issue.Body == "" {
+		log.Printf("issue #%d has nothing but the story link; leaving it", found.Number)
+		return nil
+	}
+	err = client.UpdateIssue(issue, found)
+	return errors.Wrapf(err, "UpdateIssue %#v", issue)
+}
+
+// chosenIssue returns the candidate an operator chose for `storyURL` in the review queue
+func (s WebhookStoryHandler) chosenIssue(storyURL string, ambiguous *ambiguousError) *githubSearchResultRow {
+	chosen := s.Review.chosen(storyURL)
+	for i, c := range ambiguous.Issues {
+		if chosen != "" && c.HTMLURL == chosen {
+			return &ambiguous.Issues[i]
+		}
+	}
+	return nil
+}
+
+// queueIssues labels the issues a story can't tell apart, for an operator to choose from the review queue
+func (s WebhookStoryHandler) queueIssues(story *webhookStory, issue *issueDetail, ambiguous *ambiguousError, client githubAPIClient) error {
+	if err := s.Review.add(story.URL, issue.Title, ambiguous.issueURLs(), story.opts.dryRun); err != nil {
+		return errors.Wrapf(err, "review %s", story.URL)
+	}
+	for i, c := range ambiguous.Issues {
+		labels := withLabel(c.Labels, syncAmbiguousLabel)
+		if labels == nil {
+			continue
+		}
+		if err := client.UpdateIssue(&issueDetail{repo: issue.repo, Labels: labels}, &ambiguous.Issues[i]); err != nil {
+			return errors.Wrapf(err, "label #%d %s", c.Number, syncAmbiguousLabel)
+		}
+	}
+	return nil
+}
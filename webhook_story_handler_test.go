@@ -11,6 +11,8 @@ import (
 type logGithubClient struct {
 	History            []logAction
 	ExpectedFoundIssue *githubSearchResultRow
+	ExpectedSearch     []githubSearchResultRow
+	ExpectedIssues     []githubSearchResultRow
 	ExpectedError      error
 }
 
@@ -21,6 +23,7 @@ type logAction struct {
 	GivenBody          string
 	GivenState         string
 	GivenSearchFilters []string
+	GivenLabels        []string
 }
 
 func (l *logGithubClient) GetIssue(issue *issueDetail, rs *githubSearchResultRow) (*githubGetResult, error) {
@@ -34,6 +37,34 @@ func (l *logGithubClient) GetIssue(issue *issueDetail, rs *githubSearchResultRow
 	return &githubGetResult{Body: l.ExpectedFoundIssue.Body}, nil
 }
 
+func (l *logGithubClient) FindIssueByTrackerURL(repo, trackerURL string) (*githubSearchResultRow, error) {
+	l.History = append(l.History, logAction{
+		Method:  "FindIssueByTrackerURL",
+		GivenID: trackerURL,
+	})
+	return l.ExpectedFoundIssue, l.ExpectedError
+}
+
+func (l *logGithubClient) SearchIssues(query string) ([]githubSearchResultRow, error) {
+	l.History = append(l.History, logAction{
+		Method:  "SearchIssues",
+		GivenID: query,
+	})
+	return l.ExpectedSearch, l.ExpectedError
+}
+
+func (l *logGithubClient) ListIssues(repo, state string, page int) ([]githubSearchResultRow, error) {
+	l.History = append(l.History, logAction{
+		Method:     "ListIssues",
+		GivenID:    fmt.Sprintf("%d", page),
+		GivenState: state,
+	})
+	if page > 1 {
+		return nil, l.ExpectedError
+	}
+	return l.ExpectedIssues, l.ExpectedError
+}
+
 func (l *logGithubClient) FindIssue(issue *issueDetail) (*githubSearchResultRow, error) {
 	l.History = append(l.History, logAction{
 		Method:             "FindIssue",
@@ -59,11 +90,12 @@ func (l *logGithubClient) CreateIssue(issue *issueDetail) error {
 
 func (l *logGithubClient) UpdateIssue(issue *issueDetail, rs *githubSearchResultRow) error {
 	l.History = append(l.History, logAction{
-		Method:     "UpdateIssue",
-		GivenID:    fmt.Sprintf("%d", rs.Number),
-		GivenTitle: issue.Title,
-		GivenBody:  issue.Body,
-		GivenState: issue.State,
+		Method:      "UpdateIssue",
+		GivenID:     fmt.Sprintf("%d", rs.Number),
+		GivenTitle:  issue.Title,
+		GivenBody:   issue.Body,
+		GivenState:  issue.State,
+		GivenLabels: issue.Labels,
 	})
 	return l.ExpectedError
 }
@@ -72,6 +104,8 @@ func TestGithubAPIClient(t *testing.T) {
 	testCases := []struct {
 		givenFile       string
 		givenFoundIssue *githubSearchResultRow
+		givenSearch     []githubSearchResultRow
+		givenOptions    syncOptions
 		givenError      error
 		expectedHistory []logAction
 	}{
@@ -82,7 +116,7 @@ func TestGithubAPIClient(t *testing.T) {
 					Method:             "FindIssue",
 					GivenID:            "4",
 					GivenTitle:         "should create/update github issue on pt story create/update",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153926444\r\n\r\ncreate me",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153926444\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926444 version:1 -->\r\n\r\ncreate me",
 					GivenState:         "open",
 					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
 				},
@@ -90,7 +124,7 @@ func TestGithubAPIClient(t *testing.T) {
 					Method:             "CreateIssue",
 					GivenID:            "4",
 					GivenTitle:         "should create/update github issue on pt story create/update",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153926444\r\n\r\ncreate me",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153926444\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926444 version:1 -->\r\n\r\ncreate me",
 					GivenState:         "open",
 					GivenSearchFilters: []string(nil),
 				},
@@ -109,14 +143,14 @@ func TestGithubAPIClient(t *testing.T) {
 					Method:             "FindIssue",
 					GivenID:            "1",
 					GivenTitle:         "should create a story on pivotal tracker",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153937786\r\n\r\notherwise one two three four five\n\n- [ ] what else?\ndone?",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153937786\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153937786 version:1 -->\r\n\r\notherwise one two three four five\n\n- [ ] what else?\ndone?",
 					GivenSearchFilters: []string{"should create a story on pivotal tracker in:title is:issue repo:user123/repo456"},
 				},
 				{
 					Method:             "CreateIssue",
 					GivenID:            "1",
 					GivenTitle:         "should create a story on pivotal tracker",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153937786\r\n\r\notherwise one two three four five\n\n- [ ] what else?\ndone?",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153937786\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153937786 version:1 -->\r\n\r\notherwise one two three four five\n\n- [ ] what else?\ndone?",
 					GivenSearchFilters: []string(nil),
 				},
 			},
@@ -128,14 +162,14 @@ func TestGithubAPIClient(t *testing.T) {
 					Method:             "FindIssue",
 					GivenID:            "2",
 					GivenTitle:         "should create/update story on github issue create/update",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153937780\r\n\r\nLorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\n\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum!",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153937780\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153937780 version:1 -->\r\n\r\nLorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\n\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum!",
 					GivenSearchFilters: []string{"should create/update story on github issue create/update in:title is:issue repo:user123/repo456"},
 				},
 				{
 					Method:             "CreateIssue",
 					GivenID:            "2",
 					GivenTitle:         "should create/update story on github issue create/update",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153937780\r\n\r\nLorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\n\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum!",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153937780\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153937780 version:1 -->\r\n\r\nLorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\n\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum!",
 					GivenSearchFilters: []string(nil),
 				},
 			},
@@ -147,14 +181,34 @@ func TestGithubAPIClient(t *testing.T) {
 					Method:             "FindIssue",
 					GivenID:            "",
 					GivenTitle:         "As a X I should be able to do Y",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153898290\r\n\r\nSome description text lorem ipsum",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153898290\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153898290 project:2120247 version:1 -->\r\n\r\nSome description text lorem ipsum",
+					GivenSearchFilters: []string{"As a X I should be able to do Y in:title is:issue repo:user123/repo456"},
+				},
+				{
+					Method:             "CreateIssue",
+					GivenID:            "",
+					GivenTitle:         "As a X I should be able to do Y",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153898290\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153898290 project:2120247 version:1 -->\r\n\r\nSome description text lorem ipsum",
+					GivenSearchFilters: []string(nil),
+				},
+			},
+		},
+		{
+			givenFile:    "testdata/tracker/story_create_activity.json",
+			givenOptions: syncOptions{LinkTemplate: "Tracked in [PT #{{ .StoryID }}]({{ .URL }})"},
+			expectedHistory: []logAction{
+				{
+					Method:             "FindIssue",
+					GivenID:            "",
+					GivenTitle:         "As a X I should be able to do Y",
+					GivenBody:          "Tracked in [PT #153898290](https://www.pivotaltracker.com/story/show/153898290)\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153898290 project:2120247 version:1 -->\r\n\r\nSome description text lorem ipsum",
 					GivenSearchFilters: []string{"As a X I should be able to do Y in:title is:issue repo:user123/repo456"},
 				},
 				{
 					Method:             "CreateIssue",
 					GivenID:            "",
 					GivenTitle:         "As a X I should be able to do Y",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153898290\r\n\r\nSome description text lorem ipsum",
+					GivenBody:          "Tracked in [PT #153898290](https://www.pivotaltracker.com/story/show/153898290)\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153898290 project:2120247 version:1 -->\r\n\r\nSome description text lorem ipsum",
 					GivenSearchFilters: []string(nil),
 				},
 			},
@@ -203,14 +257,14 @@ func TestGithubAPIClient(t *testing.T) {
 					Method:             "FindIssue",
 					GivenID:            "4",
 					GivenTitle:         "should create/update github issue on pt story create/update",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nok last bit",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153926473\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926473 version:1 -->\r\n\r\nok last bit",
 					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
 				},
 				{
 					Method:             "CreateIssue",
 					GivenID:            "4",
 					GivenTitle:         "should create/update github issue on pt story create/update",
-					GivenBody:          "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nok last bit",
+					GivenBody:          "https://www.pivotaltracker.com/story/show/153926473\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926473 version:1 -->\r\n\r\nok last bit",
 					GivenSearchFilters: []string(nil),
 				},
 			},
@@ -229,6 +283,10 @@ func TestGithubAPIClient(t *testing.T) {
 					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
 					GivenState:         "closed",
 				},
+				{
+					Method:  "SearchIssues",
+					GivenID: "153926473 in:body is:issue label:epic repo:user123/repo456",
+				},
 				{
 					Method:     "UpdateIssue",
 					GivenID:    "42",
@@ -250,6 +308,225 @@ func TestGithubAPIClient(t *testing.T) {
 					GivenTitle:         "should create/update github issue on pt story create/update" + noStorySuffix,
 					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
 				},
+				{
+					Method:  "SearchIssues",
+					GivenID: "153926473 in:body is:issue label:epic repo:user123/repo456",
+				},
+				{
+					Method:  "GetIssue",
+					GivenID: "42",
+				},
+				{
+					Method:     "UpdateIssue",
+					GivenID:    "42",
+					GivenTitle: "should create/update github issue on pt story create/update" + noStorySuffix,
+					GivenBody:  "Hello world",
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/task_create_activity.json",
+			givenFoundIssue: &githubSearchResultRow{
+				Number: 42,
+				Title:  "should create/update github issue on pt story create/update",
+				Body:   "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world",
+			},
+			expectedHistory: []logAction{
+				{
+					Method:             "FindIssue",
+					GivenTitle:         "should create/update github issue on pt story create/update",
+					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
+				},
+				{
+					Method:  "GetIssue",
+					GivenID: "42",
+				},
+				{
+					Method:     "UpdateIssue",
+					GivenID:    "42",
+					GivenTitle: "should create/update github issue on pt story create/update",
+					GivenBody:  "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world\r\n\r\n" + tasksSection.begin() + "\r\n- [ ] add migration <!-- task:61345678 -->\r\n" + tasksSection.end(),
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/task_update_activity.json",
+			givenFoundIssue: &githubSearchResultRow{
+				Number: 42,
+				Title:  "should create/update github issue on pt story create/update",
+				Body:   "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world\r\n\r\n" + tasksSection.begin() + "\r\n- [ ] add migration <!-- task:61345678 -->\r\n" + tasksSection.end(),
+			},
+			expectedHistory: []logAction{
+				{
+					Method:             "FindIssue",
+					GivenTitle:         "should create/update github issue on pt story create/update",
+					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
+				},
+				{
+					Method:  "GetIssue",
+					GivenID: "42",
+				},
+				{
+					Method:     "UpdateIssue",
+					GivenID:    "42",
+					GivenTitle: "should create/update github issue on pt story create/update",
+					GivenBody:  "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world\r\n\r\n" + tasksSection.begin() + "\r\n- [x] add migration <!-- task:61345678 -->\r\n" + tasksSection.end(),
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/task_update_activity.json",
+			givenFoundIssue: &githubSearchResultRow{
+				Number: 42,
+				Title:  "should create/update github issue on pt story create/update",
+				Body:   "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world\r\n\r\n" + tasksSection.begin() + "\r\n- [x] add migration <!-- task:61345678 -->\r\n" + tasksSection.end(),
+			},
+			expectedHistory: []logAction{
+				{
+					Method:             "FindIssue",
+					GivenTitle:         "should create/update github issue on pt story create/update",
+					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
+				},
+				{
+					Method:  "GetIssue",
+					GivenID: "42",
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/blocker_create_activity.json",
+			givenFoundIssue: &githubSearchResultRow{
+				Number: 3,
+				Title:  "should create/update github issue on pt story create/update",
+				Body:   "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world\r\n\r\nblocked by #3",
+			},
+			expectedHistory: []logAction{
+				{
+					Method:             "FindIssue",
+					GivenTitle:         "should create/update github issue on pt story create/update",
+					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
+				},
+				{
+					Method:  "GetIssue",
+					GivenID: "3",
+				},
+				{
+					Method:  "FindIssueByTrackerURL",
+					GivenID: "https://www.pivotaltracker.com/story/show/153984041",
+				},
+				{
+					Method:     "UpdateIssue",
+					GivenID:    "3",
+					GivenTitle: "should create/update github issue on pt story create/update",
+					GivenBody:  "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world\r\n\r\n" + blockersSection.begin() + "\r\n- [ ] Blocked by #3 <!-- blocker:7002 -->\r\n" + blockersSection.end(),
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/task_update_activity.json",
+			expectedHistory: []logAction{
+				{
+					Method:             "FindIssue",
+					GivenTitle:         "should create/update github issue on pt story create/update",
+					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/epic_update_activity.json",
+			givenFoundIssue: &githubSearchResultRow{
+				Number: 7,
+				Title:  "Checkout",
+				Body:   "https://www.pivotaltracker.com/epic/show/4012345\r\n\r\n" + epicMembersSection.render([]checklistItem{{ID: "153926473", Text: "#42 `started`"}}),
+			},
+			expectedHistory: []logAction{
+				{
+					Method:  "FindIssueByTrackerURL",
+					GivenID: "https://www.pivotaltracker.com/epic/show/4012345",
+				},
+				{
+					Method:  "GetIssue",
+					GivenID: "7",
+				},
+				{
+					Method:     "UpdateIssue",
+					GivenID:    "7",
+					GivenTitle: "Checkout flow",
+					GivenBody:  "https://www.pivotaltracker.com/epic/show/4012345\r\n\r\nEverything needed to pay\r\n\r\n" + epicMembersSection.render([]checklistItem{{ID: "153926473", Text: "#42 `started`"}}),
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/epic_update_activity.json",
+			expectedHistory: []logAction{
+				{
+					Method:  "FindIssueByTrackerURL",
+					GivenID: "https://www.pivotaltracker.com/epic/show/4012345",
+				},
+				{
+					Method:     "CreateIssue",
+					GivenTitle: "Checkout flow",
+					GivenBody:  "https://www.pivotaltracker.com/epic/show/4012345\r\n\r\nEverything needed to pay",
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/story_label_activity.json",
+			givenFoundIssue: &githubSearchResultRow{
+				Number: 42,
+				Title:  "should create/update github issue on pt story create/update",
+				Body:   "https://www.pivotaltracker.com/epic/show/4012345",
+			},
+			givenSearch: []githubSearchResultRow{
+				{Number: 7, Title: "Checkout Flow"},
+			},
+			expectedHistory: []logAction{
+				{
+					Method:             "FindIssue",
+					GivenTitle:         "should create/update github issue on pt story create/update",
+					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
+				},
+				{
+					Method:  "SearchIssues",
+					GivenID: `"checkout flow" in:title is:issue label:epic repo:user123/repo456`,
+				},
+				{
+					Method:  "GetIssue",
+					GivenID: "7",
+				},
+				{
+					Method:    "UpdateIssue",
+					GivenID:   "7",
+					GivenBody: "https://www.pivotaltracker.com/epic/show/4012345\r\n\r\n" + epicMembersSection.render([]checklistItem{{ID: "153926473", Text: "#42"}}),
+				},
+			},
+		},
+		{
+			givenFile: "testdata/tracker/story_move_project_activity.json",
+			givenFoundIssue: &githubSearchResultRow{
+				Number: 42,
+				Title:  "should create/update github issue on pt story create/update",
+				Body:   "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world",
+			},
+		},
+		{
+			givenFile:    "testdata/tracker/story_move_project_activity.json",
+			givenOptions: syncOptions{OnProjectMove: projectMoveUnlink},
+			givenFoundIssue: &githubSearchResultRow{
+				Number: 42,
+				Title:  "should create/update github issue on pt story create/update",
+				Body:   "https://www.pivotaltracker.com/story/show/153926473\r\n\r\nHello world",
+			},
+			expectedHistory: []logAction{
+				{
+					Method:             "FindIssue",
+					GivenTitle:         "should create/update github issue on pt story create/update" + noStorySuffix,
+					GivenSearchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
+				},
+				{
+					Method:  "SearchIssues",
+					GivenID: "153926473 in:body is:issue label:epic repo:user123/repo456",
+				},
 				{
 					Method:  "GetIssue",
 					GivenID: "42",
@@ -264,8 +541,8 @@ func TestGithubAPIClient(t *testing.T) {
 		},
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.givenFile, func(t *testing.T) {
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d %s", i, tc.givenFile), func(t *testing.T) {
 			data, err := ioutil.ReadFile(tc.givenFile)
 			if err != nil {
 				t.Fatalf("readfile: %s", err.Error())
@@ -273,10 +550,11 @@ func TestGithubAPIClient(t *testing.T) {
 
 			logclient := logGithubClient{
 				ExpectedFoundIssue: tc.givenFoundIssue,
+				ExpectedSearch:     tc.givenSearch,
 				ExpectedError:      tc.givenError,
 			}
 			s := WebhookStoryHandler{}
-			err = s.handle(data, &logclient, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com")
+			err = s.handle(data, &logclient, "user123/repo456", "https://github.com", "https://www.pivotaltracker.com", tc.givenOptions)
 			assert.Nil(t, err)
 			assert.Equal(t, tc.expectedHistory, logclient.History)
 		})
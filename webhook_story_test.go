@@ -23,10 +23,11 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    ptr("https://github.com/user123/repo456/issues/4\n\ncreate me"),
 			expectedStoryID: "153926444",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153926444",
 				repo:          "user123/repo456",
 				id:            "4",
 				Title:         "should create/update github issue on pt story create/update",
-				Body:          "https://www.pivotaltracker.com/story/show/153926444\r\n\r\ncreate me",
+				Body:          "https://www.pivotaltracker.com/story/show/153926444\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926444 version:1 -->\r\n\r\ncreate me",
 				State:         "open",
 				searchFilters: []string{"should create/update github issue on pt story create/update in:title is:issue repo:user123/repo456"},
 			},
@@ -45,10 +46,11 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    ptr("https://github.com/user123/repo456/issues/1\n\notherwise one two three four five\n\n- [ ] what else?\ndone?"),
 			expectedStoryID: "153937786",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153937786",
 				repo:          "user123/repo456",
 				id:            "1",
 				Title:         "should create a story on pivotal tracker",
-				Body:          "https://www.pivotaltracker.com/story/show/153937786\r\n\r\notherwise one two three four five\n\n- [ ] what else?\ndone?",
+				Body:          "https://www.pivotaltracker.com/story/show/153937786\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153937786 version:1 -->\r\n\r\notherwise one two three four five\n\n- [ ] what else?\ndone?",
 				searchFilters: []string{"should create a story on pivotal tracker in:title is:issue repo:user123/repo456"},
 			},
 		},
@@ -58,9 +60,10 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    ptr(""),
 			expectedStoryID: "153937786",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153937786",
 				repo:          "user123/repo456",
 				Title:         "should create a story on pivotal tracker",
-				Body:          "https://www.pivotaltracker.com/story/show/153937786\r\n\r\n",
+				Body:          "https://www.pivotaltracker.com/story/show/153937786\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153937786 version:1 -->\r\n\r\n",
 				searchFilters: []string{"should create a story on pivotal tracker in:title is:issue repo:user123/repo456"},
 			},
 		},
@@ -70,10 +73,11 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    ptr("https://github.com/user123/repo456/issues/2\n\nLorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\n\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum!"),
 			expectedStoryID: "153937780",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153937780",
 				repo:          "user123/repo456",
 				id:            "2",
 				Title:         "should create/update story on github issue create/update",
-				Body:          "https://www.pivotaltracker.com/story/show/153937780\r\n\r\nLorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\n\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum!",
+				Body:          "https://www.pivotaltracker.com/story/show/153937780\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153937780 version:1 -->\r\n\r\nLorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.\n\nUt enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. Duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum!",
 				searchFilters: []string{"should create/update story on github issue create/update in:title is:issue repo:user123/repo456"},
 			},
 		},
@@ -83,9 +87,10 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    ptr("Some description text lorem ipsum"),
 			expectedStoryID: "153898290",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153898290",
 				repo:          "user123/repo456",
 				Title:         "As a X I should be able to do Y",
-				Body:          "https://www.pivotaltracker.com/story/show/153898290\r\n\r\nSome description text lorem ipsum",
+				Body:          "https://www.pivotaltracker.com/story/show/153898290\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153898290 project:2120247 version:1 -->\r\n\r\nSome description text lorem ipsum",
 				searchFilters: []string{"As a X I should be able to do Y in:title is:issue repo:user123/repo456"},
 			},
 		},
@@ -99,9 +104,10 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    ptr("Lorem body stuff"),
 			expectedStoryID: "153973691",
 			expectedGhIssue: issueDetail{
-				repo:  "user123/repo456",
-				Title: "Hey, World!",
-				Body:  "https://www.pivotaltracker.com/story/show/153973691\r\n\r\nLorem body stuff",
+				storyURL: "https://www.pivotaltracker.com/story/show/153973691",
+				repo:     "user123/repo456",
+				Title:    "Hey, World!",
+				Body:     "https://www.pivotaltracker.com/story/show/153973691\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153973691 version:1 -->\r\n\r\nLorem body stuff",
 				searchFilters: []string{
 					"Hello world in:title is:issue repo:user123/repo456",
 					"Hey, World! in:title is:issue repo:user123/repo456",
@@ -114,9 +120,10 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    ptr("Lorem body stuff ONLY lah"),
 			expectedStoryID: "153973691",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153973691",
 				repo:          "user123/repo456",
 				Title:         "Hey, World!",
-				Body:          "https://www.pivotaltracker.com/story/show/153973691\r\n\r\nLorem body stuff ONLY lah",
+				Body:          "https://www.pivotaltracker.com/story/show/153973691\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153973691 version:1 -->\r\n\r\nLorem body stuff ONLY lah",
 				searchFilters: []string{"Hey, World! in:title is:issue repo:user123/repo456"},
 			},
 		},
@@ -126,8 +133,9 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    nil,
 			expectedStoryID: "153898290",
 			expectedGhIssue: issueDetail{
-				repo:  "user123/repo456",
-				Title: "As an X user, I should be able to do Y with Z",
+				storyURL: "https://www.pivotaltracker.com/story/show/153898290",
+				repo:     "user123/repo456",
+				Title:    "As an X user, I should be able to do Y with Z",
 				searchFilters: []string{
 					"As an X user, I must be able to do Y with Z in:title is:issue repo:user123/repo456",
 					"As an X user, I should be able to do Y with Z in:title is:issue repo:user123/repo456",
@@ -152,10 +160,11 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    ptr("https://github.com/user123/repo456/issues/5\n\nesp since commit message linkage is using a large number `#1234` that in-theory overlaps with github issue numbering\n\nfunny thing?"),
 			expectedStoryID: "153926863",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153926863",
 				repo:          "user123/repo456",
 				id:            "5",
 				Title:         "do we use commit message linkage? or based on issue open/close?",
-				Body:          "https://www.pivotaltracker.com/story/show/153926863\r\n\r\nesp since commit message linkage is using a large number `#1234` that in-theory overlaps with github issue numbering\n\nfunny thing?",
+				Body:          "https://www.pivotaltracker.com/story/show/153926863\r\n<!-- tracker link: https://www.pivotaltracker.com/story/show/153926863 version:1 -->\r\n\r\nesp since commit message linkage is using a large number `#1234` that in-theory overlaps with github issue numbering\n\nfunny thing?",
 				searchFilters: []string{"do we use commit message linkage? or based on issue open/close? in:title is:issue repo:user123/repo456"},
 			},
 		},
@@ -165,6 +174,7 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    nil,
 			expectedStoryID: "153983933",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153983933",
 				repo:          "user123/repo456",
 				id:            "",
 				Title:         "how it works now??",
@@ -178,6 +188,7 @@ func TestWebhookStory(t *testing.T) {
 			expectedBody:    nil,
 			expectedStoryID: "153983933",
 			expectedGhIssue: issueDetail{
+				storyURL:      "https://www.pivotaltracker.com/story/show/153983933",
 				repo:          "user123/repo456",
 				id:            "",
 				Title:         "how it works now??" + noStorySuffix,
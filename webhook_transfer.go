@@ -0,0 +1,42 @@
+package githubtracker
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// label given to PT stories whose GH issue was deleted
+const githubDeletedLabel = "github-deleted"
+
+// webhookTransfer is a github issue moved into another repository
+type webhookTransfer struct {
+	Issue    *webhookIssue
+	NewIssue *webhookIssue
+}
+
+func parseWebhookTransfer(data []byte) (*webhookTransfer, error) {
+	wh := struct {
+		Action  string        `json:"action"`
+		Issue   *webhookIssue `json:"issue"`
+		Changes struct {
+			NewIssue *webhookIssue `json:"new_issue"`
+		} `json:"changes"`
+	}{}
+	if err := json.Unmarshal(data, &wh); err != nil {
+		return nil, errors.Wrap(err, "unmarshal parse transfer")
+	}
+	if wh.Action != "transferred" || wh.Issue == nil || wh.Changes.NewIssue == nil {
+		return nil, nil
+	}
+	return &webhookTransfer{Issue: wh.Issue, NewIssue: wh.Changes.NewIssue}, nil
+}
+
+// relinkDescription points a story description at the transferred issue
+func (t *webhookTransfer) relinkDescription(description string) string {
+	if !strings.HasPrefix(description, t.Issue.URL) {
+		return description
+	}
+	return t.NewIssue.URL + strings.TrimPrefix(description, t.Issue.URL)
+}
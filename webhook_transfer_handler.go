@@ -0,0 +1,54 @@
+package githubtracker
+
+import (
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+func (s WebhookIssueHandler) handleTransfer(transfer *webhookTransfer, client trackerAPIClient) error {
+	rs, err := client.FindStoryByIssueURL(transfer.Issue.URL)
+	if isMultipleMatches(err) {
+		log.Println(err.Error())
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "FindStoryByIssueURL %s", transfer.Issue.URL)
+	}
+	if rs == nil {
+		return nil
+	}
+	story := &storyDetail{Body: transfer.relinkDescription(rs.Description)}
+	err = client.UpdateStory(story, rs)
+	return errors.Wrapf(err, "UpdateStory %#v", story)
+}
+
+func (s WebhookIssueHandler) handleDeletedIssue(issue *webhookIssue, client trackerAPIClient, opts syncOptions) error {
+	rs, err := client.FindStoryByIssueURL(issue.URL)
+	if isMultipleMatches(err) {
+		log.Println(err.Error())
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "FindStoryByIssueURL %s", issue.URL)
+	}
+	if rs == nil {
+		return nil
+	}
+
+	switch opts.OnIssueDeleted {
+	case issueDeletedDelete:
+		err = client.DeleteStory(rs.ID.String())
+		return errors.Wrapf(err, "DeleteStory %s", rs.ID.String())
+	case issueDeletedChore:
+		story := &storyDetail{StoryType: storyTypeChore, CurrentState: storyStateAccepted}
+		if client.RequiresChoreEstimate() {
+			story.Estimate = &rs.Estimate
+		}
+		err = client.UpdateStory(story, rs)
+		return errors.Wrapf(err, "UpdateStory %#v", story)
+	default:
+		err = client.AddLabel(rs.ID.String(), trackerLabel{Name: githubDeletedLabel})
+		return errors.Wrapf(err, "AddLabel %s", rs.ID.String())
+	}
+}